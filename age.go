@@ -0,0 +1,363 @@
+package delphi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+/**
+ * age v1, as in https://age-encryption.org/v1, with X25519 recipients only.
+ *
+ * File layout:
+ *	header:		version line, a stanza per recipient, and a MAC over all of that
+ *	nonce:		16 random bytes
+ *	payload:	the plain text, sealed in chunks exactly as our own streams are, but without AAD
+ *
+ * Each X25519 stanza wraps the file key for one recipient, using an ephemeral key,
+ * much as our own messages are sealed, but with age's HKDF info.
+ **/
+
+var ErrAge = errors.New("bad age file")
+
+const (
+	ageVersionLine    = "age-encryption.org/v1"
+	ageRecipientHRP   = "age"
+	ageIdentityHRP    = "AGE-SECRET-KEY-"
+	ageX25519Type     = "X25519"
+	ageX25519Info     = "age-encryption.org/v1/X25519"
+	ageFileKeySize    = 16
+	agePayloadNonce   = 16
+	ageColumns        = 64
+	ageMaxHeaderLines = 1024
+)
+
+var ageB64 = base64.RawStdEncoding.Strict()
+
+// AgeRecipient returns the encryption half of a [Key] as an age1... recipient
+func (k Key) AgeRecipient() string {
+	s, err := bech32Encode(ageRecipientHRP, k.Encryption().Bytes())
+	if err != nil {
+		//	32 bytes always encode
+		panic(err)
+	}
+	return s
+}
+
+// ParseAgeRecipient parses an age1... recipient. The [Key] it returns only has an encryption half.
+func ParseAgeRecipient(s string) (Key, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: %w", ErrBadKey, err)
+	}
+	if hrp != ageRecipientHRP || len(data) != SubKeySize {
+		return Key{}, fmt.Errorf("%w: not an age X25519 recipient", ErrBadKey)
+	}
+	var k Key
+	k[0] = subKey(data)
+	return k, nil
+}
+
+// AgeIdentity returns the encryption half of a [Principal] as an AGE-SECRET-KEY-1... identity
+func (p Principal) AgeIdentity() string {
+	s, err := bech32Encode(ageIdentityHRP, p.PrivateKey().Encryption().Bytes())
+	if err != nil {
+		panic(err)
+	}
+	return strings.ToUpper(s)
+}
+
+// a stanza is one recipient's entry in an age header
+type ageStanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+// marshal writes a stanza, with its body wrapped at 64 columns.
+// The last line is always short, even if that means it is empty.
+func (s ageStanza) marshal(w io.Writer) {
+	fmt.Fprintf(w, "-> %s\n", strings.Join(append([]string{s.Type}, s.Args...), " "))
+	body := ageB64.EncodeToString(s.Body)
+	for len(body) >= ageColumns {
+		fmt.Fprintln(w, body[:ageColumns])
+		body = body[ageColumns:]
+	}
+	fmt.Fprintln(w, body)
+}
+
+// ageKey derives a key as age does, for wrapping a file key, the header MAC, and the payload
+func ageKey(secret, salt []byte, info string) ([]byte, error) {
+	h := hkdf.New(sha256.New, secret, salt, []byte(info))
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(h, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ageWrapKey derives the key that wraps the file key for one X25519 recipient
+func ageWrapKey(shared, share, recipient []byte) ([]byte, error) {
+	return ageKey(shared, append(bytes.Clone(share), recipient...), ageX25519Info)
+}
+
+// ageHeaderMAC authenticates everything in the header up to and including the "---"
+func ageHeaderMAC(fileKey, header []byte) ([]byte, error) {
+	key, err := ageKey(fileKey, nil, "header")
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(header)
+	return mac.Sum(nil), nil
+}
+
+// wrapAgeFileKey makes an X25519 stanza that only recipient can open
+func wrapAgeFileKey(randy io.Reader, fileKey []byte, recipient Key) (ageStanza, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(randy, ephemeral); err != nil {
+		return ageStanza{}, err
+	}
+	share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	shared, err := curve25519.X25519(ephemeral, recipient.Encryption().Bytes())
+	if err != nil {
+		return ageStanza{}, fmt.Errorf("%w: %w", ErrBadKey, err)
+	}
+	wrapKey, err := ageWrapKey(shared, share, recipient.Encryption().Bytes())
+	if err != nil {
+		return ageStanza{}, err
+	}
+	body, err := encrypt(wrapKey, fileKey, make([]byte, chacha20poly1305.NonceSize), nil)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	return ageStanza{Type: ageX25519Type, Args: []string{ageB64.EncodeToString(share)}, Body: body}, nil
+}
+
+// unwrapAgeFileKey opens an X25519 stanza, returning [ErrNotRecipient] if it is for someone else
+func (p Principal) unwrapAgeFileKey(s ageStanza) ([]byte, error) {
+	if len(s.Args) != 1 {
+		return nil, fmt.Errorf("%w: X25519 stanza has %d arguments", ErrAge, len(s.Args))
+	}
+	share, err := ageB64.DecodeString(s.Args[0])
+	if err != nil || len(share) != curve25519.PointSize {
+		return nil, fmt.Errorf("%w: bad X25519 share", ErrAge)
+	}
+	if len(s.Body) != ageFileKeySize+chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("%w: bad X25519 body", ErrAge)
+	}
+	shared, err := curve25519.X25519(p.privateEncryptionKey().Bytes(), share)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAge, err)
+	}
+	wrapKey, err := ageWrapKey(shared, share, p.PublicKey().Encryption().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	fileKey, err := decrypt(wrapKey, s.Body, make([]byte, chacha20poly1305.NonceSize), nil)
+	if err != nil {
+		return nil, ErrNotRecipient
+	}
+	return fileKey, nil
+}
+
+// marshalAgeHeader writes the version line and stanzas of an age header, followed by their MAC
+func marshalAgeHeader(fileKey []byte, stanzas []ageStanza) (*bytes.Buffer, error) {
+	hdr := new(bytes.Buffer)
+	fmt.Fprintln(hdr, ageVersionLine)
+	for _, s := range stanzas {
+		s.marshal(hdr)
+	}
+	hdr.WriteString("---")
+	mac, err := ageHeaderMAC(fileKey, hdr.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(hdr, " %s\n", ageB64.EncodeToString(mac))
+	return hdr, nil
+}
+
+// EncryptAge returns a writer that encrypts to recipients as an age file, which the age tool can open.
+// Only the encryption halves of recipients are used, and the file does not say who it is from.
+// The caller must Close it to seal the last chunk.
+func (p Principal) EncryptAge(randy io.Reader, w io.Writer, recipients ...Key) (io.WriteCloser, error) {
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: no recipients", ErrAge)
+	}
+
+	fileKey := make([]byte, ageFileKeySize)
+	if _, err := io.ReadFull(randy, fileKey); err != nil {
+		return nil, err
+	}
+
+	stanzas := make([]ageStanza, 0, len(recipients))
+	for _, recipient := range recipients {
+		if recipient.Encryption().IsZero() {
+			return nil, fmt.Errorf("%w: recipient: %w", ErrAge, ErrBadKey)
+		}
+		s, err := wrapAgeFileKey(randy, fileKey, recipient)
+		if err != nil {
+			return nil, err
+		}
+		stanzas = append(stanzas, s)
+	}
+	hdr, err := marshalAgeHeader(fileKey, stanzas)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, agePayloadNonce)
+	if _, err := io.ReadFull(randy, nonce); err != nil {
+		return nil, err
+	}
+	key, err := ageKey(fileKey, nonce, "payload")
+	if err != nil {
+		return nil, err
+	}
+	hdr.Write(nonce)
+	if _, err := w.Write(hdr.Bytes()); err != nil {
+		return nil, err
+	}
+
+	sw := &streamWriter{
+		w:   w,
+		key: key,
+		buf: make([]byte, 0, ChunkSize),
+	}
+	return sw, nil
+}
+
+// readAgeLine reads one line of an age header, without its newline
+func readAgeLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAge, err)
+	}
+	return bytes.Clone(line[:len(line)-1]), nil
+}
+
+// readAgeHeader reads the stanzas of an age header, along with its MAC and the bytes that the MAC covers
+func readAgeHeader(r *bufio.Reader) ([]ageStanza, []byte, []byte, error) {
+	hdr := new(bytes.Buffer)
+	line, err := readAgeLine(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if string(line) != ageVersionLine {
+		return nil, nil, nil, fmt.Errorf("%w: not an age v1 file", ErrAge)
+	}
+	hdr.Write(line)
+	hdr.WriteByte('\n')
+
+	stanzas := make([]ageStanza, 0)
+	var s *ageStanza
+	for range ageMaxHeaderLines {
+		line, err := readAgeLine(r)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		switch {
+		case s != nil:
+			//	body lines, until one is short
+			if len(line) > ageColumns {
+				return nil, nil, nil, fmt.Errorf("%w: stanza line too long", ErrAge)
+			}
+			b, err := ageB64.DecodeString(string(line))
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("%w: stanza body: %w", ErrAge, err)
+			}
+			s.Body = append(s.Body, b...)
+			if len(line) < ageColumns {
+				stanzas = append(stanzas, *s)
+				s = nil
+			}
+		case bytes.HasPrefix(line, []byte("-> ")):
+			fields := strings.Split(string(line[3:]), " ")
+			for _, f := range fields {
+				if f == "" {
+					return nil, nil, nil, fmt.Errorf("%w: empty stanza argument", ErrAge)
+				}
+			}
+			s = &ageStanza{Type: fields[0], Args: fields[1:]}
+		case bytes.HasPrefix(line, []byte("--- ")):
+			mac, err := ageB64.DecodeString(string(line[4:]))
+			if err != nil || len(mac) != sha256.Size {
+				return nil, nil, nil, fmt.Errorf("%w: bad header MAC", ErrAge)
+			}
+			hdr.WriteString("---")
+			return stanzas, mac, hdr.Bytes(), nil
+		default:
+			return nil, nil, nil, fmt.Errorf("%w: unexpected header line", ErrAge)
+		}
+		hdr.Write(line)
+		hdr.WriteByte('\n')
+	}
+	return nil, nil, nil, fmt.Errorf("%w: header too long", ErrAge)
+}
+
+// DecryptAge returns a reader of the plain text of an age file with an X25519 stanza for p.
+// Stanzas of other types are skipped. If none are for p, it returns [ErrNotRecipient].
+func (p Principal) DecryptAge(r io.Reader) (io.Reader, error) {
+
+	br := bufio.NewReader(r)
+	stanzas, mac, hdr, err := readAgeHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileKey []byte
+	for _, s := range stanzas {
+		if s.Type != ageX25519Type {
+			continue
+		}
+		fileKey, err = p.unwrapAgeFileKey(s)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrNotRecipient) {
+			return nil, err
+		}
+	}
+	if fileKey == nil {
+		return nil, ErrNotRecipient
+	}
+
+	want, err := ageHeaderMAC(fileKey, hdr)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, want) {
+		return nil, fmt.Errorf("%w: bad header MAC", ErrAge)
+	}
+
+	nonce := make([]byte, agePayloadNonce)
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAge, err)
+	}
+	key, err := ageKey(fileKey, nonce, "payload")
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &streamReader{
+		r:           br,
+		key:         key,
+		chunk:       make([]byte, ChunkSize+chacha20poly1305.Overhead),
+		noEmptyLast: true,
+	}
+	return sr, nil
+}
@@ -0,0 +1,224 @@
+package delphi
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/curve25519"
+)
+
+func TestBech32(t *testing.T) {
+
+	//	from BIP 173
+	for _, s := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	} {
+		_, _, err := bech32Decode(s)
+		assert.NoError(t, err, s)
+	}
+	for _, s := range []string{
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		"A12uEL5L",
+	} {
+		_, _, err := bech32Decode(s)
+		assert.ErrorIs(t, err, ErrBech32, s)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		data := []byte("hello, bech32")
+		s, err := bech32Encode("test", data)
+		assert.NoError(t, err)
+		hrp, got, err := bech32Decode(strings.ToUpper(s))
+		assert.NoError(t, err)
+		assert.Equal(t, "test", hrp)
+		assert.Equal(t, data, got)
+	})
+}
+
+func TestAge(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+
+	t.Run("the test identity of age", func(t *testing.T) {
+		//	from the test kit of age: a secret key of 32 bytes of 0x42
+		var p Principal
+		copy(p[1][0][:], bytes.Repeat([]byte{0x42}, 32))
+		pub, err := curve25519.X25519(p[1][0][:], curve25519.Basepoint)
+		assert.NoError(t, err)
+		copy(p[0][0][:], pub)
+		assert.Equal(t, "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX", p.AgeIdentity())
+		assert.Equal(t, "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj", p.PublicKey().AgeRecipient())
+	})
+
+	t.Run("recipient and identity", func(t *testing.T) {
+		recipient := bob.PublicKey().AgeRecipient()
+		assert.True(t, strings.HasPrefix(recipient, "age1"))
+		assert.Len(t, recipient, 62)
+		k, err := ParseAgeRecipient(recipient)
+		assert.NoError(t, err)
+		assert.Equal(t, bob.PublicKey().Encryption(), k.Encryption())
+		assert.True(t, k.Signing().IsZero())
+
+		identity := bob.AgeIdentity()
+		assert.True(t, strings.HasPrefix(identity, "AGE-SECRET-KEY-1"))
+		assert.Equal(t, strings.ToUpper(identity), identity)
+		hrp, secret, err := bech32Decode(identity)
+		assert.NoError(t, err)
+		assert.Equal(t, "age-secret-key-", hrp)
+		pub, err := curve25519.X25519(secret, curve25519.Basepoint)
+		assert.NoError(t, err)
+		assert.Equal(t, bob.PublicKey().Encryption().Bytes(), pub)
+
+		_, err = ParseAgeRecipient(identity)
+		assert.ErrorIs(t, err, ErrBadKey)
+		_, err = ParseAgeRecipient("age1nope")
+		assert.ErrorIs(t, err, ErrBadKey)
+	})
+
+	seal := func(t *testing.T, plain []byte, recipients ...Key) []byte {
+		t.Helper()
+		buf := new(bytes.Buffer)
+		w, err := alice.EncryptAge(randy, buf, recipients...)
+		assert.NoError(t, err)
+		_, err = w.Write(plain)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	open := func(p Principal, file []byte) ([]byte, error) {
+		r, err := p.DecryptAge(bytes.NewReader(file))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3 * ChunkSize} {
+			plain := bytes.Repeat([]byte{'a'}, size)
+			file := seal(t, plain, bob.PublicKey())
+			got, err := open(bob, file)
+			assert.NoError(t, err, size)
+			assert.Equal(t, plain, got, size)
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		file := seal(t, []byte("hi"), bob.PublicKey(), carol.PublicKey())
+		lines := strings.SplitN(string(file), "\n", 7)
+		assert.Equal(t, "age-encryption.org/v1", lines[0])
+		assert.True(t, strings.HasPrefix(lines[1], "-> X25519 "))
+		assert.Len(t, lines[2], 43)
+		assert.True(t, strings.HasPrefix(lines[3], "-> X25519 "))
+		assert.True(t, strings.HasPrefix(lines[5], "--- "))
+
+		//	both recipients can open it, and nobody else
+		for _, p := range []Principal{bob, carol} {
+			got, err := open(p, file)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("hi"), got)
+		}
+		_, err := open(alice, file)
+		assert.ErrorIs(t, err, ErrNotRecipient)
+	})
+
+	t.Run("to a bare age recipient", func(t *testing.T) {
+		k, err := ParseAgeRecipient(bob.PublicKey().AgeRecipient())
+		assert.NoError(t, err)
+		got, err := open(bob, seal(t, []byte("hi"), k))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("hi"), got)
+	})
+
+	t.Run("unknown stanzas are skipped, but covered by the MAC", func(t *testing.T) {
+		fileKey := bytes.Repeat([]byte{7}, ageFileKeySize)
+		x25519, err := wrapAgeFileKey(randy, fileKey, bob.PublicKey())
+		assert.NoError(t, err)
+		other := ageStanza{Type: "other-type", Args: []string{"arg"}, Body: bytes.Repeat([]byte{1}, 48)}
+		hdr, err := marshalAgeHeader(fileKey, []ageStanza{other, x25519})
+		assert.NoError(t, err)
+		assert.Contains(t, hdr.String(), "-> other-type arg\nAQEB")
+
+		nonce := bytes.Repeat([]byte{9}, agePayloadNonce)
+		key, err := ageKey(fileKey, nonce, "payload")
+		assert.NoError(t, err)
+		hdr.Write(nonce)
+		sw := &streamWriter{w: hdr, key: key, buf: make([]byte, 0, ChunkSize)}
+		sw.Write([]byte("hi"))
+		assert.NoError(t, sw.Close())
+		file := hdr.Bytes()
+
+		got, err := open(bob, file)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("hi"), got)
+
+		tampered := bytes.Replace(file, []byte("other-type arg"), []byte("other-type grr"), 1)
+		_, err = open(bob, tampered)
+		assert.ErrorIs(t, err, ErrAge)
+	})
+
+	t.Run("tampering", func(t *testing.T) {
+		file := seal(t, []byte("hello"), bob.PublicKey())
+
+		_, err := open(bob, file[:len(file)-1])
+		assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+		flipped := bytes.Clone(file)
+		flipped[len(flipped)-1] ^= 1
+		_, err = open(bob, flipped)
+		assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+		_, err = open(bob, bytes.Replace(file, []byte("age-encryption.org/v1"), []byte("age-encryption.org/v2"), 1))
+		assert.ErrorIs(t, err, ErrAge)
+
+		headerEnd := bytes.Index(file, []byte("\n--- ")) + 5
+		_, err = open(bob, file[:headerEnd+10])
+		assert.ErrorIs(t, err, ErrAge)
+	})
+
+	t.Run("an empty last chunk only when it is the only one", func(t *testing.T) {
+		fileKey := bytes.Repeat([]byte{7}, ageFileKeySize)
+		x25519, err := wrapAgeFileKey(randy, fileKey, bob.PublicKey())
+		assert.NoError(t, err)
+		hdr, err := marshalAgeHeader(fileKey, []ageStanza{x25519})
+		assert.NoError(t, err)
+		nonce := bytes.Repeat([]byte{9}, agePayloadNonce)
+		key, err := ageKey(fileKey, nonce, "payload")
+		assert.NoError(t, err)
+		hdr.Write(nonce)
+
+		//	a full chunk, marked as not the last, then an empty last chunk
+		sw := &streamWriter{w: hdr, key: key, buf: make([]byte, 0, ChunkSize)}
+		sw.Write(bytes.Repeat([]byte{'a'}, ChunkSize))
+		assert.NoError(t, sw.flush(false))
+		assert.NoError(t, sw.Close())
+		_, err = open(bob, hdr.Bytes())
+		assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+		got, err := open(bob, seal(t, nil, bob.PublicKey()))
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("no recipients", func(t *testing.T) {
+		_, err := alice.EncryptAge(randy, io.Discard)
+		assert.ErrorIs(t, err, ErrAge)
+	})
+}
@@ -0,0 +1,142 @@
+package delphi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// the keyspace for claims made in a certification
+const claimKeyspace = "claim"
+
+var ErrBadCertification = errors.New("bad certification")
+var ErrUntrusted = errors.New("untrusted")
+
+// A Certification is one [Peer] vouching that another Peer is who the claims say it is.
+// On the wire, it is a signed [Message] with subject [KeyCertification], whose body is the certified key.
+type Certification struct {
+	Certifier Key
+	Certified Key
+	Claims    map[string]string
+	Time      time.Time
+	Message   *Message
+}
+
+// Certify signs a statement that peer belongs to whoever the claims describe.
+// Claims are optional, and are typically things like a name or an email address.
+func (p Principal) Certify(randy io.Reader, peer Peer, claims map[string]string) (*Message, error) {
+	if peer.IsZero() {
+		return nil, fmt.Errorf("%w: %w", ErrBadCertification, ErrBadKey)
+	}
+	msg := p.ComposeMessage(randy, peer.Bytes())
+	msg.Subject = KeyCertification
+	for k, v := range claims {
+		msg.Headers.Set(claimKeyspace, k, v)
+	}
+	if err := msg.Sign(randy, p); err != nil {
+		return nil, fmt.Errorf("could not certify: %w", err)
+	}
+	return msg, nil
+}
+
+// ParseCertification checks that msg is a well-formed, validly signed certification, and parses it.
+func ParseCertification(msg *Message) (Certification, error) {
+	if msg == nil || msg.Subject != KeyCertification {
+		return Certification{}, fmt.Errorf("%w: wrong subject", ErrBadCertification)
+	}
+	if len(msg.PlainText) != 2*SubKeySize {
+		return Certification{}, fmt.Errorf("%w: body is not a key", ErrBadCertification)
+	}
+	if err := msg.verifyV2(); err != nil {
+		return Certification{}, fmt.Errorf("%w: %w", ErrBadCertification, err)
+	}
+	when := msg.SignedAt()
+	if when.IsZero() {
+		return Certification{}, fmt.Errorf("%w: no time of signing", ErrBadCertification)
+	}
+	claims := make(map[string]string)
+	prefix := claimKeyspace + "/"
+	for k, v := range msg.Headers {
+		if strings.HasPrefix(k, prefix) {
+			claims[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	cert := Certification{
+		Certifier: msg.SenderKey,
+		Certified: KeyFromBytes(msg.PlainText),
+		Claims:    claims,
+		Time:      when,
+		Message:   msg,
+	}
+	return cert, nil
+}
+
+// Trust decides whether a [Peer] is trusted, by walking certifications outward from a set of trusted roots.
+type Trust struct {
+	Roots    []Peer
+	MaxDepth int // the longest chain of certifications to follow. Zero means no limit.
+}
+
+// Path returns the shortest chain of Peers from a root to target, where each Peer certifies the next.
+// certs are assumed to have been checked with [ParseCertification].
+// A root is trusted by definition, and its path is just itself.
+func (t Trust) Path(certs []Certification, target Peer) ([]Peer, error) {
+
+	//	who certifies whom
+	edges := make(map[string][]Peer)
+	for _, cert := range certs {
+		k := cert.Certifier.ToHex()
+		edges[k] = append(edges[k], cert.Certified)
+	}
+
+	//	breadth first, so that the first path found is a shortest one
+	parent := make(map[string]string)
+	frontier := make([]Peer, 0, len(t.Roots))
+	for _, root := range t.Roots {
+		if _, seen := parent[root.ToHex()]; !seen {
+			parent[root.ToHex()] = ""
+			frontier = append(frontier, root)
+		}
+	}
+
+	for depth := 0; len(frontier) > 0; depth++ {
+		for _, peer := range frontier {
+			if peer.Equal(target) {
+				return t.unwind(parent, target), nil
+			}
+		}
+		if t.MaxDepth > 0 && depth >= t.MaxDepth {
+			break
+		}
+		next := make([]Peer, 0)
+		for _, peer := range frontier {
+			for _, certified := range edges[peer.ToHex()] {
+				if _, seen := parent[certified.ToHex()]; seen {
+					continue
+				}
+				parent[certified.ToHex()] = peer.ToHex()
+				next = append(next, certified)
+			}
+		}
+		frontier = next
+	}
+
+	return nil, fmt.Errorf("%w: no path to %s", ErrUntrusted, target.Nickname())
+}
+
+// unwind follows parents from target back to a root
+func (t Trust) unwind(parent map[string]string, target Peer) []Peer {
+	path := []Peer{target}
+	for cur := parent[target.ToHex()]; cur != ""; cur = parent[cur] {
+		path = append([]Peer{KeyFromHex(cur)}, path...)
+	}
+	return path
+}
+
+// Trusted reports whether target is trusted
+func (t Trust) Trusted(certs []Certification, target Peer) bool {
+	_, err := t.Path(certs, target)
+	return err == nil
+}
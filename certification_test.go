@@ -0,0 +1,96 @@
+package delphi
+
+import (
+	"encoding/pem"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertify(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	msg, err := alice.Certify(randy, bob.PublicKey(), map[string]string{"name": "Bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, KeyCertification, msg.Subject)
+
+	//	survive PEM
+	p := toPEM(t, msg)
+	blk, _ := pem.Decode(pem.EncodeToMemory(&p))
+	got := new(Message)
+	assert.NoError(t, got.FromPEM(*blk))
+
+	cert, err := ParseCertification(got)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.PublicKey(), cert.Certifier)
+	assert.Equal(t, bob.PublicKey(), cert.Certified)
+	assert.Equal(t, "Bob", cert.Claims["name"])
+	assert.False(t, cert.Time.IsZero())
+
+	t.Run("tampered claims", func(t *testing.T) {
+		got.Headers.Set(claimKeyspace, "name", "Mallory")
+		_, err := ParseCertification(got)
+		assert.ErrorIs(t, err, ErrBadCertification)
+	})
+
+	t.Run("v1 is refused", func(t *testing.T) {
+		msg, err := alice.Certify(randy, bob.PublicKey(), nil)
+		assert.NoError(t, err)
+		signV1(t, msg, alice)
+		_, err = ParseCertification(msg)
+		assert.ErrorIs(t, err, ErrWeakDigest)
+	})
+
+	t.Run("not a certification", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		_, err := ParseCertification(msg)
+		assert.ErrorIs(t, err, ErrBadCertification)
+	})
+
+}
+
+func TestTrust(t *testing.T) {
+
+	//	root -> alice -> bob -> carol. dave is on his own.
+	root := NewPrincipal(randy)
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+	dave := NewPrincipal(randy)
+
+	kr, err := OpenKeyring(afero.NewMemMapFs(), "keyring.pem")
+	assert.NoError(t, err)
+
+	for _, pair := range [][2]Principal{{root, alice}, {alice, bob}, {bob, carol}, {dave, root}} {
+		msg, err := pair[0].Certify(randy, pair[1].PublicKey(), nil)
+		assert.NoError(t, err)
+		assert.NoError(t, kr.AddCertification(msg))
+	}
+	assert.NoError(t, kr.Save())
+
+	//	certifications survive the keyring being saved and opened
+	kr, err = OpenKeyring(kr.fs, "keyring.pem")
+	assert.NoError(t, err)
+	assert.Len(t, kr.Certifications(), 4)
+
+	trust := Trust{Roots: []Peer{root.PublicKey()}}
+
+	path, err := kr.TrustPath(trust, carol.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, []Peer{root.PublicKey(), alice.PublicKey(), bob.PublicKey(), carol.PublicKey()}, path)
+
+	path, err = kr.TrustPath(trust, root.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, []Peer{root.PublicKey()}, path)
+
+	_, err = kr.TrustPath(trust, dave.PublicKey())
+	assert.ErrorIs(t, err, ErrUntrusted)
+
+	trust.MaxDepth = 2
+	assert.True(t, trust.Trusted(kr.Certifications(), bob.PublicKey()))
+	assert.False(t, trust.Trusted(kr.Certifications(), carol.PublicKey()))
+
+}
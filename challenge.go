@@ -0,0 +1,137 @@
+package delphi
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrBadChallenge = errors.New("bad challenge")
+var ErrChallengeMismatch = errors.New("assertion does not answer the challenge")
+var ErrWrongAudience = errors.New("assertion is for a different audience")
+var ErrChallengeExpired = errors.New("challenge has expired")
+
+// DefaultChallengeLifetime is how long a [Challenge] may be answered, unless told otherwise
+const DefaultChallengeLifetime = 5 * time.Minute
+
+// ChallengeSize is the size of the random value in a [Challenge]
+const ChallengeSize = 32
+
+// A Challenge is issued by a verifier, and answered by a prover with a signed assertion.
+// Because the value is random, and the answer must arrive before Expires, an old assertion cannot be replayed.
+// On the wire, it is a [Message] with subject [ChallengeMessage], whose body is the random value.
+type Challenge struct {
+	Value    []byte
+	Audience string // who is asking. An assertion for one audience cannot be used with another.
+	Expires  time.Time
+}
+
+// NewChallenge creates a [Challenge] for audience, which may be answered for lifetime.
+// A lifetime of zero means [DefaultChallengeLifetime].
+func NewChallenge(randy io.Reader, audience string, lifetime time.Duration) (Challenge, error) {
+	if lifetime <= 0 {
+		lifetime = DefaultChallengeLifetime
+	}
+	c := Challenge{
+		Value:    make([]byte, ChallengeSize),
+		Audience: audience,
+		Expires:  time.Now().UTC().Add(lifetime).Truncate(time.Second),
+	}
+	if _, err := io.ReadFull(randy, c.Value); err != nil {
+		return Challenge{}, fmt.Errorf("%w: %w", ErrBadChallenge, err)
+	}
+	return c, nil
+}
+
+// Message wraps the challenge in a [Message], to be sent to the prover
+func (c Challenge) Message(randy io.Reader) *Message {
+	msg := ComposeMessage(randy, ChallengeMessage, c.Value)
+	c.setHeaders(msg.Headers)
+	return msg
+}
+
+func (c Challenge) setHeaders(hdrs KV) {
+	hdrs.Set(Keyspace, "audience", c.Audience)
+	hdrs.SetTime(Keyspace, "expires", c.Expires)
+}
+
+// challengeFrom reads the challenge that a [Message] carries
+func challengeFrom(msg *Message) (Challenge, error) {
+	if len(msg.PlainText) != ChallengeSize {
+		return Challenge{}, fmt.Errorf("%w: wrong size. wanted %d but got %d", ErrBadChallenge, ChallengeSize, len(msg.PlainText))
+	}
+	expires, err := msg.Headers.GetTime(Keyspace, "expires")
+	if err != nil {
+		return Challenge{}, fmt.Errorf("%w: %w", ErrBadChallenge, err)
+	}
+	c := Challenge{
+		Value:    msg.PlainText,
+		Audience: msg.Headers.Get(Keyspace, "audience"),
+		Expires:  expires,
+	}
+	return c, nil
+}
+
+// ParseChallenge reads a [Challenge] from a [Message]
+func ParseChallenge(msg *Message) (Challenge, error) {
+	if msg == nil || msg.Subject != ChallengeMessage {
+		return Challenge{}, fmt.Errorf("%w: wrong subject", ErrBadChallenge)
+	}
+	return challengeFrom(msg)
+}
+
+// AssertChallenge answers a [Challenge] with a signed assertion
+func (p Principal) AssertChallenge(randy io.Reader, c Challenge) (*Message, error) {
+	if time.Now().After(c.Expires) {
+		return nil, fmt.Errorf("could not create assertion: %w", ErrChallengeExpired)
+	}
+	msg := p.ComposeMessage(randy, c.Value)
+	msg.Subject = Assertion
+	c.setHeaders(msg.Headers)
+	if err := msg.Sign(randy, p); err != nil {
+		return nil, fmt.Errorf("could not create assertion: %w", err)
+	}
+	return msg, nil
+}
+
+// VerifyOnce is [Challenge.Verify], but also consumes the challenge with guard,
+// so that an assertion captured on its way to the verifier can not be used again while the challenge is open.
+func (c Challenge) VerifyOnce(assertion *Message, now time.Time, guard ReplayGuard) (Key, error) {
+	prover, err := c.Verify(assertion, now)
+	if err != nil {
+		return Key{}, err
+	}
+	answered := c.Message(nil)
+	answered.Headers.SetTime(Keyspace, "signed-at", assertion.SignedAt())
+	if err := guard.Check(answered); err != nil {
+		return Key{}, err
+	}
+	return prover, nil
+}
+
+// Verify checks that assertion is a valid answer to this challenge at time now, and returns who made it.
+// It keeps no state, so the same assertion verifies until the challenge expires. See [Challenge.VerifyOnce].
+func (c Challenge) Verify(assertion *Message, now time.Time) (Key, error) {
+	if assertion == nil || assertion.Subject != Assertion {
+		return Key{}, fmt.Errorf("%w: not an assertion", ErrChallengeMismatch)
+	}
+	if err := assertion.verifyV2(); err != nil {
+		return Key{}, err
+	}
+	answered, err := challengeFrom(assertion)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: %w", ErrChallengeMismatch, err)
+	}
+	if subtle.ConstantTimeCompare(answered.Value, c.Value) != 1 || !answered.Expires.Equal(c.Expires) {
+		return Key{}, ErrChallengeMismatch
+	}
+	if answered.Audience != c.Audience {
+		return Key{}, fmt.Errorf("%w: %q", ErrWrongAudience, answered.Audience)
+	}
+	if now.After(c.Expires) {
+		return Key{}, fmt.Errorf("%w: at %s", ErrChallengeExpired, c.Expires.Format(time.RFC3339))
+	}
+	return assertion.SenderKey, nil
+}
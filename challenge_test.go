@@ -0,0 +1,95 @@
+package delphi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChallenge(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+
+	c, err := NewChallenge(randy, "bob", time.Minute)
+	assert.NoError(t, err)
+
+	//	over the wire
+	got, err := ParseChallenge(c.Message(randy))
+	assert.NoError(t, err)
+	assert.Equal(t, c.Value, got.Value)
+	assert.Equal(t, "bob", got.Audience)
+
+	assertion, err := alice.AssertChallenge(randy, got)
+	assert.NoError(t, err)
+	prover, err := c.Verify(assertion, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, prover.Equal(alice.PublicKey()))
+
+	t.Run("replay", func(t *testing.T) {
+		next, _ := NewChallenge(randy, "bob", time.Minute)
+		_, err := next.Verify(assertion, time.Now())
+		assert.ErrorIs(t, err, ErrChallengeMismatch)
+
+		static, _ := alice.Assert(randy)
+		_, err = c.Verify(static, time.Now())
+		assert.ErrorIs(t, err, ErrChallengeMismatch)
+	})
+
+	t.Run("audience", func(t *testing.T) {
+		//	carol relays bob's challenge under her own name
+		relayed := c
+		relayed.Audience = "carol"
+		answer, _ := alice.AssertChallenge(randy, relayed)
+		_, err := c.Verify(answer, time.Now())
+		assert.ErrorIs(t, err, ErrWrongAudience)
+	})
+
+	t.Run("freshness", func(t *testing.T) {
+		_, err := c.Verify(assertion, time.Now().Add(2*time.Minute))
+		assert.ErrorIs(t, err, ErrChallengeExpired)
+
+		expired := c
+		expired.Expires = time.Now().Add(-time.Minute)
+		_, err = alice.AssertChallenge(randy, expired)
+		assert.ErrorIs(t, err, ErrChallengeExpired)
+	})
+
+	t.Run("once", func(t *testing.T) {
+		c, _ := NewChallenge(randy, "bob", time.Minute)
+		guard := NewMemoryReplayGuard(0)
+		assertion, _ := alice.AssertChallenge(randy, c)
+		_, err := c.VerifyOnce(assertion, time.Now(), guard)
+		assert.NoError(t, err)
+		_, err = c.VerifyOnce(assertion, time.Now(), guard)
+		assert.ErrorIs(t, err, ErrReplay)
+
+		//	nor can it be answered again
+		again, _ := alice.AssertChallenge(randy, c)
+		_, err = c.VerifyOnce(again, time.Now(), guard)
+		assert.ErrorIs(t, err, ErrReplay)
+
+		//	a bad answer does not use up the challenge
+		other, _ := NewChallenge(randy, "bob", time.Minute)
+		_, err = other.VerifyOnce(NewPrincipal(randy).ComposeMessage(randy, nil), time.Now(), guard)
+		assert.ErrorIs(t, err, ErrChallengeMismatch)
+		answer, _ := alice.AssertChallenge(randy, other)
+		_, err = other.VerifyOnce(answer, time.Now(), guard)
+		assert.NoError(t, err)
+	})
+
+	t.Run("v1 is refused", func(t *testing.T) {
+		assertion, _ := alice.AssertChallenge(randy, c)
+		signV1(t, assertion, alice)
+		_, err := c.Verify(assertion, time.Now())
+		assert.ErrorIs(t, err, ErrWeakDigest)
+	})
+
+	t.Run("forged", func(t *testing.T) {
+		forged, _ := alice.AssertChallenge(randy, c)
+		forged.SenderKey = NewPrincipal(randy).PublicKey()
+		_, err := c.Verify(forged, time.Now())
+		assert.ErrorIs(t, err, ErrNoValid)
+	})
+
+}
@@ -7,6 +7,73 @@ import (
 
 type EncrypterOpts = any
 
+// EncryptOptions tune how a [Message] is encrypted. Pass one, or a pointer to one, as [EncrypterOpts].
+type EncryptOptions struct {
+	// RecipientValidity, if set, must cover the present moment, or encryption is refused
+	RecipientValidity *Validity
+	// Mode is one of [ModeBase] or [ModeAuth]. Empty means ModeBase.
+	Mode string
+	// Compression is one of [CompressNone] or [CompressDeflate]. Empty means CompressNone.
+	Compression string
+	// Padding hides the length of the plain text. The zero value means [PadNone].
+	Padding Padding
+	// HideSender puts the sender's key inside the cipher text, so that it is not sent in the clear.
+	// It cannot be used with [ModeAuth], because the recipient needs the sender's key before decrypting.
+	HideSender bool
+	// SignHiddenSender, along with HideSender, signs the hidden sender's key, so that decrypting proves who sent it.
+	SignHiddenSender bool
+	// HideRecipient leaves the recipient's key off the message, along with anything else that would identify them.
+	// A blinded hint lets the recipient find it, with [TrialDecrypt].
+	HideRecipient bool
+}
+
+// encryptOptions makes sense of whatever was passed as [EncrypterOpts]
+func encryptOptions(opts EncrypterOpts) EncryptOptions {
+	var o EncryptOptions
+	switch v := opts.(type) {
+	case EncryptOptions:
+		o = v
+	case *EncryptOptions:
+		if v != nil {
+			o = *v
+		}
+	}
+	if o.Mode == "" {
+		o.Mode = ModeBase
+	}
+	if o.Compression == "" {
+		o.Compression = CompressNone
+	}
+	return o
+}
+
+// DecryptOptions tune how a [Message] is decrypted. Pass one, or a pointer to one, as [crypto.DecrypterOpts].
+type DecryptOptions struct {
+	// ReplayGuard, if set, refuses messages it has seen before. Only messages that decrypt are recorded.
+	ReplayGuard ReplayGuard
+	// DecompressLimit is the most that a compressed message may inflate to. Zero means [DefaultDecompressLimit].
+	DecompressLimit int64
+	// RequireSignedSender refuses messages with a hidden sender, unless the sender signed.
+	RequireSignedSender bool
+}
+
+// decryptOptions makes sense of whatever was passed as [crypto.DecrypterOpts]
+func decryptOptions(opts crypto.DecrypterOpts) DecryptOptions {
+	var o DecryptOptions
+	switch v := opts.(type) {
+	case DecryptOptions:
+		o = v
+	case *DecryptOptions:
+		if v != nil {
+			o = *v
+		}
+	}
+	if o.DecompressLimit <= 0 {
+		o.DecompressLimit = DefaultDecompressLimit
+	}
+	return o
+}
+
 type Encrypter interface {
 	Encrypt(io.Reader, *Message, Key, EncrypterOpts) error
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+)
+
+// encryptAge encrypts stdin to stdout as an age file, which the age tool can open.
+// Recipients are public keys passed in with --key, keyring entries, or age1... recipients passed with --to.
+// age files are anonymous, so no private key is needed.
+func (app *DelphiApp) encryptAge(env hermeti.Env) {
+
+	recipients, _, err := app.PluckRecipients(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	//	age recipients are used as they are, and the rest are looked up in the keyring
+	queries := app.opts.to
+	app.opts.to = nil
+	for _, query := range queries {
+		if !strings.HasPrefix(query, "age1") {
+			app.opts.to = append(app.opts.to, query)
+			continue
+		}
+		k, err := delphi.ParseAgeRecipient(query)
+		if err != nil {
+			fmt.Fprintln(env.ErrStream, err)
+			return
+		}
+		recipients = append(recipients, k)
+	}
+	known, err := app.lookupRecipients(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	recipients = append(recipients, known...)
+	if len(recipients) == 0 {
+		fmt.Fprintln(env.ErrStream, ErrNoRecipient)
+		return
+	}
+
+	w, err := app.Self.EncryptAge(env.Randomness, env.OutStream, recipients...)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if _, err := io.Copy(w, env.InStream); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+	}
+}
+
+// decryptAge decrypts an age file on stdin to stdout.
+// The private key must be passed in with --key, because stdin is the file.
+func (app *DelphiApp) decryptAge(env hermeti.Env) {
+
+	if !app.pluckPriv() {
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	}
+
+	r, err := app.Self.DecryptAge(env.InStream)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if _, err := io.Copy(env.OutStream, r); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+	}
+}
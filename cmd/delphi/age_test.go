@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAge(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	plain := bytes.Repeat([]byte("all work and no play makes jack a dull boy\n"), 5000)
+
+	//	cat falling-grass.pub.pem | delphi export --format age
+	recipient := hermeti.NewTestCli(new(DelphiApp))
+	recipient.Env.Args = []string{"delphi", "export", "--format", "age"}
+	recipient.Env.Mount(subfs, "./testdata")
+	fd, err := recipient.Env.Filesystem.Open("./testdata/falling-grass.pub.pem")
+	assert.NoError(t, err)
+	recipient.Env.InStream = fd
+	recipient.Run()
+	out, _ := recipient.OutStream()
+	ageRecipient := strings.TrimSpace(out.String())
+	assert.True(t, strings.HasPrefix(ageRecipient, "age1"), ageRecipient)
+
+	//	cat falling-grass.pem | delphi export --format age
+	identity := hermeti.NewTestCli(new(DelphiApp))
+	identity.Env.Args = []string{"delphi", "export", "--format", "age"}
+	identity.Env.Mount(subfs, "./testdata")
+	fd, err = identity.Env.Filesystem.Open("./testdata/falling-grass.pem")
+	assert.NoError(t, err)
+	identity.Env.InStream = fd
+	identity.Run()
+	out, _ = identity.OutStream()
+	assert.Contains(t, out.String(), "# public key: "+ageRecipient+"\n")
+	assert.Contains(t, out.String(), "\nAGE-SECRET-KEY-1")
+
+	//	delphi encrypt --format age --to age1... < plain
+	enc := hermeti.NewTestCli(new(DelphiApp))
+	enc.Env.Args = []string{"delphi", "encrypt", "--format", "age", "--to", ageRecipient}
+	enc.Env.Randomness = rand.Reader
+	enc.Env.InStream = bytes.NewReader(plain)
+	enc.Run()
+
+	eBuf, _ := enc.ErrStream()
+	assert.Equal(t, 0, eBuf.Len(), eBuf.String())
+	ciph, err := enc.OutStream()
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(ciph.Bytes(), []byte("age-encryption.org/v1\n-> X25519 ")))
+	file := bytes.Clone(ciph.Bytes())
+
+	//	delphi decrypt --format age --key falling-grass.pem < ciph
+	dec := hermeti.NewTestCli(new(DelphiApp))
+	dec.Env.Args = []string{"delphi", "decrypt", "--format", "age", "--key", "testdata/falling-grass.pem"}
+	dec.Env.Mount(subfs, "./testdata")
+	dec.Env.InStream = bytes.NewReader(file)
+	dec.Run()
+
+	eBuf, _ = dec.ErrStream()
+	assert.Equal(t, 0, eBuf.Len(), eBuf.String())
+	got, _ := dec.OutStream()
+	assert.Equal(t, plain, got.Bytes())
+
+	t.Run("wrong key", func(t *testing.T) {
+		dec := hermeti.NewTestCli(new(DelphiApp))
+		dec.Env.Args = []string{"delphi", "decrypt", "--format", "age", "--key", "testdata/bitter-frost.pem"}
+		dec.Env.Mount(subfs, "./testdata")
+		dec.Env.InStream = bytes.NewReader(file)
+		dec.Run()
+		eBuf, _ := dec.ErrStream()
+		assert.Contains(t, eBuf.String(), "not a recipient")
+	})
+
+	t.Run("to a public key file", func(t *testing.T) {
+		enc := hermeti.NewTestCli(new(DelphiApp))
+		enc.Env.Args = []string{"delphi", "encrypt", "--format", "age", "--key", "testdata/falling-grass.pub.pem"}
+		enc.Env.Randomness = rand.Reader
+		enc.Env.Mount(subfs, "./testdata")
+		enc.Env.InStream = strings.NewReader("hello")
+		enc.Run()
+		ciph, _ := enc.OutStream()
+
+		dec := hermeti.NewTestCli(new(DelphiApp))
+		dec.Env.Args = []string{"delphi", "decrypt", "--format", "age", "--key", "testdata/falling-grass.pem"}
+		dec.Env.Mount(subfs, "./testdata")
+		dec.Env.InStream = ciph
+		dec.Run()
+		got, _ := dec.OutStream()
+		assert.Equal(t, "hello", got.String())
+	})
+}
@@ -10,15 +10,27 @@ import (
 )
 
 type DelphiApp struct {
-	Self       delphi.Principal
-	subcommand string
-	pems       pemBag
-	inBuff     *bytes.Buffer
+	Self         delphi.Principal
+	subcommand   string
+	pems         pemBag
+	inBuff       *bytes.Buffer
+	opts         options
+	args         []string
+	initErr      error
+	passphrase   func(prompt string) ([]byte, error)
+	privErr      error
+	selfValidity *delphi.Validity
 }
 
 // Run runs a *delphiApp against a [hermiti.Env].
 func (app *DelphiApp) Run(env hermeti.Env) {
 
+	//	hermeti does not stop on a failed Init, so we do
+	if app.initErr != nil {
+		fmt.Fprintln(env.ErrStream, app.initErr)
+		return
+	}
+
 	//	subcommands come from env.Args
 	switch app.subcommand {
 	case "create":
@@ -43,6 +55,18 @@ func (app *DelphiApp) Run(env hermeti.Env) {
 		app.unwrap(env)
 	case "sign":
 		app.sign(env)
+	case "keys":
+		app.keys(env)
+	case "revoke":
+		app.revoke(env)
+	case "subkey":
+		app.subkey(env)
+	case "challenge":
+		app.challenge(env)
+	case "export":
+		app.export(env)
+	case "import":
+		app.importKey(env)
 	default:
 		fmt.Fprintf(env.ErrStream, "no subcommand called %q\n", app.subcommand)
 	}
@@ -50,18 +74,37 @@ func (app *DelphiApp) Run(env hermeti.Env) {
 
 // Init prepares a *delphiApp for [Run]nig
 func (app *DelphiApp) Init(env hermeti.Env) error {
+	app.initErr = app.init(env)
+	return app.initErr
+}
+
+func (app *DelphiApp) init(env hermeti.Env) error {
 
 	//	the subcommand is the 2nd arg
 	if len(env.Args) >= 2 {
 		app.subcommand = env.Args[1]
 	}
 
+	//	flags come after the subcommand
+	if err := app.parseFlags(env); err != nil {
+		return err
+	}
+
+	app.passphrase = app.passphraseSource(env)
+
 	//	a pemBag to hold all the pems
 	app.pems = make(pemBag)
+	if err := app.loadKeyFiles(env); err != nil {
+		return err
+	}
 
-	switch app.subcommand {
-	case "create":
-		// create doesn't assume anything was passed in on stdIn
+	switch {
+	case app.subcommand == "create", app.subcommand == "challenge":
+		// create and challenge don't assume anything was passed in on stdIn
+	case app.opts.stream, app.opts.format == formatAge && app.subcommand != "export":
+		// stdIn is a raw stream, to be consumed while running
+	case app.subcommand == "keys" && (len(app.args) == 0 || app.args[0] != "add"):
+		// only adding keys reads from stdIn
 	default:
 
 		// read in all pems
@@ -77,6 +120,13 @@ func (app *DelphiApp) Init(env hermeti.Env) error {
 			thispem, remainder = readNextPem(remainder)
 		}
 		app.inBuff = bytes.NewBuffer(remainder)
+
+		//	JSON messages follow any PEMs
+		if app.opts.format == formatJSON {
+			if err := app.readJSON(); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -3,23 +3,35 @@ package main
 import (
 	"fmt"
 
+	"github.com/sean9999/go-delphi"
 	"github.com/sean9999/hermeti"
 )
 
 func (app *DelphiApp) create_assertion(env hermeti.Env) {
 
 	if !app.pluckPriv() {
-		fmt.Fprintln(env.ErrStream, ErrNoPrivKey)
+		fmt.Fprintln(env.ErrStream, app.privError())
 		return
 	}
 
-	msg, err := app.Self.Assert(env.Randomness)
+	var msg *delphi.Message
+	var err error
+	if app.opts.challenge != "" {
+		//	answer a challenge, so that the assertion cannot be replayed
+		var c delphi.Challenge
+		c, err = app.readChallenge(env, app.opts.challenge)
+		if err == nil {
+			msg, err = app.Self.AssertChallenge(env.Randomness, c)
+		}
+	} else {
+		msg, err = app.Self.Assert(env.Randomness)
+	}
 
 	if err != nil {
 		fmt.Fprintln(env.ErrStream, err)
 		return
 	}
 
-	fmt.Fprintln(env.OutStream, msg)
+	app.emit(env, msg)
 
 }
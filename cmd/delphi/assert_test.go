@@ -51,3 +51,56 @@ func TestAssert(t *testing.T) {
 	assert.Equal(t, delphi.Assertion, msg.Subject)
 
 }
+
+func TestAssert_Challenge(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	fsys := afero.NewMemMapFs()
+
+	run := func(args []string, stdin ...string) (string, string) {
+		cli := hermeti.NewTestCli(new(DelphiApp))
+		cli.Env.Args = args
+		cli.Env.Randomness = rand.Reader
+		cli.Env.Filesystem = fsys
+		cli.Env.Mount(subfs, "./testdata")
+		for _, s := range stdin {
+			cli.Env.PipeIn(bytes.NewBufferString(s))
+		}
+		cli.Run()
+		oBuf, _ := cli.OutStream()
+		eBuf, _ := cli.ErrStream()
+		return oBuf.String(), eBuf.String()
+	}
+
+	//	delphi challenge example.com > challenge.pem
+	challenge, errs := run([]string{"delphi", "challenge", "example.com"})
+	assert.Empty(t, errs)
+	assert.Contains(t, challenge, string(delphi.ChallengeMessage))
+	afero.WriteFile(fsys, "challenge.pem", []byte(challenge), 0600)
+
+	//	cat bitter-frost.pem | delphi assert --challenge challenge.pem
+	privKey, _ := afero.ReadFile(fsys, "./testdata/bitter-frost.pem")
+	assertion, errs := run([]string{"delphi", "assert", "--challenge", "challenge.pem"}, string(privKey))
+	assert.Empty(t, errs)
+	assert.Contains(t, assertion, "delphi/audience: example.com")
+
+	//	cat assertion.pem | delphi verify --challenge challenge.pem
+	out, errs := run([]string{"delphi", "verify", "--challenge", "challenge.pem"}, assertion)
+	assert.Empty(t, errs)
+	assert.Contains(t, out, "ok")
+
+	//	cat assertion.pem | delphi verify --challenge challenge.pem --replay-cache seen.txt
+	out, errs = run([]string{"delphi", "verify", "--challenge", "challenge.pem", "--replay-cache", "seen.txt"}, assertion)
+	assert.Empty(t, errs)
+	assert.Contains(t, out, "ok")
+	out, errs = run([]string{"delphi", "verify", "--challenge", "challenge.pem", "--replay-cache", "seen.txt"}, assertion)
+	assert.Contains(t, errs, delphi.ErrReplay.Error())
+	assert.NotContains(t, out, "ok")
+
+	//	an assertion that does not answer the challenge
+	static, _ := run([]string{"delphi", "assert"}, string(privKey))
+	out, errs = run([]string{"delphi", "verify", "--challenge", "challenge.pem"}, static)
+	assert.Contains(t, errs, delphi.ErrChallengeMismatch.Error())
+	assert.NotContains(t, out, "ok")
+
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+)
+
+// challenge outputs a new challenge, for a prover to answer with delphi assert --challenge.
+// Usage: delphi challenge AUDIENCE [--lifetime 5m]
+func (app *DelphiApp) challenge(env hermeti.Env) {
+
+	if len(app.args) != 1 {
+		fmt.Fprintln(env.ErrStream, "usage: delphi challenge AUDIENCE")
+		return
+	}
+
+	c, err := delphi.NewChallenge(env.Randomness, app.args[0], app.opts.lifetime)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	app.emit(env, c.Message(env.Randomness))
+}
+
+// readChallenge reads a challenge from a file
+func (app *DelphiApp) readChallenge(env hermeti.Env, fpath string) (delphi.Challenge, error) {
+	b, err := afero.ReadFile(env.Filesystem, fpath)
+	if err != nil {
+		return delphi.Challenge{}, err
+	}
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return delphi.Challenge{}, fmt.Errorf("%w: no PEM in %q", delphi.ErrBadChallenge, fpath)
+	}
+	msg := new(delphi.Message)
+	if err := msg.FromPEM(*p); err != nil {
+		return delphi.Challenge{}, err
+	}
+	return delphi.ParseChallenge(msg)
+}
+
+// verifyChallenge verifies an assertion passed in on stdin, against a challenge. Usage: delphi verify --challenge FILE
+func (app *DelphiApp) verifyChallenge(env hermeti.Env) {
+
+	c, err := app.readChallenge(env, app.opts.challenge)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	p := app.pems.Pluck(delphi.Assertion)
+	if p == nil {
+		fmt.Fprintln(env.ErrStream, delphi.ErrNoMsg)
+		return
+	}
+	msg := new(delphi.Message)
+	if err := msg.FromPEM(*p); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	guard, err := app.replayGuard(env)
+	if err == nil && guard != nil {
+		_, err = c.VerifyOnce(msg, time.Now(), guard)
+	} else if err == nil {
+		_, err = c.Verify(msg, time.Now())
+	}
+	if err == nil {
+		err = app.verifySigner(env, msg)
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	fmt.Fprintln(env.OutStream, "ok")
+}
@@ -16,14 +16,30 @@ func (app *DelphiApp) create(env hermeti.Env) {
 	}
 
 	p := delphi.NewPrincipal(env.Randomness)
-	pemFile, err := p.MarshalPEM()
 
-	//	I don't see how an error is possibe. Nevertheless...
+	var pemFile pem.Block
+	var err error
+	if app.opts.protect {
+		var pass []byte
+		pass, err = app.passphrase("new passphrase: ")
+		if err == nil {
+			pemFile, err = p.MarshalProtectedPEM(env.Randomness, pass)
+		}
+	} else {
+		//	I don't see how an error is possibe. Nevertheless...
+		pemFile, err = p.MarshalPEM()
+	}
 	if err != nil {
 		fmt.Fprintln(env.ErrStream, err)
 		return
 	}
 
+	if app.opts.lifetime > 0 {
+		v := p.NewValidity(app.opts.lifetime)
+		v.SetHeaders(pemFile.Headers)
+		app.selfValidity = &v
+	}
+
 	app.Self = p
 
 	pemBytes := pem.EncodeToMemory(&pemFile)
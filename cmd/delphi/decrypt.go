@@ -26,19 +26,89 @@ func (app *DelphiApp) PluckEncrypted() *delphi.Message {
 
 func (app *DelphiApp) decrypt(env hermeti.Env) {
 
+	if app.opts.stream {
+		app.decryptStream(env)
+		return
+	}
+	if app.opts.format == formatAge {
+		app.decryptAge(env)
+		return
+	}
+	if app.opts.trial {
+		app.decryptTrial(env)
+		return
+	}
+
 	msg := app.PluckEncrypted()
 
 	if !app.pluckPriv() {
-		fmt.Fprintln(env.ErrStream, "no private key. WTF do you expect me to do with that?")
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	}
+
+	subkeys, err := app.privateSubkeys()
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	kc := app.keychain(subkeys)
+
+	guard, err := app.replayGuard(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	err = kc.Decrypt(msg, delphi.DecryptOptions{ReplayGuard: guard, RequireSignedSender: true})
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
 		return
 	}
 
-	err := app.Self.Decrypt(msg, nil)
+	app.emit(env, msg)
+
+}
+
+// decryptTrial tries every private key on every encrypted message, and outputs the ones that open.
+// The rest are for somebody else, and are quietly dropped.
+func (app *DelphiApp) decryptTrial(env hermeti.Env) {
+
+	//	subkeys are plucked once, and shared out among the private keys they belong to
+	subkeys, err := app.privateSubkeys()
 	if err != nil {
 		fmt.Fprintln(env.ErrStream, err)
 		return
 	}
+	decrypters := make([]delphi.Decrypter, 0)
+	for app.pluckPriv() {
+		decrypters = append(decrypters, app.keychain(subkeys))
+	}
+	if len(decrypters) == 0 {
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	}
 
-	fmt.Fprintln(env.OutStream, msg)
+	msgs := make([]*delphi.Message, 0)
+	for msg := app.PluckEncrypted(); msg != nil; msg = app.PluckEncrypted() {
+		msgs = append(msgs, msg)
+	}
+
+	guard, err := app.replayGuard(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	opened, err := delphi.TrialDecryptAll(msgs, delphi.DecryptOptions{ReplayGuard: guard, RequireSignedSender: true}, decrypters...)
+	for _, msg := range opened {
+		app.emit(env, msg)
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if len(opened) == 0 {
+		fmt.Fprintln(env.ErrStream, delphi.ErrNotRecipient)
+	}
 
 }
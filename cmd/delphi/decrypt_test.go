@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
+	"encoding/pem"
 	"testing"
 
 	"github.com/sean9999/go-delphi"
@@ -48,3 +50,46 @@ func TestDecrypt(t *testing.T) {
 	assert.NotNil(t, msg.Eph)
 
 }
+
+func TestDecrypt_Trial(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat PUB PRIV fortune_feynman.pem | delphi encrypt --hide-recipient
+	hiddenTo := func(pub, priv string) []byte {
+		cli := hermeti.NewTestCli(new(DelphiApp))
+		cli.Env.Args = []string{"delphi", "encrypt", "--hide-recipient"}
+		cli.Env.Randomness = rand.Reader
+		cli.Env.Mount(subfs, "./testdata")
+		cli.Env.PipeInFiles(pub, priv, "testdata/fortune_feynman.pem")
+		cli.Run()
+		buf, _ := cli.OutStream()
+		return buf.Bytes()
+	}
+	forGrass := hiddenTo("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pem")
+	forFrost := hiddenTo("testdata/bitter-frost.pub.pem", "testdata/falling-grass.pem")
+	p, _ := pem.Decode(forGrass)
+	if assert.NotNil(t, p) {
+		assert.NotContains(t, p.Headers, "to")
+	}
+
+	//	cat for-frost.pem for-grass.pem falling-grass.pem | delphi decrypt --trial
+	cli := hermeti.NewTestCli(new(DelphiApp))
+	cli.Env.Args = []string{"delphi", "decrypt", "--trial"}
+	cli.Env.Mount(subfs, "./testdata")
+	cli.Env.PipeIn(bytes.NewReader(append(forFrost, forGrass...)))
+	cli.Env.PipeInFile("testdata/falling-grass.pem")
+	cli.Run()
+
+	eBuf, _ := cli.ErrStream()
+	assert.Empty(t, eBuf.String())
+	oBuf, _ := cli.OutStream()
+	got, rest := pem.Decode(oBuf.Bytes())
+	if assert.NotNil(t, got) {
+		assert.Equal(t, string(delphi.PlainMessage), got.Type)
+		assert.NotEmpty(t, got.Headers["to"])
+	}
+	more, _ := pem.Decode(rest)
+	assert.Nil(t, more)
+
+}
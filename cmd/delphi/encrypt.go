@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/sean9999/go-delphi"
 	"github.com/sean9999/hermeti"
@@ -18,6 +19,32 @@ func (app *DelphiApp) PluckPeer() (pubkey delphi.Key) {
 	return pubkey
 }
 
+// PluckRecipients plucks out all public keys from the [pemBag], along with the validity periods of those that have one,
+// refusing any whose validity period does not cover the present moment, or that lost the one the keyring knows of.
+func (app *DelphiApp) PluckRecipients(env hermeti.Env) ([]delphi.Key, map[delphi.Key]*delphi.Validity, error) {
+	peers := make([]delphi.Key, 0)
+	validities := make(map[delphi.Key]*delphi.Validity)
+	now := time.Now()
+	for p := app.pems.Pluck(delphi.Pubkey); p != nil; p = app.pems.Pluck(delphi.Pubkey) {
+		var peer delphi.Key
+		if err := peer.UnmarshalPEM(*p); err != nil {
+			return nil, nil, err
+		}
+		v, err := app.validityFromHeaders(env, peer, p.Headers)
+		if err != nil {
+			return nil, nil, err
+		}
+		if v != nil {
+			if err := v.Check(peer, now); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", peer.Nickname(), err)
+			}
+			validities[peer] = v
+		}
+		peers = append(peers, peer)
+	}
+	return peers, validities, nil
+}
+
 // PluckPlain plucks out a plain message from the [pemBag].
 func (app *DelphiApp) PluckPlain() *delphi.Message {
 	p := app.pems.Pluck(delphi.PlainMessage)
@@ -35,16 +62,43 @@ func (app *DelphiApp) PluckPlain() *delphi.Message {
 // encrypt a PEM-encoded plain message, thereby turning it into an encrypted message
 func (app *DelphiApp) encrypt(env hermeti.Env) {
 
+	if app.opts.stream {
+		if app.opts.compress || app.opts.pad != "" {
+			fmt.Fprintln(env.ErrStream, errors.New("--compress and --pad do not work with --stream"))
+			return
+		}
+		app.encryptStream(env)
+		return
+	}
+	if app.opts.format == formatAge {
+		if app.opts.compress || app.opts.pad != "" || app.opts.hideSender || app.opts.hideRecipient || app.opts.auth {
+			fmt.Fprintln(env.ErrStream, errors.New("--format age does not work with --compress, --pad, --hide-sender, --hide-recipient or --auth"))
+			return
+		}
+		app.encryptAge(env)
+		return
+	}
+
 	//	self
 	hasPriv := app.pluckPriv()
 	if !hasPriv {
-		fmt.Fprintln(env.ErrStream, ErrNoPrivKey)
+		fmt.Fprintln(env.ErrStream, app.privError())
 		return
 	}
 
-	//	recipient
-	recipient := app.PluckPeer()
-	if recipient.IsZero() {
+	//	recipients
+	recipients, validities, err := app.PluckRecipients(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	known, err := app.lookupRecipients(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	recipients = append(recipients, known...)
+	if len(recipients) == 0 {
 		fmt.Fprintln(env.ErrStream, ErrNoRecipient)
 		return
 	}
@@ -58,11 +112,61 @@ func (app *DelphiApp) encrypt(env hermeti.Env) {
 
 	msg.SenderKey = app.Self.PublicKey()
 
-	err := app.Self.Encrypt(env.Randomness, msg, recipient, nil)
+	opts := delphi.EncryptOptions{Mode: delphi.ModeBase, Compression: delphi.CompressNone}
+	if app.opts.auth {
+		opts.Mode = delphi.ModeAuth
+	}
+	opts.HideRecipient = app.opts.hideRecipient
+	if app.opts.hideSender {
+		opts.HideSender = true
+		opts.SignHiddenSender = true
+	}
+	if app.opts.compress {
+		opts.Compression = delphi.CompressDeflate
+	}
+	if app.opts.pad != "" {
+		opts.Padding, err = delphi.ParsePadding(app.opts.pad)
+		if err != nil {
+			fmt.Fprintln(env.ErrStream, err)
+			return
+		}
+	}
+
+	//	a single recipient with a subkey gets encrypted to the newest one.
+	//	more than one recipient means an envelope with one slot per recipient
+	if len(recipients) == 1 {
+		//	the validity period is always checked, whether it came in with the key or from the keyring
+		opts.RecipientValidity = validities[recipients[0]]
+		if opts.RecipientValidity == nil {
+			opts.RecipientValidity, err = app.validityOf(env, recipients[0])
+		}
+		var sk delphi.Subkey
+		var hasSubkey bool
+		if err == nil {
+			sk, hasSubkey, err = app.newestSubkey(env, recipients[0])
+		}
+		switch {
+		case err != nil:
+		case hasSubkey:
+			err = app.Self.EncryptToSubkey(env.Randomness, msg, sk, opts)
+		default:
+			err = app.Self.Encrypt(env.Randomness, msg, recipients[0], opts)
+		}
+	} else if app.opts.auth {
+		err = errors.New("--auth needs exactly one recipient")
+	} else if app.opts.hideSender {
+		err = errors.New("--hide-sender needs exactly one recipient")
+	} else if app.opts.hideRecipient {
+		err = errors.New("--hide-recipient needs exactly one recipient")
+	} else if err = msg.Compress(opts.Compression); err == nil {
+		if err = msg.Pad(opts.Padding); err == nil {
+			err = app.Self.EncryptToMany(env.Randomness, msg, recipients...)
+		}
+	}
 	if err != nil {
 		fmt.Fprintln(env.ErrStream, err)
 		return
 	}
-	fmt.Fprintln(env.OutStream, msg)
+	app.emit(env, msg)
 
 }
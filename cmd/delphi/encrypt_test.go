@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/pem"
+	"os"
 	"testing"
 
 	"github.com/sean9999/go-delphi"
@@ -54,3 +56,209 @@ func TestEncrypt(t *testing.T) {
 	assert.Equal(t, "bitter-frost", msg.SenderKey.Nickname())
 
 }
+
+func TestEncrypt_ManyRecipients(t *testing.T) {
+
+	//	cli with testing env
+	app := new(DelphiApp)
+	cli := hermeti.NewTestCli(app)
+	cli.Env.Args = []string{"delphi", "encrypt"}
+	cli.Env.Randomness = rand.Reader
+
+	//	mount ../../testdata into memory-backed fs
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	cli.Env.Mount(subfs, "./testdata")
+
+	//	two public keys means two recipients
+	err := cli.Env.PipeInFiles("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pub.pem", "testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli.Run()
+	buf, _ := cli.OutStream()
+	assert.Contains(t, buf.String(), "DELPHI ENCRYPTED MESSAGE")
+
+	p, _ := pem.Decode(buf.Bytes())
+	assert.NotNil(t, p)
+
+	msg := new(delphi.Message)
+	err = msg.FromPEM(*p)
+	assert.NoError(t, err)
+
+	assert.Len(t, msg.Slots, 2)
+	assert.True(t, msg.RecipientKey.IsZero())
+	assert.Equal(t, "bitter-frost", msg.SenderKey.Nickname())
+
+	nicks := []string{msg.Slots[0].RecipientKey.Nickname(), msg.Slots[1].RecipientKey.Nickname()}
+	assert.ElementsMatch(t, []string{"falling-grass", "bitter-frost"}, nicks)
+
+}
+
+func TestEncrypt_Auth(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat falling-grass.pub.pem bitter-frost.pem fortune_feynman.pem | delphi encrypt --auth
+	encrypt := hermeti.NewTestCli(new(DelphiApp))
+	encrypt.Env.Args = []string{"delphi", "encrypt", "--auth"}
+	encrypt.Env.Randomness = rand.Reader
+	encrypt.Env.Mount(subfs, "./testdata")
+	encrypt.Env.PipeInFiles("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+	encrypt.Run()
+
+	buf, _ := encrypt.OutStream()
+	assert.Contains(t, buf.String(), "delphi/mode: auth")
+
+	//	cat message.pem falling-grass.pem | delphi decrypt
+	decrypt := hermeti.NewTestCli(new(DelphiApp))
+	decrypt.Env.Args = []string{"delphi", "decrypt"}
+	decrypt.Env.Mount(subfs, "./testdata")
+	decrypt.Env.PipeIn(bytes.NewReader(buf.Bytes()))
+	decrypt.Env.PipeInFile("testdata/falling-grass.pem")
+	decrypt.Run()
+
+	eBuf, _ := decrypt.ErrStream()
+	assert.Empty(t, eBuf.String())
+	oBuf, _ := decrypt.OutStream()
+	assert.Contains(t, oBuf.String(), "DELPHI PLAIN MESSAGE")
+	assert.Contains(t, oBuf.String(), "delphi/mode: auth")
+
+}
+
+func TestEncrypt_Compress(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat falling-grass.pub.pem bitter-frost.pem fortune_feynman.pem | delphi encrypt --compress
+	encrypt := hermeti.NewTestCli(new(DelphiApp))
+	encrypt.Env.Args = []string{"delphi", "encrypt", "--compress"}
+	encrypt.Env.Randomness = rand.Reader
+	encrypt.Env.Mount(subfs, "./testdata")
+	encrypt.Env.PipeInFiles("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+	encrypt.Run()
+
+	buf, _ := encrypt.OutStream()
+	assert.Contains(t, buf.String(), "delphi/compression: deflate")
+
+	//	cat message.pem falling-grass.pem | delphi decrypt
+	decrypt := hermeti.NewTestCli(new(DelphiApp))
+	decrypt.Env.Args = []string{"delphi", "decrypt"}
+	decrypt.Env.Mount(subfs, "./testdata")
+	decrypt.Env.PipeIn(bytes.NewReader(buf.Bytes()))
+	decrypt.Env.PipeInFile("testdata/falling-grass.pem")
+	decrypt.Run()
+
+	eBuf, _ := decrypt.ErrStream()
+	assert.Empty(t, eBuf.String())
+	oBuf, _ := decrypt.OutStream()
+	got, _ := pem.Decode(oBuf.Bytes())
+	if assert.NotNil(t, got) {
+		b, _ := afero.ReadFile(afero.FromIOFS{FS: subfs}, "fortune_feynman.pem")
+		want, _ := pem.Decode(b)
+		assert.Equal(t, want.Bytes, got.Bytes)
+	}
+
+}
+
+func TestEncrypt_Pad(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat falling-grass.pub.pem bitter-frost.pem fortune_feynman.pem | delphi encrypt --pad bucket/1024
+	encrypt := hermeti.NewTestCli(new(DelphiApp))
+	encrypt.Env.Args = []string{"delphi", "encrypt", "--pad", "bucket/1024"}
+	encrypt.Env.Randomness = rand.Reader
+	encrypt.Env.Mount(subfs, "./testdata")
+	encrypt.Env.PipeInFiles("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+	encrypt.Run()
+
+	buf, _ := encrypt.OutStream()
+	p, _ := pem.Decode(buf.Bytes())
+	if assert.NotNil(t, p) {
+		assert.Equal(t, "bucket/1024", p.Headers["delphi/padding"])
+		assert.Len(t, p.Bytes, 1024+16)
+	}
+
+	t.Run("bad scheme", func(t *testing.T) {
+		cli := hermeti.NewTestCli(new(DelphiApp))
+		cli.Env.Args = []string{"delphi", "encrypt", "--pad", "bucket/0"}
+		cli.Env.Randomness = rand.Reader
+		cli.Env.Mount(subfs, "./testdata")
+		cli.Env.PipeInFiles("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+		cli.Run()
+		eBuf, _ := cli.ErrStream()
+		assert.Contains(t, eBuf.String(), "bad padding")
+	})
+
+}
+
+func TestEncrypt_HideSender(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat falling-grass.pub.pem bitter-frost.pem fortune_feynman.pem | delphi encrypt --hide-sender
+	encrypt := hermeti.NewTestCli(new(DelphiApp))
+	encrypt.Env.Args = []string{"delphi", "encrypt", "--hide-sender"}
+	encrypt.Env.Randomness = rand.Reader
+	encrypt.Env.Mount(subfs, "./testdata")
+	encrypt.Env.PipeInFiles("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+	encrypt.Run()
+
+	buf, _ := encrypt.OutStream()
+	p, _ := pem.Decode(buf.Bytes())
+	if assert.NotNil(t, p) {
+		assert.NotContains(t, p.Headers, "from")
+		assert.Equal(t, "hidden", p.Headers["delphi/sender"])
+	}
+
+	//	cat message.pem falling-grass.pem | delphi decrypt
+	decrypt := hermeti.NewTestCli(new(DelphiApp))
+	decrypt.Env.Args = []string{"delphi", "decrypt"}
+	decrypt.Env.Mount(subfs, "./testdata")
+	decrypt.Env.PipeIn(bytes.NewReader(buf.Bytes()))
+	decrypt.Env.PipeInFile("testdata/falling-grass.pem")
+	decrypt.Run()
+
+	eBuf, _ := decrypt.ErrStream()
+	assert.Empty(t, eBuf.String())
+	oBuf, _ := decrypt.OutStream()
+	got, _ := pem.Decode(oBuf.Bytes())
+	if assert.NotNil(t, got) {
+		assert.Contains(t, got.Headers, "from")
+	}
+
+}
+
+func TestDecrypt_UnsignedHiddenSender(t *testing.T) {
+
+	readKey := func(fpath string) *pem.Block {
+		b, err := os.ReadFile(fpath)
+		assert.NoError(t, err)
+		p, _ := pem.Decode(b)
+		return p
+	}
+	var alice delphi.Principal
+	assert.NoError(t, alice.UnmarshalPEM(*readKey("../../testdata/bitter-frost.pem")))
+	var bob delphi.Key
+	assert.NoError(t, bob.UnmarshalPEM(*readKey("../../testdata/falling-grass.pub.pem")))
+
+	//	anyone could have written this, and claimed to be alice
+	msg := alice.ComposeMessage(rand.Reader, []byte("trust me"))
+	assert.NoError(t, alice.Encrypt(rand.Reader, msg, bob, delphi.EncryptOptions{HideSender: true}))
+	blk, err := msg.ToPEM()
+	assert.NoError(t, err)
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	decrypt := hermeti.NewTestCli(new(DelphiApp))
+	decrypt.Env.Args = []string{"delphi", "decrypt"}
+	decrypt.Env.Mount(subfs, "./testdata")
+	decrypt.Env.PipeIn(bytes.NewReader(pem.EncodeToMemory(&blk)))
+	decrypt.Env.PipeInFile("testdata/falling-grass.pem")
+	decrypt.Run()
+
+	eBuf, _ := decrypt.ErrStream()
+	assert.Contains(t, eBuf.String(), delphi.ErrBadHiddenSender.Error())
+	oBuf, _ := decrypt.OutStream()
+	assert.Empty(t, oBuf.String())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+)
+
+// export a key in a format other tools understand.
+// With a private key, that is the public key followed by the private key. With only a public key, it is just the public key.
+func (app *DelphiApp) export(env hermeti.Env) {
+
+	if app.opts.format != formatSSH && app.opts.format != formatAge {
+		fmt.Fprintf(env.ErrStream, "nothing to export as %q. Try --format %s or %s\n", app.opts.format, formatSSH, formatAge)
+		return
+	}
+
+	hasPriv := app.pluckPriv()
+	var pub delphi.Peer
+	switch {
+	case hasPriv:
+		pub = app.Self.PublicKey()
+	case app.privErr != nil:
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	case app.pems.Has(delphi.Pubkey):
+		if err := pub.UnmarshalPEM(*app.pems.Pluck(delphi.Pubkey)); err != nil {
+			fmt.Fprintln(env.ErrStream, err)
+			return
+		}
+	default:
+		fmt.Fprintln(env.ErrStream, "no key was passed in")
+		return
+	}
+
+	if app.opts.format == formatAge {
+		app.exportAge(env, pub, hasPriv)
+		return
+	}
+
+	line, err := pub.MarshalAuthorizedKey(pub.Nickname())
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if _, err := env.OutStream.Write(line); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if !hasPriv {
+		return
+	}
+
+	var sshPem pem.Block
+	if app.opts.protect {
+		var pass []byte
+		pass, err = app.passphrase("new ssh passphrase: ")
+		if err == nil {
+			sshPem, err = app.Self.MarshalProtectedSSH(app.Self.Nickname(), pass)
+		}
+	} else {
+		sshPem, err = app.Self.MarshalSSH(app.Self.Nickname())
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if err := pem.Encode(env.OutStream, &sshPem); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	fmt.Fprintf(env.ErrStream, "warning: the SSH key holds only the signing half of %s. Unless it came from SSH in the first place, importing it gives a different encryption key.\n", app.Self.Nickname())
+}
+
+// exportAge writes an age recipient, or with a private key, an age identity file such as age-keygen writes
+func (app *DelphiApp) exportAge(env hermeti.Env, pub delphi.Peer, hasPriv bool) {
+	var err error
+	switch {
+	case !hasPriv:
+		_, err = fmt.Fprintln(env.OutStream, pub.AgeRecipient())
+	case app.opts.protect:
+		fmt.Fprintln(env.ErrStream, "age identities can not be protected with a passphrase here")
+	default:
+		_, err = fmt.Fprintf(env.OutStream, "# %s\n# public key: %s\n%s\n", pub.Nickname(), pub.AgeRecipient(), app.Self.AgeIdentity())
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+)
+
+// a multiFlag is a flag that can be passed more than once
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *multiFlag) Set(val string) error {
+	*f = append(*f, val)
+	return nil
+}
+
+// options are the flags that may follow a subcommand
+type options struct {
+	stream         bool
+	keys           multiFlag
+	protect        bool
+	passphraseFile string
+	keyring        string
+	to             multiFlag
+	reason         string
+	lifetime       time.Duration
+	detached       bool
+	auth           bool
+	replayCache    string
+	challenge      string
+	format         string
+	compress       bool
+	pad            string
+	hideSender     bool
+	hideRecipient  bool
+	trial          bool
+}
+
+// parseFlags parses the args that follow the subcommand
+func (app *DelphiApp) parseFlags(env hermeti.Env) error {
+	fs := flag.NewFlagSet(app.subcommand, flag.ContinueOnError)
+	fs.SetOutput(env.ErrStream)
+	fs.BoolVar(&app.opts.stream, "stream", false, "read and write raw streams on stdin and stdout, instead of PEMs")
+	fs.Var(&app.opts.keys, "key", "read PEM encoded keys from `FILE`. May be repeated")
+	fs.BoolVar(&app.opts.protect, "protect", false, "protect the private key with a passphrase")
+	fs.StringVar(&app.opts.keyring, "keyring", "", "use the keyring at `PATH`, a file or a directory")
+	fs.Var(&app.opts.to, "to", "encrypt to the keyring entry matching `QUERY`, a nickname, fingerprint or key prefix. May be repeated")
+	fs.StringVar(&app.opts.reason, "reason", "", "why a key is being revoked: compromised, superseded, retired or unspecified")
+	fs.DurationVar(&app.opts.lifetime, "lifetime", 0, "how long a new key is valid for, such as 8760h. Zero means forever")
+	fs.BoolVar(&app.opts.detached, "detached", false, "sign or verify a file, with the signature kept apart from it")
+	fs.BoolVar(&app.opts.auth, "auth", false, "encrypt in authenticated mode, so that decrypting proves who the sender is")
+	fs.StringVar(&app.opts.replayCache, "replay-cache", "", "refuse messages already recorded in `FILE`, and record new ones")
+	fs.StringVar(&app.opts.challenge, "challenge", "", "answer, or check an answer to, the challenge in `FILE`")
+	fs.BoolVar(&app.opts.compress, "compress", false, "compress the message before encrypting it")
+	fs.StringVar(&app.opts.pad, "pad", "", "hide the length of the message by padding it, with `SCHEME` pow2 or bucket/SIZE")
+	fs.BoolVar(&app.opts.hideSender, "hide-sender", false, "send who the message is from inside the cipher text, signed, instead of in the clear")
+	fs.BoolVar(&app.opts.hideRecipient, "hide-recipient", false, "leave who the message is for off of it, so that only they can find it")
+	fs.BoolVar(&app.opts.trial, "trial", false, "try every private key on every message, and output the ones that open")
+	fs.StringVar(&app.opts.format, "format", formatPEM, "read and write messages as `pem`, json or age, or export keys as ssh or age")
+	fs.StringVar(&app.opts.passphraseFile, "passphrase-file", "", "read the passphrase from `FILE`")
+	app.opts.format = formatPEM
+	if len(env.Args) < 3 {
+		return nil
+	}
+
+	//	flags and positional args may be interleaved
+	rest := env.Args[2:]
+	for len(rest) > 0 {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		rest = fs.Args()
+		if len(rest) > 0 {
+			app.args = append(app.args, rest[0])
+			rest = rest[1:]
+		}
+	}
+	switch {
+	case app.opts.format == formatPEM, app.opts.format == formatJSON:
+	case app.opts.format == formatSSH && app.subcommand == "export":
+	case app.opts.format == formatAge && (app.subcommand == "export" || app.subcommand == "encrypt" || app.subcommand == "decrypt"):
+	default:
+		return fmt.Errorf("no format called %q. Try %s or %s", app.opts.format, formatPEM, formatJSON)
+	}
+	return nil
+}
+
+// loadKeyFiles puts all PEMs found in the files passed with --key into the [pemBag]
+func (app *DelphiApp) loadKeyFiles(env hermeti.Env) error {
+	for _, fpath := range app.opts.keys {
+		b, err := afero.ReadFile(env.Filesystem, fpath)
+		if err != nil {
+			return fmt.Errorf("could not read key file: %w", err)
+		}
+		thispem, remainder := readNextPem(b)
+		if thispem == nil {
+			return fmt.Errorf("no PEMs in %q", fpath)
+		}
+		for thispem != nil {
+			app.pems[delphi.Subject(thispem.Type)] = append(app.pems[delphi.Subject(thispem.Type)], *thispem)
+			thispem, remainder = readNextPem(remainder)
+		}
+	}
+	return nil
+}
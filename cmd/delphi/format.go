@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+)
+
+// the formats that messages may be read and written in
+const (
+	formatPEM  = "pem"
+	formatJSON = "json"
+	// keys may also be exported for OpenSSH
+	formatSSH = "ssh"
+	// keys may be exported for age, and files encrypted and decrypted in its format
+	formatAge = "age"
+)
+
+// readJSON moves JSON messages from the start of inBuff into the [pemBag]
+func (app *DelphiApp) readJSON() error {
+	dec := json.NewDecoder(app.inBuff)
+	for {
+		msg := new(delphi.Message)
+		err := dec.Decode(msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		p, err := msg.ToPEM()
+		if err != nil {
+			return err
+		}
+		app.pems[msg.Subject] = append(app.pems[msg.Subject], p)
+	}
+	app.inBuff = bytes.NewBuffer(nil)
+	return nil
+}
+
+// emit writes a message to stdout, as a PEM, or as JSON with --format json
+func (app *DelphiApp) emit(env hermeti.Env, msg *delphi.Message) {
+	if app.opts.format != formatJSON {
+		p, err := msg.ToPEM()
+		if err != nil {
+			fmt.Fprintln(env.ErrStream, err)
+			return
+		}
+		fmt.Fprintln(env.OutStream, string(pem.EncodeToMemory(&p)))
+		return
+	}
+	if err := json.NewEncoder(env.OutStream).Encode(msg); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+	}
+}
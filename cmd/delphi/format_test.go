@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat_JSON(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat falling-grass.pub.pem bitter-frost.pem fortune_feynman.pem | delphi encrypt --format json
+	encrypt := hermeti.NewTestCli(new(DelphiApp))
+	encrypt.Env.Args = []string{"delphi", "encrypt", "--format", "json"}
+	encrypt.Env.Randomness = rand.Reader
+	encrypt.Env.Mount(subfs, "./testdata")
+	encrypt.Env.PipeInFiles("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+	encrypt.Run()
+
+	out, _ := encrypt.OutStream()
+	msg := new(delphi.Message)
+	assert.NoError(t, json.Unmarshal(out.Bytes(), msg))
+	assert.Equal(t, delphi.EncryptedMessage, msg.Subject)
+
+	//	cat falling-grass.pem message.json | delphi decrypt --format json
+	decrypt := hermeti.NewTestCli(new(DelphiApp))
+	decrypt.Env.Args = []string{"delphi", "decrypt", "--format", "json"}
+	decrypt.Env.Mount(subfs, "./testdata")
+	decrypt.Env.PipeInFile("testdata/falling-grass.pem")
+	decrypt.Env.PipeIn(bytes.NewReader(out.Bytes()))
+	decrypt.Run()
+
+	eBuf, _ := decrypt.ErrStream()
+	assert.Empty(t, eBuf.String())
+	out, _ = decrypt.OutStream()
+	assert.NoError(t, json.Unmarshal(out.Bytes(), msg))
+	assert.Equal(t, delphi.PlainMessage, msg.Subject)
+	assert.NotEmpty(t, msg.PlainText)
+
+	//	delphi pub --format json
+	pub := hermeti.NewTestCli(new(DelphiApp))
+	pub.Env.Args = []string{"delphi", "pub", "--format", "json"}
+	pub.Env.Mount(subfs, "./testdata")
+	pub.Env.PipeInFile("testdata/bitter-frost.pem")
+	pub.Run()
+	out, _ = pub.OutStream()
+	var k delphi.Key
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &k))
+	assert.Equal(t, "bitter-frost", k.Nickname())
+
+	//	unknown formats are refused
+	bad := hermeti.NewTestCli(new(DelphiApp))
+	bad.Env.Args = []string{"delphi", "pub", "--format", "yaml"}
+	bad.Run()
+	eBuf, _ = bad.ErrStream()
+	assert.Contains(t, eBuf.String(), "yaml")
+
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+)
+
+// the PEM type of an OpenSSH private key
+const sshPrivkey delphi.Subject = "OPENSSH PRIVATE KEY"
+
+// import an OpenSSH ed25519 private key, and output it as a delphi private key
+func (app *DelphiApp) importKey(env hermeti.Env) {
+
+	sshPem := app.pems.Pluck(sshPrivkey)
+	if sshPem == nil {
+		fmt.Fprintln(env.ErrStream, "no OpenSSH private key was passed in")
+		return
+	}
+	sshBytes := pem.EncodeToMemory(sshPem)
+
+	p, err := delphi.PrincipalFromSSH(sshBytes, nil)
+	if errors.Is(err, delphi.ErrPassphraseRequired) {
+		var pass []byte
+		pass, err = app.passphrase("ssh passphrase: ")
+		if err == nil {
+			p, err = delphi.PrincipalFromSSH(sshBytes, pass)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	var pemFile pem.Block
+	if app.opts.protect {
+		var pass []byte
+		pass, err = app.passphrase("new passphrase: ")
+		if err == nil {
+			pemFile, err = p.MarshalProtectedPEM(env.Randomness, pass)
+		}
+	} else {
+		pemFile, err = p.MarshalPEM()
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	app.Self = p
+	pem.Encode(env.OutStream, &pemFile)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+)
+
+// KeyringVar is the environment variable that may hold the path to the keyring
+const KeyringVar = "DELPHI_KEYRING"
+
+var ErrNoKeyring = errors.New("no keyring")
+
+// keyringPath is --keyring, or $DELPHI_KEYRING, or a file under $HOME
+func (app *DelphiApp) keyringPath(env hermeti.Env) (string, error) {
+	if app.opts.keyring != "" {
+		return app.opts.keyring, nil
+	}
+	if path, ok := env.Vars[KeyringVar]; ok && path != "" {
+		return path, nil
+	}
+	if home, ok := env.Vars["HOME"]; ok && home != "" {
+		return filepath.Join(home, ".config", "delphi", "keyring.pem"), nil
+	}
+	return "", ErrNoKeyring
+}
+
+// openKeyring opens the keyring
+func (app *DelphiApp) openKeyring(env hermeti.Env) (*delphi.Keyring, error) {
+	path, err := app.keyringPath(env)
+	if err != nil {
+		return nil, err
+	}
+	return delphi.OpenKeyring(env.Filesystem, path)
+}
+
+// keys manages the keyring. Usage: delphi keys add|list|rm|show [query]
+func (app *DelphiApp) keys(env hermeti.Env) {
+
+	if len(app.args) == 0 {
+		fmt.Fprintln(env.ErrStream, "usage: delphi keys add|list|rm|show")
+		return
+	}
+
+	kr, err := app.openKeyring(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	switch action := app.args[0]; action {
+	case "add":
+		//	public keys, and also certifications, revocations and subkeys
+		added := 0
+		for _, subj := range []delphi.Subject{delphi.Pubkey, delphi.KeyCertification, delphi.KeyRevocation, delphi.PublicSubkey} {
+			for p := app.pems.Pluck(subj); p != nil; p = app.pems.Pluck(subj) {
+				if err := kr.Import(pem.EncodeToMemory(p)); err != nil {
+					fmt.Fprintln(env.ErrStream, err)
+					return
+				}
+				if subj == delphi.Pubkey {
+					fmt.Fprintln(env.OutStream, delphi.KeyFromBytes(p.Bytes).Nickname())
+				} else {
+					fmt.Fprintln(env.OutStream, subj)
+				}
+				added++
+			}
+		}
+		if added == 0 {
+			fmt.Fprintln(env.ErrStream, "nothing to add")
+			return
+		}
+	case "list":
+		for _, peer := range kr.List() {
+			status := ""
+			if rev, revoked := kr.Revoked(peer); revoked {
+				status = fmt.Sprintf("\trevoked (%s)", rev.Reason)
+			}
+			fmt.Fprintf(env.OutStream, "%s\t%s%s\n", peer.Nickname(), peer.Fingerprint(), status)
+		}
+		return
+	case "rm", "show":
+		if len(app.args) < 2 {
+			fmt.Fprintf(env.ErrStream, "usage: delphi keys %s <nickname|fingerprint|prefix>\n", action)
+			return
+		}
+		peer, err := kr.Lookup(app.args[1])
+		if err != nil {
+			fmt.Fprintln(env.ErrStream, err)
+			return
+		}
+		if action == "show" {
+			blk, _ := peer.MarshalPEM()
+			pem.Encode(env.OutStream, &blk)
+			return
+		}
+		if err := kr.Remove(peer); err != nil {
+			fmt.Fprintln(env.ErrStream, err)
+			return
+		}
+		fmt.Fprintln(env.OutStream, peer.Nickname())
+	default:
+		fmt.Fprintf(env.ErrStream, "no keys action called %q\n", action)
+		return
+	}
+
+	if err := kr.Save(); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+	}
+}
+
+// lookupRecipients finds the Peers passed in with --to, in the keyring
+func (app *DelphiApp) lookupRecipients(env hermeti.Env) ([]delphi.Key, error) {
+	if len(app.opts.to) == 0 {
+		return nil, nil
+	}
+	kr, err := app.openKeyring(env)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]delphi.Key, 0, len(app.opts.to))
+	for _, query := range app.opts.to {
+		peer, err := kr.Lookup(query)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := kr.Validity(peer); ok {
+			if err := v.ValidAt(time.Now()); err != nil {
+				return nil, fmt.Errorf("%s: %w", peer.Nickname(), err)
+			}
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys(t *testing.T) {
+
+	//	all runs share one filesystem, which holds the keyring
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	fsys := afero.NewMemMapFs()
+
+	run := func(args ...string) (string, string) {
+		cli := hermeti.NewTestCli(new(DelphiApp))
+		cli.Env.Filesystem = fsys
+		cli.Env.Mount(subfs, "./testdata")
+		cli.Env.Randomness = rand.Reader
+		cli.Env.Vars["HOME"] = "/home/delphi"
+		cli.Env.Args = append([]string{"delphi"}, args...)
+		if args[0] == "keys" && args[1] == "add" {
+			cli.Env.PipeInFiles("testdata/falling-grass.pub.pem", "testdata/bitter-frost.pub.pem")
+		}
+		if args[0] == "encrypt" {
+			cli.Env.PipeInFiles("testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+		}
+		cli.Run()
+		o, _ := cli.OutStream()
+		e, _ := cli.ErrStream()
+		return o.String(), e.String()
+	}
+
+	out, errs := run("keys", "add")
+	assert.Empty(t, errs)
+	assert.Contains(t, out, "falling-grass")
+	exists, _ := afero.Exists(fsys, "/home/delphi/.config/delphi/keyring.pem")
+	assert.True(t, exists)
+
+	out, _ = run("keys", "list")
+	assert.Contains(t, out, "bitter-frost")
+	assert.Contains(t, out, "falling-grass")
+
+	out, _ = run("keys", "show", "falling-grass")
+	p, _ := pem.Decode([]byte(out))
+	assert.NotNil(t, p)
+	assert.Equal(t, string(delphi.Pubkey), p.Type)
+
+	t.Run("encrypt --to", func(t *testing.T) {
+		out, errs := run("encrypt", "--to", "falling-grass")
+		assert.Empty(t, errs)
+		p, _ := pem.Decode([]byte(out))
+		msg := new(delphi.Message)
+		msg.FromPEM(*p)
+		assert.Equal(t, "falling-grass", msg.RecipientKey.Nickname())
+
+		_, errs = run("encrypt", "--to", "nobody-at-all")
+		assert.Contains(t, errs, delphi.ErrNotFound.Error())
+	})
+
+	out, _ = run("keys", "rm", "bitter-frost")
+	assert.Contains(t, out, "bitter-frost")
+	out, _ = run("keys", "list", "--keyring", "/home/delphi/.config/delphi/keyring.pem")
+	assert.NotContains(t, out, "bitter-frost")
+	assert.Contains(t, out, "falling-grass")
+
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+	"golang.org/x/term"
+)
+
+// PassphraseVar is the environment variable a passphrase may be passed in
+const PassphraseVar = "DELPHI_PASSPHRASE"
+
+var ErrNoPassphrase = errors.New("no passphrase")
+
+// passphraseSource returns a function that finds a passphrase in, in order of preference:
+// the file passed with --passphrase-file, the DELPHI_PASSPHRASE environment variable, or the terminal.
+func (app *DelphiApp) passphraseSource(env hermeti.Env) func(prompt string) ([]byte, error) {
+	return func(prompt string) ([]byte, error) {
+		if app.opts.passphraseFile != "" {
+			b, err := afero.ReadFile(env.Filesystem, app.opts.passphraseFile)
+			if err != nil {
+				return nil, fmt.Errorf("could not read passphrase file: %w", err)
+			}
+			return bytes.TrimRight(b, "\r\n"), nil
+		}
+		if pass, ok := env.Vars[PassphraseVar]; ok {
+			return []byte(pass), nil
+		}
+		return promptPassphrase(prompt)
+	}
+}
+
+// promptPassphrase reads a passphrase from the controlling terminal, since stdin is usually taken by PEMs.
+func promptPassphrase(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoPassphrase, err)
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	pass, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoPassphrase, err)
+	}
+	return pass, nil
+}
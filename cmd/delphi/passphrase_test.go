@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtect(t *testing.T) {
+
+	//	delphi create --protect
+	create := hermeti.NewTestCli(new(DelphiApp))
+	create.Env.Args = []string{"delphi", "create", "--protect"}
+	create.Env.Randomness = deterministicRand{}
+	create.Env.Vars[PassphraseVar] = "open sesame"
+	create.Run()
+
+	privPem, err := create.OutStream()
+	assert.NoError(t, err)
+	assert.Contains(t, privPem.String(), "delphi/kdf: scrypt")
+	assert.Contains(t, privPem.String(), string(delphi.Privkey))
+
+	t.Run("right passphrase", func(t *testing.T) {
+		app := new(DelphiApp)
+		nick := hermeti.NewTestCli(app)
+		nick.Env.Args = []string{"delphi", "nick"}
+		nick.Env.Vars[PassphraseVar] = "open sesame"
+		nick.Env.PipeIn(bytes.NewReader(privPem.Bytes()))
+		nick.Run()
+
+		out, _ := nick.OutStream()
+		assert.Equal(t, "falling-dawn\n", out.String())
+	})
+
+	t.Run("passphrase from a file", func(t *testing.T) {
+		app := new(DelphiApp)
+		nick := hermeti.NewTestCli(app)
+		nick.Env.Args = []string{"delphi", "nick", "--passphrase-file", "pass.txt"}
+		f, _ := nick.Env.Filesystem.Create("pass.txt")
+		f.WriteString("open sesame\n")
+		f.Close()
+		nick.Env.PipeIn(bytes.NewReader(privPem.Bytes()))
+		nick.Run()
+
+		out, _ := nick.OutStream()
+		assert.Equal(t, "falling-dawn\n", out.String())
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		sign := hermeti.NewTestCli(new(DelphiApp))
+		sign.Env.Args = []string{"delphi", "assert"}
+		sign.Env.Vars[PassphraseVar] = "open says me"
+		sign.Env.PipeIn(bytes.NewReader(privPem.Bytes()))
+		sign.Run()
+
+		errs, _ := sign.ErrStream()
+		assert.Contains(t, errs.String(), delphi.ErrBadPassphrase.Error())
+	})
+
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 
@@ -17,6 +18,13 @@ func (app *DelphiApp) pub(env hermeti.Env) {
 
 	pubkey := app.Self.PublicKey()
 
+	if app.opts.format == formatJSON {
+		if err := json.NewEncoder(env.OutStream).Encode(pubkey); err != nil {
+			fmt.Fprintln(env.ErrStream, err)
+		}
+		return
+	}
+
 	p := pem.Block{
 		Type: string(delphi.Pubkey),
 		Headers: map[string]string{
@@ -24,6 +32,9 @@ func (app *DelphiApp) pub(env hermeti.Env) {
 		},
 		Bytes: pubkey.Bytes(),
 	}
+	if app.selfValidity != nil {
+		app.selfValidity.SetHeaders(p.Headers)
+	}
 
 	err := pem.Encode(env.OutStream, &p)
 	if err != nil {
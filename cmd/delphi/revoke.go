@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+)
+
+// revoke outputs a signed revocation of the private key passed in
+func (app *DelphiApp) revoke(env hermeti.Env) {
+
+	if !app.pluckPriv() {
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	}
+
+	msg, err := app.Self.Revoke(env.Randomness, app.opts.reason)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	app.emit(env, msg)
+}
+
+// revocations gathers revocations passed in on stdin, and those in the keyring, if there is one
+func (app *DelphiApp) revocations(env hermeti.Env) ([]delphi.Revocation, error) {
+	revs := make([]delphi.Revocation, 0)
+	for p := app.pems.Pluck(delphi.KeyRevocation); p != nil; p = app.pems.Pluck(delphi.KeyRevocation) {
+		msg := new(delphi.Message)
+		if err := msg.FromPEM(*p); err != nil {
+			return nil, err
+		}
+		rev, err := delphi.ParseRevocation(msg)
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	if _, err := app.keyringPath(env); err != nil {
+		return revs, nil
+	}
+	kr, err := app.openKeyring(env)
+	if err != nil {
+		return nil, err
+	}
+	return append(revs, kr.Revocations()...), nil
+}
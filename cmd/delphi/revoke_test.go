@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevoke(t *testing.T) {
+
+	subFs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat bitter-frost.pem | delphi revoke --reason compromised
+	revoke := hermeti.NewTestCli(new(DelphiApp))
+	revoke.Env.Args = []string{"delphi", "revoke", "--reason", delphi.ReasonCompromised}
+	revoke.Env.Randomness = rand.Reader
+	revoke.Env.Mount(subFs, "./testdata")
+	revoke.Env.PipeInFile("./testdata/bitter-frost.pem")
+	revoke.Run()
+
+	revPem, _ := revoke.OutStream()
+	assert.Contains(t, revPem.String(), string(delphi.KeyRevocation))
+	assert.Contains(t, revPem.String(), delphi.ReasonCompromised)
+
+	//	cat fortune_signed.pem revocation.pem | delphi verify
+	verify := hermeti.NewTestCli(new(DelphiApp))
+	verify.Env.Args = []string{"delphi", "verify"}
+	verify.Env.Mount(subFs, "./testdata")
+	verify.Env.PipeInFile("./testdata/fortune_signed.pem")
+	verify.Env.PipeIn(bytes.NewReader(revPem.Bytes()))
+	verify.Run()
+
+	eBuf, _ := verify.ErrStream()
+	assert.Contains(t, eBuf.String(), delphi.ErrRevoked.Error())
+	oBuf, _ := verify.OutStream()
+	assert.NotContains(t, oBuf.String(), "ok")
+
+}
+
+func TestRevoke_UnknownReason(t *testing.T) {
+
+	subFs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat bitter-frost.pem | delphi revoke --reason Compromised
+	revoke := hermeti.NewTestCli(new(DelphiApp))
+	revoke.Env.Args = []string{"delphi", "revoke", "--reason", "Compromised"}
+	revoke.Env.Randomness = rand.Reader
+	revoke.Env.Mount(subFs, "./testdata")
+	revoke.Env.PipeInFile("./testdata/bitter-frost.pem")
+	revoke.Run()
+
+	eBuf, _ := revoke.ErrStream()
+	assert.Contains(t, eBuf.String(), delphi.ErrBadRevocation.Error())
+	oBuf, _ := revoke.OutStream()
+	assert.Empty(t, oBuf.String())
+}
@@ -28,7 +28,12 @@ func (app *DelphiApp) sign(env hermeti.Env) {
 	//	self
 	hasPriv := app.pluckPriv()
 	if !hasPriv {
-		fmt.Fprintln(env.ErrStream, ErrNoPrivKey)
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	}
+
+	if app.opts.detached {
+		app.signDetached(env)
 		return
 	}
 
@@ -48,6 +53,30 @@ func (app *DelphiApp) sign(env hermeti.Env) {
 		fmt.Fprintln(env.ErrStream, err)
 		return
 	}
-	fmt.Fprintln(env.OutStream, msg)
+	app.emit(env, msg)
+
+}
+
+// signDetached signs a file without embedding it. Usage: delphi sign --detached FILE
+func (app *DelphiApp) signDetached(env hermeti.Env) {
+
+	if len(app.args) != 1 {
+		fmt.Fprintln(env.ErrStream, "usage: delphi sign --detached FILE")
+		return
+	}
+
+	f, err := env.Filesystem.Open(app.args[0])
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	defer f.Close()
+
+	msg, err := app.Self.SignDetached(env.Randomness, f, "")
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	app.emit(env, msg)
 
 }
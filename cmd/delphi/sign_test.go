@@ -49,3 +49,42 @@ func TestSign(t *testing.T) {
 	assert.NotNil(t, msg.Sig)
 
 }
+
+func TestSign_Detached(t *testing.T) {
+
+	subFs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat bitter-frost.pem | delphi sign --detached testdata/fortune.txt
+	sign := hermeti.NewTestCli(new(DelphiApp))
+	sign.Env.Args = []string{"delphi", "sign", "--detached", "./testdata/fortune.txt"}
+	sign.Env.Randomness = rand.Reader
+	sign.Env.Mount(subFs, "./testdata")
+	sign.Env.PipeInFile("./testdata/bitter-frost.pem")
+	sign.Run()
+
+	sigPem, _ := sign.OutStream()
+	assert.Contains(t, sigPem.String(), string(delphi.DetachedSignature))
+	assert.Contains(t, sigPem.String(), "delphi/hash: sha256")
+
+	verify := func(file string) (string, string) {
+		cli := hermeti.NewTestCli(new(DelphiApp))
+		cli.Env.Args = []string{"delphi", "verify", "--detached", file, "./fortune.txt.sig"}
+		cli.Env.Mount(subFs, "./testdata")
+		afero.WriteFile(cli.Env.Filesystem, "./fortune.txt.sig", sigPem.Bytes(), 0600)
+		afero.WriteFile(cli.Env.Filesystem, "./forged.txt", []byte("a forgery"), 0600)
+		cli.Run()
+		oBuf, _ := cli.OutStream()
+		eBuf, _ := cli.ErrStream()
+		return oBuf.String(), eBuf.String()
+	}
+
+	//	delphi verify --detached testdata/fortune.txt fortune.txt.sig
+	out, errs := verify("./testdata/fortune.txt")
+	assert.Empty(t, errs)
+	assert.Contains(t, out, "ok")
+
+	out, errs = verify("./forged.txt")
+	assert.Contains(t, errs, delphi.ErrDigestMismatch.Error())
+	assert.NotContains(t, out, "ok")
+
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sean9999/hermeti"
+)
+
+// encryptStream encrypts stdin to stdout, chunk by chunk, without holding it all in memory.
+// Keys must be passed in with --key, because stdin is the payload.
+func (app *DelphiApp) encryptStream(env hermeti.Env) {
+
+	if !app.pluckPriv() {
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	}
+
+	recipients, _, err := app.PluckRecipients(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	known, err := app.lookupRecipients(env)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	recipients = append(recipients, known...)
+	if len(recipients) == 0 {
+		fmt.Fprintln(env.ErrStream, ErrNoRecipient)
+		return
+	}
+	if len(recipients) > 1 {
+		fmt.Fprintln(env.ErrStream, errors.New("--stream needs exactly one recipient"))
+		return
+	}
+	recipient := recipients[0]
+
+	w, err := app.Self.EncryptWriter(env.Randomness, env.OutStream, recipient)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if _, err := io.Copy(w, env.InStream); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+	}
+}
+
+// decryptStream decrypts stdin to stdout, chunk by chunk.
+func (app *DelphiApp) decryptStream(env hermeti.Env) {
+
+	if !app.pluckPriv() {
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	}
+
+	r, _, err := app.Self.DecryptReader(env.InStream)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	if _, err := io.Copy(env.OutStream, r); err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+	}
+}
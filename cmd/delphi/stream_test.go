@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	plain := bytes.Repeat([]byte("all work and no play makes jack a dull boy\n"), 5000)
+
+	//	delphi encrypt --stream --key bitter-frost.pem --key falling-grass.pub.pem < plain
+	enc := hermeti.NewTestCli(new(DelphiApp))
+	enc.Env.Args = []string{"delphi", "encrypt", "--stream", "--key", "testdata/bitter-frost.pem", "--key", "testdata/falling-grass.pub.pem"}
+	enc.Env.Randomness = rand.Reader
+	enc.Env.Mount(subfs, "./testdata")
+	enc.Env.InStream = bytes.NewReader(plain)
+	enc.Run()
+
+	eBuf, _ := enc.ErrStream()
+	assert.Equal(t, 0, eBuf.Len(), eBuf.String())
+	ciph, err := enc.OutStream()
+	assert.NoError(t, err)
+	assert.Greater(t, ciph.Len(), len(plain))
+
+	//	delphi decrypt --stream --key falling-grass.pem < ciph
+	dec := hermeti.NewTestCli(new(DelphiApp))
+	dec.Env.Args = []string{"delphi", "decrypt", "--stream", "--key", "testdata/falling-grass.pem"}
+	dec.Env.Mount(subfs, "./testdata")
+	dec.Env.InStream = ciph
+	dec.Run()
+
+	eBuf, _ = dec.ErrStream()
+	assert.Equal(t, 0, eBuf.Len(), eBuf.String())
+	got, err := dec.OutStream()
+	assert.NoError(t, err)
+	assert.Equal(t, plain, got.Bytes())
+
+	t.Run("one recipient only", func(t *testing.T) {
+		//	delphi encrypt --stream --key bitter-frost.pem --key falling-grass.pub.pem --key bitter-frost.pub.pem < plain
+		enc := hermeti.NewTestCli(new(DelphiApp))
+		enc.Env.Args = []string{"delphi", "encrypt", "--stream", "--key", "testdata/bitter-frost.pem", "--key", "testdata/falling-grass.pub.pem", "--key", "testdata/bitter-frost.pub.pem"}
+		enc.Env.Randomness = rand.Reader
+		enc.Env.Mount(subfs, "./testdata")
+		enc.Env.InStream = bytes.NewReader(plain)
+		enc.Run()
+
+		eBuf, _ := enc.ErrStream()
+		assert.Contains(t, eBuf.String(), "--stream needs exactly one recipient")
+		out, _ := enc.OutStream()
+		assert.Zero(t, out.Len())
+	})
+
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+)
+
+// subkey outputs a new encryption subkey, certified by the private key passed in.
+// The private subkey comes first. Keep it, even after it expires. Publish the public one.
+func (app *DelphiApp) subkey(env hermeti.Env) {
+
+	if !app.pluckPriv() {
+		fmt.Fprintln(env.ErrStream, app.privError())
+		return
+	}
+
+	sp, err := app.Self.NewSubkey(env.Randomness, app.opts.lifetime)
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+
+	var priv pem.Block
+	if app.opts.protect {
+		var pass []byte
+		pass, err = app.passphrase("new subkey passphrase: ")
+		if err == nil {
+			priv, err = sp.MarshalProtectedPEM(env.Randomness, pass)
+		}
+	} else {
+		priv, err = sp.MarshalPEM()
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	pub, err := sp.Subkey.MarshalPEM()
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	pem.Encode(env.OutStream, &priv)
+	pem.Encode(env.OutStream, &pub)
+}
+
+// newestSubkey finds the newest valid subkey of peer, among those passed in on stdin and those in the keyring.
+// It returns false if there is none.
+func (app *DelphiApp) newestSubkey(env hermeti.Env, peer delphi.Peer) (delphi.Subkey, bool, error) {
+	subkeys := make([]delphi.Subkey, 0)
+	for p := app.pems.Pluck(delphi.PublicSubkey); p != nil; p = app.pems.Pluck(delphi.PublicSubkey) {
+		var sk delphi.Subkey
+		if err := sk.UnmarshalPEM(*p); err != nil {
+			return delphi.Subkey{}, false, err
+		}
+		subkeys = append(subkeys, sk)
+	}
+	if _, err := app.keyringPath(env); err == nil {
+		kr, err := app.openKeyring(env)
+		if err != nil {
+			return delphi.Subkey{}, false, err
+		}
+		subkeys = append(subkeys, kr.Subkeys(peer)...)
+	}
+	sk, err := delphi.NewestSubkey(peer, subkeys, time.Now())
+	if errors.Is(err, delphi.ErrNoSubkey) {
+		return delphi.Subkey{}, false, nil
+	}
+	if err != nil {
+		return delphi.Subkey{}, false, err
+	}
+	return sk, true, nil
+}
+
+// keychain is the private key passed in, along with those of subkeys that belong to it
+func (app *DelphiApp) keychain(subkeys []delphi.SubkeyPair) delphi.Keychain {
+	kc := delphi.Keychain{Principal: app.Self}
+	for _, sp := range subkeys {
+		if sp.Identity.Equal(app.Self.PublicKey()) {
+			kc.Subkeys = append(kc.Subkeys, sp)
+		}
+	}
+	return kc
+}
+
+// privateSubkeys plucks all the private subkeys passed in
+func (app *DelphiApp) privateSubkeys() ([]delphi.SubkeyPair, error) {
+	subkeys := make([]delphi.SubkeyPair, 0)
+	for p := app.pems.Pluck(delphi.PrivateSubkey); p != nil; p = app.pems.Pluck(delphi.PrivateSubkey) {
+		var sp delphi.SubkeyPair
+		var err error
+		if delphi.IsProtectedPEM(*p) {
+			var pass []byte
+			pass, err = app.passphrase("subkey passphrase: ")
+			if err == nil {
+				err = sp.UnmarshalProtectedPEM(*p, pass)
+			}
+		} else {
+			err = sp.UnmarshalPEM(*p)
+		}
+		if err != nil {
+			return nil, err
+		}
+		subkeys = append(subkeys, sp)
+	}
+	return subkeys, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubkey(t *testing.T) {
+
+	subFs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+
+	//	cat bitter-frost.pem | delphi subkey --lifetime 720h
+	subkey := hermeti.NewTestCli(new(DelphiApp))
+	subkey.Env.Args = []string{"delphi", "subkey", "--lifetime", "720h"}
+	subkey.Env.Randomness = rand.Reader
+	subkey.Env.Mount(subFs, "./testdata")
+	subkey.Env.PipeInFile("./testdata/bitter-frost.pem")
+	subkey.Run()
+
+	subPems, _ := subkey.OutStream()
+	privSub, pubSub, _ := bytes.Cut(subPems.Bytes(), []byte("-----BEGIN "+delphi.PublicSubkey))
+	pubSub = append([]byte("-----BEGIN "+delphi.PublicSubkey), pubSub...)
+	assert.Contains(t, string(privSub), string(delphi.PrivateSubkey))
+
+	//	cat subkey.pub.pem bitter-frost.pub.pem fortune_feynman.pem | delphi encrypt --key someone.pem
+	//	picks the subkey
+	encrypt := hermeti.NewTestCli(new(DelphiApp))
+	encrypt.Env.Args = []string{"delphi", "encrypt", "--key", "./testdata/bitter-frost.pem"}
+	encrypt.Env.Randomness = rand.Reader
+	encrypt.Env.Mount(subFs, "./testdata")
+	encrypt.Env.PipeIn(bytes.NewReader(pubSub))
+	encrypt.Env.PipeInFiles("./testdata/bitter-frost.pub.pem", "./testdata/fortune_feynman.pem")
+	encrypt.Run()
+
+	cipherPem, _ := encrypt.OutStream()
+	eBuf, _ := encrypt.ErrStream()
+	assert.Empty(t, eBuf.String())
+	assert.Contains(t, cipherPem.String(), "delphi/subkey")
+
+	//	the private key alone cannot decrypt it
+	decrypt := hermeti.NewTestCli(new(DelphiApp))
+	decrypt.Env.Args = []string{"delphi", "decrypt"}
+	decrypt.Env.Mount(subFs, "./testdata")
+	decrypt.Env.PipeIn(bytes.NewReader(cipherPem.Bytes()))
+	decrypt.Env.PipeInFile("./testdata/bitter-frost.pem")
+	decrypt.Run()
+	eBuf, _ = decrypt.ErrStream()
+	assert.Contains(t, eBuf.String(), delphi.ErrNoSubkey.Error())
+
+	//	along with the private subkey, it can
+	decrypt = hermeti.NewTestCli(new(DelphiApp))
+	decrypt.Env.Args = []string{"delphi", "decrypt"}
+	decrypt.Env.Mount(subFs, "./testdata")
+	decrypt.Env.PipeIn(bytes.NewReader(cipherPem.Bytes()))
+	decrypt.Env.PipeIn(bytes.NewReader(privSub))
+	decrypt.Env.PipeInFile("./testdata/bitter-frost.pem")
+	decrypt.Run()
+	plainPem, _ := decrypt.OutStream()
+	eBuf, _ = decrypt.ErrStream()
+	assert.Empty(t, eBuf.String())
+	assert.Contains(t, plainPem.String(), string(delphi.PlainMessage))
+
+	//	with --trial, the subkey reaches the private key it belongs to, even when that is not the first one
+	t.Run("trial", func(t *testing.T) {
+		encrypt := hermeti.NewTestCli(new(DelphiApp))
+		encrypt.Env.Args = []string{"delphi", "encrypt", "--hide-recipient", "--key", "./testdata/bitter-frost.pem"}
+		encrypt.Env.Randomness = rand.Reader
+		encrypt.Env.Mount(subFs, "./testdata")
+		encrypt.Env.PipeIn(bytes.NewReader(pubSub))
+		encrypt.Env.PipeInFiles("./testdata/bitter-frost.pub.pem", "./testdata/fortune_feynman.pem")
+		encrypt.Run()
+		hidden, _ := encrypt.OutStream()
+		assert.NotContains(t, hidden.String(), "delphi/subkey")
+
+		decrypt := hermeti.NewTestCli(new(DelphiApp))
+		decrypt.Env.Args = []string{"delphi", "decrypt", "--trial"}
+		decrypt.Env.Mount(subFs, "./testdata")
+		decrypt.Env.PipeIn(bytes.NewReader(hidden.Bytes()))
+		decrypt.Env.PipeIn(bytes.NewReader(privSub))
+		decrypt.Env.PipeInFiles("./testdata/falling-grass.pem", "./testdata/bitter-frost.pem")
+		decrypt.Run()
+		eBuf, _ := decrypt.ErrStream()
+		assert.Empty(t, eBuf.String())
+		trialPem, _ := decrypt.OutStream()
+		got, _ := pem.Decode(trialPem.Bytes())
+		want, _ := pem.Decode(plainPem.Bytes())
+		if assert.NotNil(t, got) && assert.NotNil(t, want) {
+			assert.Equal(t, string(delphi.PlainMessage), got.Type)
+			assert.Equal(t, want.Headers["to"], got.Headers["to"])
+		}
+	})
+
+	//	cat bitter-frost.pem | delphi subkey --protect
+	t.Run("protect", func(t *testing.T) {
+		subkey := hermeti.NewTestCli(new(DelphiApp))
+		subkey.Env.Args = []string{"delphi", "subkey", "--protect"}
+		subkey.Env.Randomness = rand.Reader
+		subkey.Env.Vars[PassphraseVar] = "open sesame"
+		subkey.Env.Mount(subFs, "./testdata")
+		subkey.Env.PipeInFile("./testdata/bitter-frost.pem")
+		subkey.Run()
+		eBuf, _ := subkey.ErrStream()
+		assert.Empty(t, eBuf.String())
+		subPems, _ := subkey.OutStream()
+		privSub, _, _ := bytes.Cut(subPems.Bytes(), []byte("-----BEGIN "+delphi.PublicSubkey))
+		blk, _ := pem.Decode(privSub)
+		assert.NotNil(t, blk)
+		assert.True(t, delphi.IsProtectedPEM(*blk))
+		var sp delphi.SubkeyPair
+		assert.NoError(t, sp.UnmarshalProtectedPEM(*blk, []byte("open sesame")))
+	})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/sean9999/go-delphi"
 )
@@ -15,12 +16,33 @@ func (app *DelphiApp) pluckPriv() bool {
 	}
 
 	self := new(delphi.Principal)
-	err := self.UnmarshalPEM(*selfPem)
+	var err error
+	if delphi.IsProtectedPEM(*selfPem) {
+		var pass []byte
+		pass, err = app.passphrase("passphrase: ")
+		if err == nil {
+			err = self.UnmarshalProtectedPEM(*selfPem, pass)
+		}
+	} else {
+		err = self.UnmarshalPEM(*selfPem)
+	}
+	if err == nil {
+		app.selfValidity, err = delphi.ValidityFromHeaders(selfPem.Headers)
+	}
 	if err != nil {
+		app.privErr = err
 		return false
 	}
 	app.Self = *self
 	return true
 }
 
+// privError explains why pluckPriv came up empty
+func (app *DelphiApp) privError() error {
+	if app.privErr != nil {
+		return fmt.Errorf("%w: %w", ErrNoPrivKey, app.privErr)
+	}
+	return ErrNoPrivKey
+}
+
 var ErrNoRecipient = errors.New("no recipient")
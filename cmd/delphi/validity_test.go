@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/sean9999/go-delphi"
+	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifetime(t *testing.T) {
+
+	//	delphi create --lifetime 24h
+	create := hermeti.NewTestCli(new(DelphiApp))
+	create.Env.Args = []string{"delphi", "create", "--lifetime", "24h"}
+	create.Env.Randomness = rand.Reader
+	create.Run()
+	privPem, _ := create.OutStream()
+	assert.Contains(t, privPem.String(), "delphi/not-after")
+
+	//	delphi pub keeps the validity period
+	pub := hermeti.NewTestCli(new(DelphiApp))
+	pub.Env.Args = []string{"delphi", "pub"}
+	pub.Env.PipeIn(bytes.NewReader(privPem.Bytes()))
+	pub.Run()
+	pubPem, _ := pub.OutStream()
+	p, _ := pem.Decode(pubPem.Bytes())
+	assert.NotNil(t, p)
+	v, err := delphi.ValidityFromHeaders(p.Headers)
+	assert.NoError(t, err)
+	assert.NotNil(t, v)
+	assert.NoError(t, v.Check(delphi.KeyFromBytes(p.Bytes), time.Now()))
+	assert.ErrorIs(t, v.ValidAt(time.Now().Add(25*time.Hour)), delphi.ErrExpired)
+
+}
+
+func TestEncrypt_ExpiredRecipient(t *testing.T) {
+
+	//	a recipient whose key expired last year
+	bob := delphi.NewPrincipal(rand.Reader)
+	lastYear := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+	v := bob.SignValidity(delphi.Validity{Created: lastYear, NotBefore: lastYear, NotAfter: lastYear.Add(time.Hour)})
+	blk, _ := bob.PublicKey().MarshalPEM()
+	v.SetHeaders(blk.Headers)
+
+	cli := hermeti.NewTestCli(new(DelphiApp))
+	cli.Env.Args = []string{"delphi", "encrypt"}
+	cli.Env.Randomness = rand.Reader
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	cli.Env.Mount(subfs, "./testdata")
+	cli.Env.PipeIn(bytes.NewReader(pem.EncodeToMemory(&blk)))
+	cli.Env.PipeInFiles("testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+	cli.Run()
+
+	errs, _ := cli.ErrStream()
+	assert.Contains(t, errs.String(), delphi.ErrExpired.Error())
+	out, _ := cli.OutStream()
+	assert.NotContains(t, out.String(), string(delphi.EncryptedMessage))
+
+}
+
+func TestEncrypt_StrippedValidity(t *testing.T) {
+
+	//	the keyring knows that bob's key expired last year
+	bob := delphi.NewPrincipal(rand.Reader)
+	lastYear := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+	v := bob.SignValidity(delphi.Validity{Created: lastYear, NotBefore: lastYear, NotAfter: lastYear.Add(time.Hour)})
+	fsys := afero.NewMemMapFs()
+	kr, _ := delphi.OpenKeyring(fsys, "/home/delphi/.config/delphi/keyring.pem")
+	assert.NoError(t, kr.Add(bob.PublicKey()))
+	assert.NoError(t, kr.AddValidity(bob.PublicKey(), v))
+	assert.NoError(t, kr.Save())
+
+	subfs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	run := func(args []string, pub []byte) (string, string) {
+		cli := hermeti.NewTestCli(new(DelphiApp))
+		cli.Env.Filesystem = fsys
+		cli.Env.Mount(subfs, "./testdata")
+		cli.Env.Randomness = rand.Reader
+		cli.Env.Vars["HOME"] = "/home/delphi"
+		cli.Env.Args = args
+		if pub != nil {
+			cli.Env.PipeIn(bytes.NewReader(pub))
+		}
+		cli.Env.PipeInFiles("testdata/bitter-frost.pem", "testdata/fortune_feynman.pem")
+		cli.Run()
+		o, _ := cli.OutStream()
+		e, _ := cli.ErrStream()
+		return o.String(), e.String()
+	}
+
+	//	his public key, with the validity period stripped off
+	blk, _ := bob.PublicKey().MarshalPEM()
+	out, errs := run([]string{"delphi", "encrypt"}, pem.EncodeToMemory(&blk))
+	assert.Contains(t, errs, delphi.ErrBadValidity.Error())
+	assert.NotContains(t, out, string(delphi.EncryptedMessage))
+
+	//	looked up in the keyring instead
+	out, errs = run([]string{"delphi", "encrypt", "--to", bob.PublicKey().Nickname()}, nil)
+	assert.Contains(t, errs, delphi.ErrExpired.Error())
+	assert.NotContains(t, out, string(delphi.EncryptedMessage))
+
+}
@@ -1,25 +1,150 @@
 package main
 
 import (
+	"bytes"
+	"encoding/pem"
 	"fmt"
 
 	"github.com/sean9999/go-delphi"
 	"github.com/sean9999/hermeti"
+	"github.com/spf13/afero"
 )
 
 func (app *DelphiApp) verify(env hermeti.Env) {
 
+	if app.opts.detached {
+		app.verifyDetached(env)
+		return
+	}
+	if app.opts.challenge != "" {
+		app.verifyChallenge(env)
+		return
+	}
+
 	msg := app.PluckMessage()
 	if msg == nil {
 		fmt.Fprintln(env.ErrStream, delphi.ErrNoMsg)
 		return
 	}
 
-	ok := msg.Verify()
-	if !ok {
-		fmt.Fprintln(env.ErrStream, delphi.ErrNoValid)
+	err := app.verifySigner(env, msg)
+	if err == nil {
+		var guard delphi.ReplayGuard
+		guard, err = app.replayGuard(env)
+		if err == nil && guard != nil {
+			err = guard.Check(msg)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
 	} else {
 		fmt.Fprintln(env.OutStream, "ok")
 	}
 
 }
+
+// verifySigner verifies the signature on msg, and checks the signer against revocations and its validity period
+func (app *DelphiApp) verifySigner(env hermeti.Env, msg *delphi.Message) error {
+	revs, err := app.revocations(env)
+	if err != nil {
+		return err
+	}
+	if err := msg.VerifyAgainst(revs...); err != nil {
+		return err
+	}
+	v, err := app.validityOf(env, msg.SenderKey)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		return msg.VerifyWithin(*v)
+	}
+	return nil
+}
+
+// verifyDetached verifies a detached signature over a file. Usage: delphi verify --detached FILE SIG
+func (app *DelphiApp) verifyDetached(env hermeti.Env) {
+
+	if len(app.args) != 2 {
+		fmt.Fprintln(env.ErrStream, "usage: delphi verify --detached FILE SIG")
+		return
+	}
+
+	sig, err := app.readSignature(env, app.args[1])
+	if err == nil {
+		err = app.verifySigner(env, sig.Message)
+	}
+	if err == nil {
+		var f afero.File
+		f, err = env.Filesystem.Open(app.args[0])
+		if err == nil {
+			defer f.Close()
+			err = sig.Check(f)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(env.ErrStream, err)
+		return
+	}
+	fmt.Fprintln(env.OutStream, "ok")
+
+}
+
+// replayGuard is the replay cache passed in with --replay-cache, or nil
+func (app *DelphiApp) replayGuard(env hermeti.Env) (delphi.ReplayGuard, error) {
+	if app.opts.replayCache == "" {
+		return nil, nil
+	}
+	return delphi.OpenFileReplayGuard(env.Filesystem, app.opts.replayCache, delphi.DefaultReplayWindow)
+}
+
+// readSignature reads a detached signature from a file
+func (app *DelphiApp) readSignature(env hermeti.Env, fpath string) (delphi.Signature, error) {
+	b, err := afero.ReadFile(env.Filesystem, fpath)
+	if err != nil {
+		return delphi.Signature{}, err
+	}
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return delphi.Signature{}, fmt.Errorf("%w: no PEM in %q", delphi.ErrBadSignature, fpath)
+	}
+	msg := new(delphi.Message)
+	if err := msg.FromPEM(*p); err != nil {
+		return delphi.Signature{}, err
+	}
+	return delphi.ParseSignature(msg)
+}
+
+// validityOf finds the validity period of peer, in a public key passed in on stdin, or in the keyring
+func (app *DelphiApp) validityOf(env hermeti.Env, peer delphi.Peer) (*delphi.Validity, error) {
+	for _, p := range app.pems[delphi.Pubkey] {
+		if !bytes.Equal(p.Bytes, peer.Bytes()) {
+			continue
+		}
+		return app.validityFromHeaders(env, peer, p.Headers)
+	}
+	if _, err := app.keyringPath(env); err != nil {
+		return nil, nil
+	}
+	kr, err := app.openKeyring(env)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := kr.Validity(peer); ok {
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// validityFromHeaders reads the validity period of peer from the headers of its public key,
+// checking them against the keyring if there is one
+func (app *DelphiApp) validityFromHeaders(env hermeti.Env, peer delphi.Peer, hdrs map[string]string) (*delphi.Validity, error) {
+	if _, err := app.keyringPath(env); err != nil {
+		return delphi.ValidityFromHeaders(hdrs)
+	}
+	kr, err := app.openKeyring(env)
+	if err != nil {
+		return nil, err
+	}
+	return kr.ValidityFromHeaders(peer, hdrs)
+}
@@ -63,3 +63,31 @@ func TestVerify(t *testing.T) {
 	})
 
 }
+
+func TestVerify_ReplayCache(t *testing.T) {
+
+	subFs := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), "../../testdata"))
+	fsys := afero.NewMemMapFs()
+
+	//	cat fortune_signed.pem | delphi verify --replay-cache seen.txt
+	verify := func() (string, string) {
+		cli := hermeti.NewTestCli(new(DelphiApp))
+		cli.Env.Args = []string{"delphi", "verify", "--replay-cache", "./cache/seen.txt"}
+		cli.Env.Filesystem = fsys
+		cli.Env.Mount(subFs, "./testdata")
+		cli.Env.PipeInFile("./testdata/fortune_signed.pem")
+		cli.Run()
+		oBuf, _ := cli.OutStream()
+		eBuf, _ := cli.ErrStream()
+		return oBuf.String(), eBuf.String()
+	}
+
+	out, errs := verify()
+	assert.Empty(t, errs)
+	assert.Contains(t, out, "ok")
+
+	out, errs = verify()
+	assert.Contains(t, errs, delphi.ErrReplay.Error())
+	assert.NotContains(t, out, "ok")
+
+}
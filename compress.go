@@ -0,0 +1,99 @@
+package delphi
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// compression algorithms, applied to plain text before it is encrypted
+const (
+	CompressNone    = "none"
+	CompressDeflate = "deflate"
+)
+
+// DefaultDecompressLimit is the most that a compressed [Message] may inflate to, unless told otherwise
+const DefaultDecompressLimit = 64 << 20
+
+var ErrUnknownCompression = errors.New("unknown compression")
+var ErrTooBig = errors.New("decompressed message is too big")
+
+// the header that records how the plain text was compressed. It is part of the AAD, so it cannot be altered.
+const compressionHeader = "compression"
+
+// Compression returns how the plain text of a [Message] is compressed. Messages that do not say are [CompressNone].
+func (msg *Message) Compression() string {
+	algo := msg.Headers.Get(Keyspace, compressionHeader)
+	if algo == "" {
+		return CompressNone
+	}
+	return algo
+}
+
+// checkCompression refuses algorithms we don't know about
+func checkCompression(algo string) error {
+	if !slices.Contains([]string{CompressNone, CompressDeflate}, algo) {
+		return fmt.Errorf("%w: %q", ErrUnknownCompression, algo)
+	}
+	return nil
+}
+
+// Compress compresses the plain text of a [Message] with algo, and records algo in a header.
+// [Principal.Encrypt] does this itself when [EncryptOptions] asks for it. Call it before [Principal.EncryptToMany].
+// Decryption decompresses transparently.
+//
+// Compressing before encrypting can leak how alike a secret is to text an attacker controls, if both are in the same message.
+func (msg *Message) Compress(algo string) error {
+	if err := checkCompression(algo); err != nil {
+		return err
+	}
+	if algo == CompressNone {
+		return nil
+	}
+	if msg.Encrypted() {
+		return fmt.Errorf("%w: already encrypted", ErrDelphi)
+	}
+	if msg.Compression() != CompressNone {
+		return fmt.Errorf("%w: already compressed", ErrDelphi)
+	}
+	buf := new(bytes.Buffer)
+	w, err := flate.NewWriter(buf, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.PlainText); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if msg.Headers == nil {
+		msg.Headers = make(KV)
+	}
+	msg.Headers.Set(Keyspace, compressionHeader, algo)
+	msg.PlainText = buf.Bytes()
+	return nil
+}
+
+// decompress inflates plain text compressed with algo, refusing to go past limit bytes
+func decompress(algo string, plain []byte, limit int64) ([]byte, error) {
+	if err := checkCompression(algo); err != nil {
+		return nil, err
+	}
+	if algo == CompressNone {
+		return plain, nil
+	}
+	r := flate.NewReader(bytes.NewReader(plain))
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("%w: over %d bytes", ErrTooBig, limit)
+	}
+	return out, nil
+}
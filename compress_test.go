@@ -0,0 +1,71 @@
+package delphi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+	logs := bytes.Repeat([]byte(`{"level":"info","msg":"all is well"}`+"\n"), 1000)
+
+	t.Run("round trip", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, logs)
+		err := alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Compression: CompressDeflate})
+		assert.NoError(t, err)
+		assert.Equal(t, CompressDeflate, msg.Compression())
+		assert.Less(t, len(msg.CipherText), len(logs)/5)
+		assert.NoError(t, bob.Decrypt(msg, nil))
+		assert.Equal(t, logs, msg.PlainText)
+		assert.Equal(t, CompressNone, msg.Compression())
+
+		//	bob can pass it on
+		assert.NoError(t, bob.Encrypt(randy, msg, carol.PublicKey(), EncryptOptions{Compression: CompressDeflate}))
+		assert.NoError(t, carol.Decrypt(msg, nil))
+		assert.Equal(t, logs, msg.PlainText)
+	})
+
+	t.Run("none is always fine", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, logs)
+		assert.NoError(t, msg.Compress(CompressDeflate))
+		assert.NoError(t, msg.Compress(CompressNone))
+	})
+
+	t.Run("many recipients", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, logs)
+		assert.NoError(t, msg.Compress(CompressDeflate))
+		assert.NoError(t, alice.EncryptToMany(randy, msg, bob.PublicKey(), carol.PublicKey()))
+		assert.NoError(t, carol.Decrypt(msg, nil))
+		assert.Equal(t, logs, msg.PlainText)
+	})
+
+	t.Run("header is authenticated", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, logs)
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Compression: CompressDeflate}))
+		msg.Headers.Set(Keyspace, compressionHeader, CompressNone)
+		assert.Error(t, bob.Decrypt(msg, nil))
+	})
+
+	t.Run("bomb", func(t *testing.T) {
+		zeros := make([]byte, 1<<20)
+		msg := alice.ComposeMessage(randy, zeros)
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Compression: CompressDeflate}))
+		before := msg.CipherText
+		err := bob.Decrypt(msg, DecryptOptions{DecompressLimit: 1 << 16})
+		assert.ErrorIs(t, err, ErrTooBig)
+		assert.Equal(t, before, msg.CipherText)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, logs)
+		err := alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Compression: "lzma"})
+		assert.ErrorIs(t, err, ErrUnknownCompression)
+		assert.Equal(t, logs, msg.PlainText)
+	})
+
+}
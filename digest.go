@@ -0,0 +1,109 @@
+package delphi
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// versions of [Message.Digest]
+const (
+	// DigestV1 is the original digest. It is ambiguous, and is only used to verify old messages.
+	DigestV1 = "v1"
+	// DigestV2 is domain separated and length prefixed, and covers every field but the signature.
+	DigestV2 = "v2"
+)
+
+// ErrWeakDigest is returned for a signed statement that must be [DigestV2], but is not
+var ErrWeakDigest = errors.New("digest is not " + DigestV2)
+
+// the header that records the digest version. Messages without it are [DigestV1].
+const digestHeader = "digest"
+
+const digestDomain = "delphi/digest/v2"
+
+// DigestVersion says how the [Message] is to be digested
+func (msg *Message) DigestVersion() string {
+	v := msg.Headers.Get(Keyspace, digestHeader)
+	if v == "" {
+		return DigestV1
+	}
+	return v
+}
+
+// digestV2 hashes every field that means something, each prefixed by its length, after a domain separator.
+func (msg *Message) digestV2() []byte {
+	h := sha256.New()
+	writeField(h, []byte(digestDomain))
+	writeField(h, []byte(msg.Subject))
+	writeField(h, msg.SenderKey.Bytes())
+	writeField(h, msg.RecipientKey.Bytes())
+	writeField(h, msg.Nonce.Bytes())
+	writeField(h, msg.Eph)
+	if msg.Encrypted() {
+		writeField(h, []byte{wireCipher})
+		writeField(h, msg.CipherText)
+	} else {
+		writeField(h, []byte{wirePlain})
+		writeField(h, msg.PlainText)
+	}
+	binary.Write(h, binary.BigEndian, uint64(len(msg.Headers)))
+	for k, v := range msg.Headers.LexicalOrder() {
+		writeField(h, []byte(k))
+		writeField(h, []byte(v))
+	}
+	binary.Write(h, binary.BigEndian, uint64(len(msg.Slots)))
+	for _, slot := range msg.Slots {
+		writeField(h, slot.RecipientKey.Bytes())
+		writeField(h, slot.Eph)
+		writeField(h, slot.WrappedKey)
+	}
+	return h.Sum(nil)
+}
+
+// writeField writes b to h, prefixed by its length
+func writeField(h hash.Hash, b []byte) {
+	binary.Write(h, binary.BigEndian, uint64(len(b)))
+	h.Write(b)
+}
+
+// digestV1 is the original digest
+func (msg *Message) digestV1() []byte {
+	hash := sha256.New()
+	sum := make([]byte, 0)
+	sum = append(sum, msg.SenderKey.Bytes()...)
+	sum = append(sum, msg.Nonce[:]...)
+	if msg.Encrypted() {
+		sum = append(sum, msg.CipherText...)
+	} else {
+		sum = append(sum, msg.PlainText...)
+	}
+	for k, v := range msg.Headers.LexicalOrder() {
+		sum = append(sum, []byte(k)...)
+		sum = append(sum, []byte(v)...)
+	}
+	//	this appends the hash of nothing to sum, rather than hashing sum. It is kept so that old signatures still verify.
+	return hash.Sum(sum)
+}
+
+// verifyV2 is [Message.Verify] for statements about keys, which must bind the subject and recipient,
+// and so refuse [DigestV1] rather than fall back to it
+func (msg *Message) verifyV2() error {
+	if msg.DigestVersion() != DigestV2 {
+		return ErrWeakDigest
+	}
+	if !msg.Verify() {
+		return ErrNoValid
+	}
+	return nil
+}
+
+// checkDigestVersion refuses digest versions we don't know about
+func checkDigestVersion(v string) error {
+	if v != DigestV1 && v != DigestV2 {
+		return fmt.Errorf("unknown digest version %q", v)
+	}
+	return nil
+}
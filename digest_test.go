@@ -0,0 +1,90 @@
+package delphi
+
+import (
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signV1 re-signs msg as an old [DigestV1] message would have been signed
+func signV1(t *testing.T, msg *Message, signer Principal) {
+	t.Helper()
+	msg.Headers.Delete(Keyspace, digestHeader)
+	digest, err := msg.Digest()
+	assert.NoError(t, err)
+	msg.Sig, err = signer.Sign(randy, digest, nil)
+	assert.NoError(t, err)
+	assert.True(t, msg.Verify())
+}
+
+func TestDigest_V2(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	compose := func(k, v string) *Message {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		msg.Nonce = Nonce{1}
+		msg.Headers[k] = v
+		return msg
+	}
+
+	t.Run("unambiguous", func(t *testing.T) {
+		ab, a := compose("ab", "c"), compose("a", "bc")
+		v1ab, _ := ab.Digest()
+		v1a, _ := a.Digest()
+		assert.Equal(t, v1ab, v1a, "v1 is ambiguous")
+
+		ab.stampVersion()
+		a.stampVersion()
+		v2ab, _ := ab.Digest()
+		v2a, _ := a.Digest()
+		assert.NotEqual(t, v2ab, v2a)
+		assert.Len(t, v2ab, 32)
+	})
+
+	t.Run("covers subject and recipient", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, msg.Sign(randy, alice))
+		assert.Equal(t, DigestV2, msg.DigestVersion())
+		assert.True(t, msg.Verify())
+
+		msg.Subject = Assertion
+		assert.False(t, msg.Verify())
+		msg.Subject = PlainMessage
+		msg.RecipientKey = bob.PublicKey()
+		assert.False(t, msg.Verify())
+	})
+
+	t.Run("no downgrade", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, msg.Sign(randy, alice))
+		msg.Headers.Set(Keyspace, digestHeader, DigestV1)
+		assert.False(t, msg.Verify())
+		msg.Headers.Set(Keyspace, digestHeader, "v9")
+		_, err := msg.Digest()
+		assert.Error(t, err)
+	})
+
+	t.Run("v1 still verifies", func(t *testing.T) {
+		b, err := os.ReadFile("testdata/fortune_signed.pem")
+		assert.NoError(t, err)
+		p, _ := pem.Decode(b)
+		msg := new(Message)
+		assert.NoError(t, msg.FromPEM(*p))
+		assert.Equal(t, DigestV1, msg.DigestVersion())
+		assert.True(t, msg.Verify())
+	})
+
+	t.Run("sign after encrypt", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), nil))
+		assert.NoError(t, msg.Sign(randy, alice))
+		assert.Equal(t, DigestV2, msg.DigestVersion())
+		assert.True(t, msg.Verify())
+		assert.NoError(t, bob.Decrypt(msg, nil))
+	})
+
+}
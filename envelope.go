@@ -0,0 +1,200 @@
+package delphi
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// the prefix for PEM headers that carry [Slot]s
+const slotHeader = "slot"
+
+// SlotSize is the size of a [Slot] in binary form: recipient key, ephemeral key, and wrapped content key
+const SlotSize = 2*SubKeySize + SubKeySize + chacha20poly1305.KeySize + chacha20poly1305.Overhead
+
+var ErrNotRecipient = errors.New("not a recipient")
+
+// A Slot is a content key wrapped for one recipient of a multi-recipient [Message].
+type Slot struct {
+	RecipientKey Key    `msgpack:"to" json:"to"`
+	Eph          []byte `msgpack:"eph" json:"eph"`
+	WrappedKey   []byte `msgpack:"key" json:"key"`
+}
+
+func (s Slot) MarshalBinary() ([]byte, error) {
+	if len(s.Eph) != SubKeySize {
+		return nil, fmt.Errorf("%w: wrong length for ephemeral key. wanted %d but got %d", ErrDelphi, SubKeySize, len(s.Eph))
+	}
+	b := make([]byte, 0, SlotSize)
+	b = append(b, s.RecipientKey.Bytes()...)
+	b = append(b, s.Eph...)
+	b = append(b, s.WrappedKey...)
+	if len(b) != SlotSize {
+		return nil, fmt.Errorf("%w: wrong length for slot. wanted %d but got %d", ErrDelphi, SlotSize, len(b))
+	}
+	return b, nil
+}
+
+func (s *Slot) UnmarshalBinary(b []byte) error {
+	if len(b) != SlotSize {
+		return fmt.Errorf("%w: wrong length for slot. wanted %d but got %d", ErrDelphi, SlotSize, len(b))
+	}
+	s.RecipientKey = KeyFromBytes(b[:2*SubKeySize])
+	s.Eph = slices.Clone(b[2*SubKeySize : 3*SubKeySize])
+	s.WrappedKey = slices.Clone(b[3*SubKeySize:])
+	return nil
+}
+
+// wrapContentKey wraps a content key for one recipient, using a fresh ephemeral key
+func wrapContentKey(randy io.Reader, contentKey []byte, recipient Key) (Slot, error) {
+	sec, eph, err := generateSharedSecret(recipient.Encryption().Bytes(), randy)
+	if err != nil {
+		return Slot{}, err
+	}
+	//	each shared secret is used exactly once, so a fixed nonce is safe here
+	wrapped, err := encrypt(sec, contentKey, UniversalNonce, recipient.Bytes())
+	if err != nil {
+		return Slot{}, err
+	}
+	return Slot{RecipientKey: recipient, Eph: eph, WrappedKey: wrapped}, nil
+}
+
+// unwrapContentKey recovers the content key from the [Slot] addressed to p
+func (p Principal) unwrapContentKey(slots []Slot) ([]byte, error) {
+	i := slices.IndexFunc(slots, func(s Slot) bool {
+		return s.RecipientKey.Equal(p.PublicKey())
+	})
+	if i < 0 {
+		return nil, ErrNotRecipient
+	}
+	slot := slots[i]
+	sec, err := extractSharedSecret(slot.Eph, p.privateEncryptionKey().Bytes(), p.publicEncryptionKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(sec, slot.WrappedKey, UniversalNonce, slot.RecipientKey.Bytes())
+}
+
+// EncryptToMany encrypts a [Message] once, to any number of recipients.
+// The body is sealed with a random content key, which is wrapped once per recipient.
+func (p Principal) EncryptToMany(randy io.Reader, msg *Message, recipients ...Key) error {
+
+	if msg.Encrypted() {
+		return fmt.Errorf("%w: already encrypted", ErrDelphi)
+	}
+	if !msg.Plain() {
+		return fmt.Errorf("%w: there is no plain text to encrypt", ErrDelphi)
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("%w: no recipients", ErrDelphi)
+	}
+
+	contentKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(randy, contentKey); err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+
+	slots := make([]Slot, 0, len(recipients))
+	for _, recipient := range recipients {
+		if recipient.IsZero() {
+			return fmt.Errorf("%w: recipient: %w", ErrDelphi, ErrBadKey)
+		}
+		slot, err := wrapContentKey(randy, contentKey, recipient)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrDelphi, err)
+		}
+		slots = append(slots, slot)
+	}
+
+	msg.SenderKey = p.PublicKey()
+	msg.RecipientKey = Key{}
+	msg.Eph = nil
+	msg.Slots = slots
+	msg.ensureNonce(randy)
+
+	msg.stampVersion()
+	aad, err := msg.aad()
+	if err != nil {
+		return err
+	}
+
+	cipherText, err := encrypt(contentKey, msg.PlainText, msg.Nonce.Bytes(), aad)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+
+	msg.CipherText = cipherText
+	msg.PlainText = nil
+
+	if msg.Subject == PlainMessage {
+		msg.Subject = EncryptedMessage
+	}
+
+	return nil
+}
+
+// slotsToPEM writes slots as PEM headers of the form "slot/N"
+func slotsToPEM(slots []Slot, hdrs map[string]string) error {
+	for i, slot := range slots {
+		bin, err := slot.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("slot %d: %w", i, err)
+		}
+		hdrs[fmt.Sprintf("%s/%d", slotHeader, i)] = base64.StdEncoding.EncodeToString(bin)
+	}
+	return nil
+}
+
+// isSlotHeader reports whether a PEM header key holds a [Slot]
+func isSlotHeader(k string) bool {
+	return strings.HasPrefix(k, slotHeader+"/")
+}
+
+// slotsFromPEM reads slots back out of PEM headers, in order.
+// The indices must be exactly 0 to N-1, written as slotsToPEM writes them, so that no slot can hide behind another's index.
+func slotsFromPEM(hdrs map[string]string) ([]Slot, error) {
+	type indexed struct {
+		i    int
+		slot Slot
+	}
+	found := make([]indexed, 0)
+	for k := range hdrs {
+		if !isSlotHeader(k) {
+			continue
+		}
+		index := strings.TrimPrefix(k, slotHeader+"/")
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 || strconv.Itoa(i) != index {
+			return nil, fmt.Errorf("%w: bad slot header %q", ErrDelphi, k)
+		}
+		bin, err := KV(hdrs).bytesAt(k)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad slot %d: %w", ErrDelphi, i, err)
+		}
+		var slot Slot
+		if err := slot.UnmarshalBinary(bin); err != nil {
+			return nil, err
+		}
+		found = append(found, indexed{i, slot})
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(found, func(a, b indexed) int {
+		return a.i - b.i
+	})
+	slots := make([]Slot, len(found))
+	for j, f := range found {
+		if f.i != j {
+			return nil, fmt.Errorf("%w: slots are not numbered 0 to %d", ErrDelphi, len(found)-1)
+		}
+		slots[j] = f.slot
+	}
+	return slots, nil
+}
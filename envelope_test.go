@@ -0,0 +1,125 @@
+package delphi
+
+import (
+	"io"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptToMany(t *testing.T) {
+
+	sentence := []byte("hello everyone")
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+	mallory := NewPrincipal(randy)
+
+	msg := alice.ComposeMessage(randy, sentence)
+	msg.Headers["foo"] = "bar"
+
+	err := alice.EncryptToMany(randy, msg, bob.PublicKey(), carol.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptedMessage, msg.Subject)
+	assert.Len(t, msg.Slots, 2)
+	assert.True(t, msg.RecipientKey.IsZero())
+
+	t.Run("every recipient can decrypt", func(t *testing.T) {
+		for _, recipient := range []Principal{bob, carol} {
+
+			//	round trip through PEM, as a recipient would receive it
+			p := toPEM(t, msg)
+			got := new(Message)
+			err := got.FromPEM(p)
+			assert.NoError(t, err)
+			assert.Len(t, got.Slots, 2)
+			assert.Equal(t, msg.Slots, got.Slots)
+
+			err = recipient.Decrypt(got, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, sentence, got.PlainText)
+			assert.Equal(t, "bar", got.Headers["foo"])
+		}
+	})
+
+	t.Run("non-recipient cannot decrypt", func(t *testing.T) {
+		p := toPEM(t, msg)
+		got := new(Message)
+		got.FromPEM(p)
+		err := mallory.Decrypt(got, nil)
+		assert.ErrorIs(t, err, ErrNotRecipient)
+	})
+
+}
+
+func TestEncryptToMany_No_Recipients(t *testing.T) {
+	alice := NewPrincipal(randy)
+	msg := alice.ComposeMessage(randy, []byte("hello nobody"))
+	err := alice.EncryptToMany(randy, msg)
+	assert.ErrorIs(t, err, ErrDelphi)
+	err = alice.EncryptToMany(randy, msg, Key{})
+	assert.ErrorIs(t, err, ErrBadKey)
+}
+
+func TestSlot_Binary(t *testing.T) {
+	bob := NewPrincipal(randy)
+	slot, err := wrapContentKey(randy, make([]byte, 32), bob.PublicKey())
+	assert.NoError(t, err)
+
+	bin, err := slot.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Len(t, bin, SlotSize)
+
+	var got Slot
+	err = got.UnmarshalBinary(bin)
+	assert.NoError(t, err)
+	assert.Equal(t, slot, got)
+
+	assert.Error(t, got.UnmarshalBinary(bin[1:]))
+}
+
+func TestSlot_PEM(t *testing.T) {
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+	msg := alice.ComposeMessage(randy, []byte("hello"))
+	assert.NoError(t, alice.EncryptToMany(randy, msg, bob.PublicKey(), carol.PublicKey()))
+	good := toPEM(t, msg)
+
+	t.Run("malformed slots do not encode", func(t *testing.T) {
+		bad := *msg
+		bad.Slots = slices.Clone(msg.Slots)
+		bad.Slots[0].Eph = bad.Slots[0].Eph[1:]
+		_, err := bad.ToPEM()
+		assert.ErrorIs(t, err, ErrInvalidMsg)
+		assert.NotPanics(t, func() { _ = bad.String() })
+		_, err = io.ReadAll(&bad)
+		assert.Error(t, err)
+	})
+
+	t.Run("indices", func(t *testing.T) {
+		for name, rename := range map[string][2]string{
+			"aliased":     {"slot/1", "slot/01"},
+			"signed":      {"slot/1", "slot/+1"},
+			"gap":         {"slot/1", "slot/2"},
+			"not a digit": {"slot/1", "slot/one"},
+		} {
+			p := good
+			p.Headers = maps.Clone(good.Headers)
+			p.Headers[rename[1]] = p.Headers[rename[0]]
+			delete(p.Headers, rename[0])
+			assert.ErrorIs(t, new(Message).FromPEM(p), ErrDelphi, name)
+		}
+
+		//	the same slot twice, under an alias
+		p := good
+		p.Headers = maps.Clone(good.Headers)
+		p.Headers["slot/00"] = p.Headers["slot/0"]
+		assert.ErrorIs(t, new(Message).FromPEM(p), ErrDelphi)
+
+		assert.NoError(t, new(Message).FromPEM(good))
+	})
+}
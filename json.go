@@ -0,0 +1,177 @@
+package delphi
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrBadJSON = errors.New("bad JSON")
+var ErrSecretJSON = errors.New("refusing to write a private key as JSON. Use ExposedPrincipal to opt in")
+
+// the JSON form of a [Principal]. Keys are hex, like [Key]'s.
+type principalJSON struct {
+	Version string `json:"version"`
+	Nick    string `json:"nick,omitempty"`
+	Public  Key    `json:"public"`
+	Private Key    `json:"private"`
+}
+
+// MarshalJSON refuses, because a Principal holds secrets. See [ExposedPrincipal].
+func (kp KeyPair) MarshalJSON() ([]byte, error) {
+	return nil, ErrSecretJSON
+}
+
+// UnmarshalJSON reads the JSON written by [ExposedPrincipal], and checks that the public key belongs to the private key.
+func (kp *KeyPair) UnmarshalJSON(b []byte) error {
+	var pj principalJSON
+	if err := json.Unmarshal(b, &pj); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadJSON, err)
+	}
+	if pj.Version != Version {
+		return fmt.Errorf("%w: unsupported version %q", ErrBadJSON, pj.Version)
+	}
+	encPriv, err := ecdh.X25519().NewPrivateKey(pj.Private.Encryption().Bytes())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadJSON, err)
+	}
+	sigPub := ed25519.NewKeyFromSeed(pj.Private.Signing().Bytes()).Public().(ed25519.PublicKey)
+	if !bytes.Equal(encPriv.PublicKey().Bytes(), pj.Public.Encryption().Bytes()) || !sigPub.Equal(ed25519.PublicKey(pj.Public.Signing().Bytes())) {
+		return fmt.Errorf("%w: public key does not match private key", ErrBadJSON)
+	}
+	kp[0], kp[1] = pj.Public, pj.Private
+	return nil
+}
+
+// An ExposedPrincipal is a [Principal] that may be written as JSON, secrets and all:
+//
+//	{"version": "v1", "nick": "bitter-frost", "public": "<hex>", "private": "<hex>"}
+type ExposedPrincipal struct {
+	Principal Principal
+}
+
+func (e ExposedPrincipal) MarshalJSON() ([]byte, error) {
+	pj := principalJSON{
+		Version: Version,
+		Nick:    e.Principal.Nickname(),
+		Public:  e.Principal.PublicKey(),
+		Private: e.Principal.PrivateKey(),
+	}
+	return json.Marshal(pj)
+}
+
+func (e *ExposedPrincipal) UnmarshalJSON(b []byte) error {
+	return e.Principal.UnmarshalJSON(b)
+}
+
+// the JSON form of a [Message]. Keys are hex. Other binary values are standard base64.
+type messageJSON struct {
+	Version    string  `json:"version"`
+	Subject    Subject `json:"subject"`
+	To         *Key    `json:"to,omitempty"`
+	From       *Key    `json:"from,omitempty"`
+	Headers    KV      `json:"headers,omitempty"`
+	Eph        []byte  `json:"eph,omitempty"`
+	Nonce      []byte  `json:"nonce,omitempty"`
+	CipherText []byte  `json:"ciphertext,omitempty"`
+	PlainText  []byte  `json:"plaintext,omitempty"`
+	Sig        []byte  `json:"sig,omitempty"`
+	Slots      []Slot  `json:"slots,omitempty"`
+}
+
+// MarshalJSON writes a [Message] as:
+//
+//	{
+//		"version": "v1", "subject": "DELPHI ENCRYPTED MESSAGE",
+//		"to": "<hex>", "from": "<hex>", "headers": {"delphi/version": "v1"},
+//		"eph": "<base64>", "nonce": "<base64>", "ciphertext": "<base64>", "plaintext": "<base64>", "sig": "<base64>",
+//		"slots": [{"to": "<hex>", "eph": "<base64>", "key": "<base64>"}]
+//	}
+//
+// Empty fields are left out.
+func (msg *Message) MarshalJSON() ([]byte, error) {
+	mj := messageJSON{
+		Version:    Version,
+		Subject:    msg.Subject,
+		Headers:    msg.Headers,
+		Eph:        msg.Eph,
+		CipherText: msg.CipherText,
+		PlainText:  msg.PlainText,
+		Sig:        msg.Sig,
+		Slots:      msg.Slots,
+	}
+	if !msg.RecipientKey.IsZero() {
+		mj.To = &msg.RecipientKey
+	}
+	if !msg.SenderKey.IsZero() {
+		mj.From = &msg.SenderKey
+	}
+	if !msg.Nonce.IsZero() {
+		mj.Nonce = msg.Nonce.Bytes()
+	}
+	return json.Marshal(mj)
+}
+
+// UnmarshalJSON reads a [Message] written by [Message.MarshalJSON], checking the length of every binary value.
+func (msg *Message) UnmarshalJSON(b []byte) error {
+	var mj messageJSON
+	if err := json.Unmarshal(b, &mj); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadJSON, err)
+	}
+	if mj.Version != Version {
+		return fmt.Errorf("%w: unsupported version %q", ErrBadJSON, mj.Version)
+	}
+	for name, want := range map[string]struct {
+		got  []byte
+		size int
+	}{"eph": {mj.Eph, SubKeySize}, "nonce": {mj.Nonce, NonceSize}, "sig": {mj.Sig, ed25519.SignatureSize}} {
+		if len(want.got) != 0 && len(want.got) != want.size {
+			return fmt.Errorf("%w: %s: wrong length. wanted %d but got %d", ErrBadJSON, name, want.size, len(want.got))
+		}
+	}
+	if len(mj.CipherText) > 0 && len(mj.PlainText) > 0 {
+		return fmt.Errorf("%w: both plain and cipher text", ErrBadJSON)
+	}
+	for i, slot := range mj.Slots {
+		if len(slot.Eph) != SubKeySize || len(slot.WrappedKey) != SlotSize-3*SubKeySize {
+			return fmt.Errorf("%w: slot %d: wrong length", ErrBadJSON, i)
+		}
+	}
+	m := Message{
+		Subject:    mj.Subject,
+		Headers:    mj.Headers,
+		Eph:        mj.Eph,
+		Nonce:      NonceFromBytes(mj.Nonce),
+		CipherText: mj.CipherText,
+		PlainText:  mj.PlainText,
+		Sig:        mj.Sig,
+		Slots:      mj.Slots,
+	}
+	if m.Headers == nil {
+		m.Headers = make(KV)
+	}
+	if mj.To != nil {
+		m.RecipientKey = *mj.To
+	}
+	if mj.From != nil {
+		m.SenderKey = *mj.From
+	}
+	*msg = m
+	return nil
+}
+
+// decodeKeyText decodes the hex form of a [Key], checking its length
+func decodeKeyText(b []byte) (Key, error) {
+	bin := make([]byte, hex.DecodedLen(len(b)))
+	if _, err := hex.Decode(bin, b); err != nil {
+		return Key{}, fmt.Errorf("%w: %w", ErrBadKey, err)
+	}
+	if len(bin) != 2*SubKeySize {
+		return Key{}, fmt.Errorf("%w: wrong length. wanted %d but got %d", ErrBadKey, 2*SubKeySize, len(bin))
+	}
+	return KeyFromBytes(bin), nil
+}
@@ -0,0 +1,113 @@
+package delphi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey_JSON(t *testing.T) {
+
+	k := NewPrincipal(randy).PublicKey()
+	b, err := json.Marshal(k)
+	assert.NoError(t, err)
+	assert.Equal(t, `"`+k.ToHex()+`"`, string(b))
+
+	var got Key
+	assert.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, k, got)
+
+	for name, bad := range map[string]string{
+		"not a string": `42`,
+		"not hex":      `"xyz"`,
+		"too short":    `"` + k.ToHex()[:10] + `"`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var k Key
+			assert.ErrorIs(t, json.Unmarshal([]byte(bad), &k), ErrBadKey)
+		})
+	}
+
+}
+
+func TestPrincipal_JSON(t *testing.T) {
+
+	p := NewPrincipal(randy)
+
+	//	secrets are opt-in
+	_, err := json.Marshal(p)
+	assert.ErrorIs(t, err, ErrSecretJSON)
+	_, err = json.Marshal(struct{ Me Principal }{p})
+	assert.ErrorIs(t, err, ErrSecretJSON)
+
+	b, err := json.Marshal(ExposedPrincipal{p})
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), p.Nickname())
+
+	var got Principal
+	assert.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, p, got)
+
+	var exposed ExposedPrincipal
+	assert.NoError(t, json.Unmarshal(b, &exposed))
+	assert.Equal(t, p, exposed.Principal)
+
+	t.Run("mismatched", func(t *testing.T) {
+		other := NewPrincipal(randy)
+		mismatched := strings.Replace(string(b), p.PublicKey().ToHex(), other.PublicKey().ToHex(), 1)
+		assert.ErrorIs(t, json.Unmarshal([]byte(mismatched), &got), ErrBadJSON)
+	})
+
+}
+
+func TestMessage_JSON(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+
+	signed := alice.ComposeMessage(randy, []byte("hello"))
+	signed.Sign(randy, alice)
+	encrypted := alice.ComposeMessage(randy, []byte("hello"))
+	alice.Encrypt(randy, encrypted, bob.PublicKey(), nil)
+	many := alice.ComposeMessage(randy, []byte("hello"))
+	alice.EncryptToMany(randy, many, bob.PublicKey(), carol.PublicKey())
+
+	for name, msg := range map[string]*Message{"signed": signed, "encrypted": encrypted, "many recipients": many} {
+		t.Run(name, func(t *testing.T) {
+			b, err := json.Marshal(msg)
+			assert.NoError(t, err)
+			assert.Contains(t, string(b), `"version":"v1"`)
+
+			got := new(Message)
+			assert.NoError(t, json.Unmarshal(b, got))
+			assert.Equal(t, msg.String(), got.String())
+		})
+	}
+
+	t.Run("still works", func(t *testing.T) {
+		b, _ := json.Marshal(encrypted)
+		got := new(Message)
+		json.Unmarshal(b, got)
+		assert.NoError(t, bob.Decrypt(got, nil))
+
+		b, _ = json.Marshal(signed)
+		json.Unmarshal(b, got)
+		assert.True(t, got.Verify())
+	})
+
+	for name, bad := range map[string]string{
+		"version": `{"version":"v0"}`,
+		"nonce":   `{"version":"v1","nonce":"AAAA"}`,
+		"eph":     `{"version":"v1","eph":"AAAA"}`,
+		"both":    `{"version":"v1","plaintext":"AAAA","ciphertext":"AAAA"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := new(Message)
+			assert.ErrorIs(t, json.Unmarshal([]byte(bad), got), ErrBadJSON)
+		})
+	}
+
+}
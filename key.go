@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/ecdh"
 	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
@@ -38,6 +39,7 @@ func NewPeer() Peer {
 // a Key is two (specifically one encryption and one signing) keys
 type Key [2]subKey
 
+// MarshalJSON writes a Key as a JSON string of 128 hex digits: the encryption key, then the signing key
 func (k Key) MarshalJSON() ([]byte, error) {
 	str := k.ToHex()
 	return json.Marshal(str)
@@ -54,15 +56,26 @@ func (k *Key) UnmarshalBinary(b []byte) error {
 }
 
 func (k *Key) UnmarshalJSON(b []byte) error {
-	j := KeyFromHex(string(b))
-	copy(k[:], j[:])
-	return nil
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadKey, err)
+	}
+	return k.UnmarshalText([]byte(str))
 }
 
 func (k Key) MarshalText() ([]byte, error) {
 	return []byte(k.ToHex()), nil
 }
 
+func (k *Key) UnmarshalText(b []byte) error {
+	j, err := decodeKeyText(b)
+	if err != nil {
+		return err
+	}
+	*k = j
+	return nil
+}
+
 // a Key is zero if all it's subKeys are zero
 func (k Key) IsZero() bool {
 	return k[0].IsZero() && k[1].IsZero()
@@ -138,6 +151,12 @@ func (k KeyPair) Bytes() []byte {
 	return b
 }
 
+// Fingerprint is a short, stable identifier for a Key, suitable for humans and file names
+func (k Key) Fingerprint() string {
+	sum := sha256.Sum256(k.Bytes())
+	return hex.EncodeToString(sum[:16])
+}
+
 func (k Key) ToHex() string {
 	return hex.EncodeToString(k.Bytes())
 }
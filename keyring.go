@@ -0,0 +1,481 @@
+package delphi
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var ErrNotFound = errors.New("not found")
+var ErrAmbiguous = errors.New("ambiguous")
+
+// MinPrefixLen is the shortest hex prefix of a key that [Keyring.ByPrefix] will consider
+const MinPrefixLen = 8
+
+// A Keyring is an address book of [Peer]s, their [Subkey]s, the [Certification]s between them, and their [Revocation]s, persisted as PEMs.
+// It is backed either by a single file holding many PEMs, or by a directory holding one PEM per file.
+type Keyring struct {
+	fs    afero.Fs
+	path  string
+	isDir bool
+	peers map[string]Peer
+	valid map[string]Validity
+	certs map[string]Certification
+	revs  map[string]Revocation
+	subs  map[string]Subkey
+}
+
+// OpenKeyring opens the keyring at path, which is treated as a directory if it is one,
+// or if it ends in a slash. A keyring that does not exist yet is empty.
+func OpenKeyring(fsys afero.Fs, path string) (*Keyring, error) {
+	kr := &Keyring{
+		fs:    fsys,
+		path:  path,
+		peers: make(map[string]Peer),
+		valid: make(map[string]Validity),
+		certs: make(map[string]Certification),
+		revs:  make(map[string]Revocation),
+		subs:  make(map[string]Subkey),
+	}
+	isDir, err := afero.IsDir(fsys, path)
+	if err == nil {
+		kr.isDir = isDir
+	} else {
+		kr.isDir = strings.HasSuffix(path, "/")
+	}
+	if err := kr.load(); err != nil {
+		return nil, fmt.Errorf("could not open keyring: %w", err)
+	}
+	return kr, nil
+}
+
+// load reads all PEMs from the backing file or directory
+func (kr *Keyring) load() error {
+	files := []string{kr.path}
+	if kr.isDir {
+		files = files[:0]
+		infos, err := afero.ReadDir(kr.fs, kr.path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, info := range infos {
+			if !info.IsDir() && filepath.Ext(info.Name()) == ".pem" {
+				files = append(files, filepath.Join(kr.path, info.Name()))
+			}
+		}
+	}
+	for _, f := range files {
+		//	a keyring that does not exist yet is fine
+		exists, err := afero.Exists(kr.fs, f)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		b, err := afero.ReadFile(kr.fs, f)
+		if err != nil {
+			return err
+		}
+		if err := kr.Import(b); err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// Import adds every PEM in b that the keyring understands, and ignores the rest.
+func (kr *Keyring) Import(b []byte) error {
+	for p, rest := pem.Decode(b); p != nil; p, rest = pem.Decode(rest) {
+		switch Subject(p.Type) {
+		case Pubkey:
+			var peer Peer
+			if err := peer.UnmarshalPEM(*p); err != nil {
+				return err
+			}
+			if err := kr.Add(peer); err != nil {
+				return err
+			}
+			v, err := ValidityFromHeaders(p.Headers)
+			if err != nil {
+				return err
+			}
+			if v != nil {
+				if err := kr.AddValidity(peer, *v); err != nil {
+					return err
+				}
+			}
+		case KeyCertification:
+			msg := new(Message)
+			if err := msg.FromPEM(*p); err != nil {
+				return err
+			}
+			if err := kr.AddCertification(msg); err != nil {
+				return err
+			}
+		case KeyRevocation:
+			msg := new(Message)
+			if err := msg.FromPEM(*p); err != nil {
+				return err
+			}
+			if err := kr.AddRevocation(msg); err != nil {
+				return err
+			}
+		case PublicSubkey:
+			var sk Subkey
+			if err := sk.UnmarshalPEM(*p); err != nil {
+				return err
+			}
+			if err := kr.AddSubkey(sk); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// a keyringItem is one PEM in a keyring, with the file name it gets in a directory
+type keyringItem struct {
+	name  string
+	block pem.Block
+}
+
+// items returns everything in the keyring, as PEMs, in a stable order
+func (kr *Keyring) items() ([]keyringItem, error) {
+	items := make([]keyringItem, 0, len(kr.peers)+len(kr.certs)+len(kr.revs)+len(kr.subs))
+	for _, peer := range kr.List() {
+		blk, err := peer.MarshalPEM()
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := kr.Validity(peer); ok {
+			v.SetHeaders(blk.Headers)
+		}
+		items = append(items, keyringItem{peer.Fingerprint() + ".pem", blk})
+	}
+	for _, k := range slices.Sorted(maps.Keys(kr.certs)) {
+		blk, err := kr.certs[k].Message.ToPEM()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, keyringItem{k + ".cert.pem", blk})
+	}
+	for _, k := range slices.Sorted(maps.Keys(kr.revs)) {
+		blk, err := kr.revs[k].Message.ToPEM()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, keyringItem{k + ".rev.pem", blk})
+	}
+	for _, k := range slices.Sorted(maps.Keys(kr.subs)) {
+		blk, err := kr.subs[k].MarshalPEM()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, keyringItem{k + ".subkey.pem", blk})
+	}
+	return items, nil
+}
+
+// Save persists the keyring
+func (kr *Keyring) Save() error {
+	items, err := kr.items()
+	if err != nil {
+		return err
+	}
+	if kr.isDir {
+		return kr.saveDir(items)
+	}
+	buf := new(bytes.Buffer)
+	for _, item := range items {
+		if err := pem.Encode(buf, &item.block); err != nil {
+			return fmt.Errorf("%s: %w", item.name, err)
+		}
+	}
+	if err := kr.fs.MkdirAll(filepath.Dir(kr.path), 0700); err != nil {
+		return err
+	}
+	return afero.WriteFile(kr.fs, kr.path, buf.Bytes(), 0600)
+}
+
+// saveDir writes one file per item, and removes files for items that are gone
+func (kr *Keyring) saveDir(items []keyringItem) error {
+	if err := kr.fs.MkdirAll(kr.path, 0700); err != nil {
+		return err
+	}
+	want := make(map[string]bool, len(items))
+	for _, item := range items {
+		want[item.name] = true
+		if err := afero.WriteFile(kr.fs, filepath.Join(kr.path, item.name), pem.EncodeToMemory(&item.block), 0600); err != nil {
+			return err
+		}
+	}
+	infos, err := afero.ReadDir(kr.fs, kr.path)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if !info.IsDir() && filepath.Ext(info.Name()) == ".pem" && !want[info.Name()] {
+			if err := kr.fs.Remove(filepath.Join(kr.path, info.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Add adds a [Peer]. Adding a Peer that is already there does nothing.
+func (kr *Keyring) Add(peer Peer) error {
+	if peer.IsZero() {
+		return ErrBadKey
+	}
+	kr.peers[peer.ToHex()] = peer
+	return nil
+}
+
+// Remove removes a [Peer]
+func (kr *Keyring) Remove(peer Peer) error {
+	if _, ok := kr.peers[peer.ToHex()]; !ok {
+		return ErrNotFound
+	}
+	delete(kr.peers, peer.ToHex())
+	delete(kr.valid, peer.ToHex())
+	maps.DeleteFunc(kr.subs, func(_ string, sk Subkey) bool {
+		return sk.Identity.Equal(peer)
+	})
+	return nil
+}
+
+// AddValidity records the validity period of a [Peer], after checking that the Peer signed it.
+// Only the most recently created validity is kept. One older than the validity already known is refused,
+// so that a superseded period cannot be slipped back in.
+func (kr *Keyring) AddValidity(peer Peer, v Validity) error {
+	if err := v.Verify(peer); err != nil {
+		return err
+	}
+	if known, ok := kr.valid[peer.ToHex()]; ok && v.Created.Before(known.Created) {
+		return fmt.Errorf("%w: created %s, before the one already known", ErrBadValidity, v.Created.Format(time.RFC3339))
+	}
+	kr.valid[peer.ToHex()] = v
+	return nil
+}
+
+// Validity returns the validity period of a [Peer], if it is known
+func (kr *Keyring) Validity(peer Peer) (Validity, bool) {
+	v, ok := kr.valid[peer.ToHex()]
+	return v, ok
+}
+
+// ValidityFromHeaders reads the validity period of a [Peer] from the PEM headers of its public key, like [ValidityFromHeaders],
+// but also consults the keyring. Of the two, the most recently created is returned.
+// Headers that have lost a validity period that the keyring knows of are refused,
+// so that stripping them cannot make an expired key look valid forever.
+func (kr *Keyring) ValidityFromHeaders(peer Peer, hdrs map[string]string) (*Validity, error) {
+	v, err := ValidityFromHeaders(hdrs)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		if err := v.Verify(peer); err != nil {
+			return nil, err
+		}
+	}
+	known, ok := kr.Validity(peer)
+	switch {
+	case !ok:
+		return v, nil
+	case v == nil:
+		return nil, fmt.Errorf("%w: %s had a validity period, and it is missing", ErrBadValidity, peer.Nickname())
+	case v.Created.Before(known.Created):
+		return &known, nil
+	default:
+		return v, nil
+	}
+}
+
+// AddSubkey adds a [Subkey], after checking that its identity certified it
+func (kr *Keyring) AddSubkey(sk Subkey) error {
+	if err := sk.Verify(); err != nil {
+		return err
+	}
+	kr.subs[sk.ID()] = sk
+	return nil
+}
+
+// Subkeys returns the [Subkey]s certified by peer, oldest first
+func (kr *Keyring) Subkeys(peer Peer) []Subkey {
+	subs := make([]Subkey, 0)
+	for _, sk := range kr.subs {
+		if sk.Identity.Equal(peer) {
+			subs = append(subs, sk)
+		}
+	}
+	slices.SortFunc(subs, func(a, b Subkey) int {
+		if c := a.Validity.Created.Compare(b.Validity.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID(), b.ID())
+	})
+	return subs
+}
+
+// NewestSubkey returns the newest [Subkey] of peer that is valid at t
+func (kr *Keyring) NewestSubkey(peer Peer, t time.Time) (Subkey, error) {
+	return NewestSubkey(peer, kr.Subkeys(peer), t)
+}
+
+// Has reports whether a [Peer] is in the keyring
+func (kr *Keyring) Has(peer Peer) bool {
+	_, ok := kr.peers[peer.ToHex()]
+	return ok
+}
+
+// AddCertification adds a [Certification], after checking its signature.
+func (kr *Keyring) AddCertification(msg *Message) error {
+	cert, err := ParseCertification(msg)
+	if err != nil {
+		return err
+	}
+	kr.certs[fmt.Sprintf("%x", msg.Sig[:16])] = cert
+	return nil
+}
+
+// Certifications returns all [Certification]s
+func (kr *Keyring) Certifications() []Certification {
+	certs := make([]Certification, 0, len(kr.certs))
+	for _, k := range slices.Sorted(maps.Keys(kr.certs)) {
+		certs = append(certs, kr.certs[k])
+	}
+	return certs
+}
+
+// TrustPath evaluates whether target is trusted, using the [Certification]s in the keyring.
+// Certifications made by or for a revoked key are not followed, and a revoked target is never trusted.
+func (kr *Keyring) TrustPath(t Trust, target Peer) ([]Peer, error) {
+	if rev, revoked := kr.Revoked(target); revoked {
+		return nil, fmt.Errorf("%w: %s is revoked (%s)", ErrUntrusted, target.Nickname(), rev.Reason)
+	}
+	certs := slices.DeleteFunc(kr.Certifications(), func(c Certification) bool {
+		_, certifierRevoked := kr.Revoked(c.Certifier)
+		_, certifiedRevoked := kr.Revoked(c.Certified)
+		return certifierRevoked || certifiedRevoked
+	})
+	return t.Path(certs, target)
+}
+
+// AddRevocation adds a [Revocation], after checking that it was signed by the key it revokes.
+func (kr *Keyring) AddRevocation(msg *Message) error {
+	rev, err := ParseRevocation(msg)
+	if err != nil {
+		return err
+	}
+	kr.revs[rev.Key.Fingerprint()] = rev
+	return nil
+}
+
+// Revoked returns the [Revocation] of peer, if there is one
+func (kr *Keyring) Revoked(peer Peer) (Revocation, bool) {
+	rev, ok := kr.revs[peer.Fingerprint()]
+	return rev, ok
+}
+
+// Revocations returns all [Revocation]s
+func (kr *Keyring) Revocations() []Revocation {
+	revs := make([]Revocation, 0, len(kr.revs))
+	for _, k := range slices.Sorted(maps.Keys(kr.revs)) {
+		revs = append(revs, kr.revs[k])
+	}
+	return revs
+}
+
+// Verify verifies the signature on a [Message], and checks the signer against the revocations in the keyring,
+// and against the signer's validity period if it is known.
+func (kr *Keyring) Verify(msg *Message) error {
+	if err := msg.VerifyAgainst(kr.Revocations()...); err != nil {
+		return err
+	}
+	if v, ok := kr.Validity(msg.SenderKey); ok {
+		return msg.VerifyWithin(v)
+	}
+	return nil
+}
+
+// List returns all [Peer]s, ordered by nickname
+func (kr *Keyring) List() []Peer {
+	peers := slices.Collect(maps.Values(kr.peers))
+	slices.SortFunc(peers, func(a, b Peer) int {
+		if c := strings.Compare(a.Nickname(), b.Nickname()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ToHex(), b.ToHex())
+	})
+	return peers
+}
+
+// one returns the only Peer that matches, or an error
+func (kr *Keyring) one(query string, match func(Peer) bool) (Peer, error) {
+	var found []Peer
+	for _, peer := range kr.List() {
+		if match(peer) {
+			found = append(found, peer)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Peer{}, fmt.Errorf("%w: %q", ErrNotFound, query)
+	case 1:
+		return found[0], nil
+	default:
+		return Peer{}, fmt.Errorf("%w: %q matches %d keys", ErrAmbiguous, query, len(found))
+	}
+}
+
+// ByNickname looks up a [Peer] by nickname
+func (kr *Keyring) ByNickname(nick string) (Peer, error) {
+	return kr.one(nick, func(p Peer) bool {
+		return p.Nickname() == nick
+	})
+}
+
+// ByFingerprint looks up a [Peer] by fingerprint
+func (kr *Keyring) ByFingerprint(fp string) (Peer, error) {
+	fp = strings.ToLower(fp)
+	return kr.one(fp, func(p Peer) bool {
+		return p.Fingerprint() == fp
+	})
+}
+
+// ByPrefix looks up a [Peer] by a prefix of its hex encoding
+func (kr *Keyring) ByPrefix(prefix string) (Peer, error) {
+	if len(prefix) < MinPrefixLen {
+		return Peer{}, fmt.Errorf("%w: prefix %q is shorter than %d", ErrAmbiguous, prefix, MinPrefixLen)
+	}
+	prefix = strings.ToLower(prefix)
+	return kr.one(prefix, func(p Peer) bool {
+		return strings.HasPrefix(p.ToHex(), prefix)
+	})
+}
+
+// Lookup finds a [Peer] by nickname, fingerprint, or key prefix, in that order
+func (kr *Keyring) Lookup(query string) (Peer, error) {
+	lookups := []func(string) (Peer, error){kr.ByNickname, kr.ByFingerprint}
+	if len(query) >= MinPrefixLen {
+		lookups = append(lookups, kr.ByPrefix)
+	}
+	for _, by := range lookups {
+		peer, err := by(query)
+		if !errors.Is(err, ErrNotFound) {
+			return peer, err
+		}
+	}
+	return Peer{}, fmt.Errorf("%w: %q", ErrNotFound, query)
+}
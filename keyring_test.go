@@ -0,0 +1,160 @@
+package delphi
+
+import (
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring(t *testing.T) {
+
+	alice := NewPrincipal(randy).PublicKey()
+	bob := NewPrincipal(randy).PublicKey()
+
+	for name, path := range map[string]string{"file": "ring/keyring.pem", "directory": "ring/keys/"} {
+		t.Run(name, func(t *testing.T) {
+
+			fsys := afero.NewMemMapFs()
+
+			kr, err := OpenKeyring(fsys, path)
+			assert.NoError(t, err)
+			assert.Empty(t, kr.List())
+
+			assert.NoError(t, kr.Add(alice))
+			assert.NoError(t, kr.Add(bob))
+			assert.NoError(t, kr.Add(bob))
+			assert.ErrorIs(t, kr.Add(Peer{}), ErrBadKey)
+			assert.NoError(t, kr.Save())
+
+			//	re-open from storage
+			kr, err = OpenKeyring(fsys, path)
+			assert.NoError(t, err)
+			assert.Len(t, kr.List(), 2)
+			assert.True(t, kr.Has(alice))
+
+			got, err := kr.ByNickname(alice.Nickname())
+			assert.NoError(t, err)
+			assert.Equal(t, alice, got)
+
+			got, err = kr.ByFingerprint(bob.Fingerprint())
+			assert.NoError(t, err)
+			assert.Equal(t, bob, got)
+
+			got, err = kr.ByPrefix(bob.ToHex()[:10])
+			assert.NoError(t, err)
+			assert.Equal(t, bob, got)
+
+			got, err = kr.Lookup(alice.ToHex()[:12])
+			assert.NoError(t, err)
+			assert.Equal(t, alice, got)
+
+			_, err = kr.Lookup("no-such-peer")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			_, err = kr.ByPrefix("ab")
+			assert.ErrorIs(t, err, ErrAmbiguous)
+
+			assert.NoError(t, kr.Remove(alice))
+			assert.ErrorIs(t, kr.Remove(alice), ErrNotFound)
+			assert.NoError(t, kr.Save())
+
+			kr, err = OpenKeyring(fsys, path)
+			assert.NoError(t, err)
+			assert.Equal(t, []Peer{bob}, kr.List())
+		})
+	}
+
+	t.Run("import a zero key", func(t *testing.T) {
+		kr, _ := OpenKeyring(afero.NewMemMapFs(), "keyring.pem")
+		zero := pem.EncodeToMemory(&pem.Block{Type: string(Pubkey), Bytes: make([]byte, SubKeySize*2)})
+		assert.ErrorIs(t, kr.Import(zero), ErrBadKey)
+		assert.Empty(t, kr.List())
+	})
+
+	t.Run("newest validity wins", func(t *testing.T) {
+		carol := NewPrincipal(randy)
+		kr, _ := OpenKeyring(afero.NewMemMapFs(), "keyring.pem")
+		assert.NoError(t, kr.Add(carol.PublicKey()))
+
+		lastYear := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+		old := carol.SignValidity(Validity{Created: lastYear, NotBefore: lastYear, NotAfter: lastYear.Add(time.Hour)})
+		current := carol.NewValidity(time.Hour)
+		assert.NoError(t, kr.AddValidity(carol.PublicKey(), current))
+		assert.ErrorIs(t, kr.AddValidity(carol.PublicKey(), old), ErrBadValidity)
+		got, _ := kr.Validity(carol.PublicKey())
+		assert.Equal(t, current, got)
+
+		//	a newer one replaces it
+		newer := carol.SignValidity(Validity{Created: current.Created.Add(time.Minute), NotBefore: current.NotBefore})
+		assert.NoError(t, kr.AddValidity(carol.PublicKey(), newer))
+		got, _ = kr.Validity(carol.PublicKey())
+		assert.Equal(t, newer, got)
+	})
+
+	t.Run("validity from headers", func(t *testing.T) {
+		carol := NewPrincipal(randy)
+		kr, _ := OpenKeyring(afero.NewMemMapFs(), "keyring.pem")
+		assert.NoError(t, kr.Add(carol.PublicKey()))
+		blk, _ := carol.PublicKey().MarshalPEM()
+
+		//	nothing known, nothing claimed
+		v, err := kr.ValidityFromHeaders(carol.PublicKey(), blk.Headers)
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+
+		lastYear := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+		expired := carol.SignValidity(Validity{Created: lastYear, NotBefore: lastYear, NotAfter: lastYear.Add(time.Hour)})
+		assert.NoError(t, kr.AddValidity(carol.PublicKey(), expired))
+
+		//	stripped headers are refused
+		_, err = kr.ValidityFromHeaders(carol.PublicKey(), blk.Headers)
+		assert.ErrorIs(t, err, ErrBadValidity)
+
+		//	older headers give way to the keyring, and newer ones win
+		older := carol.SignValidity(Validity{Created: lastYear.Add(-time.Hour), NotBefore: lastYear.Add(-time.Hour)})
+		older.SetHeaders(blk.Headers)
+		v, err = kr.ValidityFromHeaders(carol.PublicKey(), blk.Headers)
+		assert.NoError(t, err)
+		assert.Equal(t, expired, *v)
+
+		current := carol.NewValidity(time.Hour)
+		current.SetHeaders(blk.Headers)
+		v, err = kr.ValidityFromHeaders(carol.PublicKey(), blk.Headers)
+		assert.NoError(t, err)
+		assert.Equal(t, current, *v)
+
+		//	headers signed by someone else are refused
+		forged := NewPrincipal(randy).NewValidity(0)
+		forged.SetHeaders(blk.Headers)
+		_, err = kr.ValidityFromHeaders(carol.PublicKey(), blk.Headers)
+		assert.ErrorIs(t, err, ErrBadValidity)
+	})
+
+	t.Run("storage that cannot be read", func(t *testing.T) {
+		for _, path := range []string{"ring/keyring.pem", "ring/keys/"} {
+			_, err := OpenKeyring(brokenFs{afero.NewMemMapFs()}, path)
+			assert.ErrorIs(t, err, errBrokenFs, path)
+		}
+	})
+
+}
+
+var errBrokenFs = errors.New("broken file system")
+
+// brokenFs fails to look at anything
+type brokenFs struct {
+	afero.Fs
+}
+
+func (brokenFs) Stat(string) (fs.FileInfo, error) {
+	return nil, errBrokenFs
+}
+
+func (brokenFs) Open(string) (afero.File, error) {
+	return nil, errBrokenFs
+}
@@ -1,10 +1,15 @@
 package delphi
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"iter"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // a KV is a simple map with some super powers useful to us
@@ -18,28 +23,187 @@ func (kv KV) Get(keyspace string, key string) string {
 	return kv[fmt.Sprintf("%s/%s", keyspace, key)]
 }
 
+func (kv KV) Delete(keyspace string, key string) {
+	delete(kv, fmt.Sprintf("%s/%s", keyspace, key))
+}
+
+var ErrNoHeader = errors.New("no such header")
+var ErrBadHeader = errors.New("bad header")
+
+// Typed values are stored as strings, so that they read the same in PEM headers and in AAD:
+// bytes and keys are standard base64, integers are decimal, times are RFC 3339 in UTC,
+// and durations are as written by [time.Duration.String].
+
+func (kv KV) SetBytes(keyspace string, key string, val []byte) {
+	kv.Set(keyspace, key, base64.StdEncoding.EncodeToString(val))
+}
+
+func (kv KV) GetBytes(keyspace string, key string) ([]byte, error) {
+	return kv.bytesAt(fmt.Sprintf("%s/%s", keyspace, key))
+}
+
+func (kv KV) SetInt(keyspace string, key string, val int64) {
+	kv.Set(keyspace, key, strconv.FormatInt(val, 10))
+}
+
+func (kv KV) GetInt(keyspace string, key string) (int64, error) {
+	name, val, err := kv.lookup(keyspace, key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %w", ErrBadHeader, name, err)
+	}
+	return n, nil
+}
+
+func (kv KV) SetTime(keyspace string, key string, val time.Time) {
+	kv.Set(keyspace, key, val.UTC().Format(time.RFC3339))
+}
+
+func (kv KV) GetTime(keyspace string, key string) (time.Time, error) {
+	name, val, err := kv.lookup(keyspace, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s: %w", ErrBadHeader, name, err)
+	}
+	return t, nil
+}
+
+func (kv KV) SetDuration(keyspace string, key string, val time.Duration) {
+	kv.Set(keyspace, key, val.String())
+}
+
+func (kv KV) GetDuration(keyspace string, key string) (time.Duration, error) {
+	name, val, err := kv.lookup(keyspace, key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %w", ErrBadHeader, name, err)
+	}
+	return d, nil
+}
+
+func (kv KV) SetKey(keyspace string, key string, val Key) {
+	kv.SetBytes(keyspace, key, val.Bytes())
+}
+
+func (kv KV) GetKey(keyspace string, key string) (Key, error) {
+	return kv.keyAt(fmt.Sprintf("%s/%s", keyspace, key))
+}
+
+// lookup returns the full name of a header and its value, or [ErrNoHeader]
+func (kv KV) lookup(keyspace string, key string) (string, string, error) {
+	name := fmt.Sprintf("%s/%s", keyspace, key)
+	val, exists := kv[name]
+	if !exists {
+		return name, "", fmt.Errorf("%w: %s", ErrNoHeader, name)
+	}
+	return name, val, nil
+}
+
+// bytesAt decodes the base64 value of the header called name, which may be outside of any keyspace
+func (kv KV) bytesAt(name string) ([]byte, error) {
+	val, exists := kv[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrNoHeader, name)
+	}
+	b, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrBadHeader, name, err)
+	}
+	return b, nil
+}
+
+// keyAt decodes the [Key] in the header called name, checking its length
+func (kv KV) keyAt(name string) (Key, error) {
+	b, err := kv.bytesAt(name)
+	if err != nil {
+		return Key{}, err
+	}
+	if len(b) != 2*SubKeySize {
+		return Key{}, fmt.Errorf("%w: %s: wrong length. wanted %d but got %d", ErrBadHeader, name, 2*SubKeySize, len(b))
+	}
+	return KeyFromBytes(b), nil
+}
+
+// kvMagic starts a KV in binary form, and cannot start the legacy form, whose first byte is part of a key
+const kvMagic = "\x00kv2"
+
+// limits on what a KV in binary form may contain
+const (
+	MaxKVPairs  = 1024
+	MaxKVLength = 1 << 16
+)
+
+var ErrBadKV = errors.New("bad KV")
+
+// MarshalBinary encodes a KV unambiguously, as the magic "\x00kv2", the number of pairs,
+// then each key and value in lexical order of keys. Counts and lengths are unsigned varints.
 func (kv KV) MarshalBinary() ([]byte, error) {
-	lines := make([]string, 0)
+	buf := new(bytes.Buffer)
+	buf.WriteString(kvMagic)
+	putUvarint(buf, uint64(len(kv)))
 	for k, v := range kv.LexicalOrder() {
-		lines = append(lines, k)
-		lines = append(lines, v)
+		putBytes(buf, []byte(k))
+		putBytes(buf, []byte(v))
 	}
-	everything := strings.Join(lines, "\n")
-	return []byte(everything), nil
+	return buf.Bytes(), nil
 }
 
+// UnmarshalBinary decodes a KV encoded by [KV.MarshalBinary]. Anything malformed, over the limits,
+// out of order, duplicated, or followed by trailing bytes, is refused.
 func (kv *KV) UnmarshalBinary(b []byte) error {
-	m := *kv
-	everything := string(b)
-	lines := strings.Split(everything, "\n")
-	for i := 0; i < len(lines)/2; i = i + 2 {
-		k := lines[i]
-		v := lines[i+1]
-		m[k] = v
+	if !bytes.HasPrefix(b, []byte(kvMagic)) {
+		return fmt.Errorf("%w: not a binary KV", ErrBadKV)
+	}
+	r := bytes.NewReader(b[len(kvMagic):])
+	n, err := getCount(r, MaxKVPairs)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadKV, err)
+	}
+	m := make(KV, n)
+	prev := ""
+	for i := range n {
+		k, err := getBytes(r, MaxKVLength)
+		if err != nil {
+			return fmt.Errorf("%w: key %d: %w", ErrBadKV, i, err)
+		}
+		v, err := getBytes(r, MaxKVLength)
+		if err != nil {
+			return fmt.Errorf("%w: value %d: %w", ErrBadKV, i, err)
+		}
+		if i > 0 && string(k) <= prev {
+			return fmt.Errorf("%w: key %q is duplicated or out of order", ErrBadKV, k)
+		}
+		prev = string(k)
+		m[string(k)] = string(v)
 	}
+	if r.Len() > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrBadKV, r.Len())
+	}
+	*kv = m
 	return nil
 }
 
+// marshalLegacy is the original, ambiguous, encoding: keys and values joined by newlines.
+// It is kept only to authenticate messages that were encrypted with it.
+func (kv KV) marshalLegacy() []byte {
+	lines := make([]string, 0)
+	for k, v := range kv.LexicalOrder() {
+		lines = append(lines, k)
+		lines = append(lines, v)
+	}
+	everything := strings.Join(lines, "\n")
+	return []byte(everything)
+}
+
 // LexicolOrder ranges through a KV in lexical order
 func (kv KV) LexicalOrder() iter.Seq2[string, string] {
 	keys := make([]string, 0, len(kv))
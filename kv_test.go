@@ -0,0 +1,168 @@
+package delphi
+
+import (
+	"encoding/pem"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKV_MarshalBinary(t *testing.T) {
+
+	t.Run("round trip", func(t *testing.T) {
+		for name, kv := range map[string]KV{
+			"empty":    {},
+			"simple":   {"foo": "bar", "bing": "bat", "delphi/version": "v1"},
+			"newlines": {"foo\nbar": "bing\nbat", "multi": "line one\nline two\n"},
+			"empties":  {"": "", "nothing": ""},
+		} {
+			t.Run(name, func(t *testing.T) {
+				bin, err := kv.MarshalBinary()
+				assert.NoError(t, err)
+				got := KV{}
+				err = got.UnmarshalBinary(bin)
+				assert.NoError(t, err)
+				assert.Equal(t, kv, got)
+			})
+		}
+	})
+
+	t.Run("unambiguous", func(t *testing.T) {
+		a := KV{"a": "b\nc", "d": "e"}
+		b := KV{"a": "b", "c\nd": "e"}
+		binA, _ := a.MarshalBinary()
+		binB, _ := b.MarshalBinary()
+		assert.NotEqual(t, binA, binB)
+		assert.Equal(t, a.marshalLegacy(), b.marshalLegacy())
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		good, _ := KV{"a": "1", "b": "2"}.MarshalBinary()
+		for name, bin := range map[string][]byte{
+			"empty":          {},
+			"legacy":         KV{"a": "1"}.marshalLegacy(),
+			"truncated":      good[:len(good)-1],
+			"trailing":       append(append([]byte{}, good...), 0),
+			"out of order":   []byte(kvMagic + "\x02\x01b\x012\x01a\x011"),
+			"duplicate":      []byte(kvMagic + "\x02\x01a\x011\x01a\x012"),
+			"too many":       []byte(kvMagic + "\xff\xff\xff\xff\x0f"),
+			"too long":       []byte(kvMagic + "\x01\xff\xff\xff\xff\x0f"),
+			"short on pairs": []byte(kvMagic + "\x03\x01a\x011"),
+		} {
+			t.Run(name, func(t *testing.T) {
+				kv := KV{}
+				err := kv.UnmarshalBinary(bin)
+				assert.ErrorIs(t, err, ErrBadKV)
+			})
+		}
+	})
+
+}
+
+func TestKV_AAD(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	t.Run("headers with newlines", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		msg.Headers["a"] = "b\nc"
+		msg.Headers["d"] = "e"
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), nil))
+
+		//	an attacker shuffles the newline into another header. The legacy AAD would be the same.
+		delete(msg.Headers, "a")
+		delete(msg.Headers, "d")
+		msg.Headers["a"] = "b"
+		msg.Headers["c\nd"] = "e"
+		assert.Error(t, bob.Decrypt(msg, nil))
+	})
+
+	t.Run("legacy cipher text still decrypts", func(t *testing.T) {
+		b, err := os.ReadFile("testdata/falling-grass.pem")
+		assert.NoError(t, err)
+		p, _ := pem.Decode(b)
+		var grass Principal
+		assert.NoError(t, grass.UnmarshalPEM(*p))
+
+		b, err = os.ReadFile("testdata/message.cypher.pem")
+		assert.NoError(t, err)
+		p, _ = pem.Decode(b)
+		msg := new(Message)
+		assert.NoError(t, msg.FromPEM(*p))
+		assert.Empty(t, msg.Headers.Get(Keyspace, aadHeader))
+		assert.NoError(t, grass.Decrypt(msg, nil))
+		assert.NotEmpty(t, msg.PlainText)
+	})
+
+}
+
+func TestKV_Typed(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	when := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	kv := KV{}
+	kv.SetBytes("test", "bytes", []byte("hello\nworld"))
+	kv.SetInt("test", "int", -42)
+	kv.SetTime("test", "time", when.In(time.FixedZone("elsewhere", 3600)))
+	kv.SetDuration("test", "duration", 90*time.Minute)
+	kv.SetKey("test", "key", alice.PublicKey())
+
+	t.Run("round trip", func(t *testing.T) {
+		b, err := kv.GetBytes("test", "bytes")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("hello\nworld"), b)
+		n, err := kv.GetInt("test", "int")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-42), n)
+		tm, err := kv.GetTime("test", "time")
+		assert.NoError(t, err)
+		assert.True(t, when.Equal(tm))
+		assert.Equal(t, "2025-03-14T15:09:26Z", kv.Get("test", "time"))
+		d, err := kv.GetDuration("test", "duration")
+		assert.NoError(t, err)
+		assert.Equal(t, 90*time.Minute, d)
+		k, err := kv.GetKey("test", "key")
+		assert.NoError(t, err)
+		assert.Equal(t, alice.PublicKey(), k)
+	})
+
+	t.Run("same in PEM and AAD", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		for k, v := range kv {
+			msg.Headers[k] = v
+		}
+		got := new(Message)
+		assert.NoError(t, got.FromPEM(toPEM(t, msg)))
+		n, err := got.Headers.GetInt("test", "int")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-42), n)
+		for k, v := range kv {
+			assert.Equal(t, v, got.Headers[k])
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := kv.GetInt("test", "nothing")
+		assert.ErrorIs(t, err, ErrNoHeader)
+		_, err = kv.GetKey("test", "nothing")
+		assert.ErrorIs(t, err, ErrNoHeader)
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		_, err := kv.GetInt("test", "duration")
+		assert.ErrorIs(t, err, ErrBadHeader)
+		_, err = kv.GetTime("test", "int")
+		assert.ErrorIs(t, err, ErrBadHeader)
+		_, err = kv.GetDuration("test", "time")
+		assert.ErrorIs(t, err, ErrBadHeader)
+		_, err = kv.GetBytes("test", "time")
+		assert.ErrorIs(t, err, ErrBadHeader)
+		_, err = kv.GetKey("test", "bytes")
+		assert.ErrorIs(t, err, ErrBadHeader)
+	})
+
+}
@@ -4,12 +4,13 @@ import (
 	"crypto"
 	"crypto/ecdh"
 	"crypto/ed25519"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"time"
 
 	"github.com/sean9999/pear"
 )
@@ -33,6 +34,7 @@ type Message struct {
 	CipherText   []byte  `msgpack:"ciph" json:"ciph"`
 	PlainText    []byte  `msgpack:"plain" json:"plain"`
 	Sig          []byte  `msgpack:"sig" json:"sig"`
+	Slots        []Slot  `msgpack:"slots" json:"slots"` // wrapped content keys, for multi-recipient messages
 }
 
 // RecipientEncryption() returns the recipient as a public encryption key (ECDH)
@@ -67,6 +69,30 @@ func (msg *Message) Signatory() crypto.PublicKey {
 	return k
 }
 
+// stampVersion records the wire and digest versions in the headers before they are authenticated,
+// so that the same headers are present once the [Message] has been through PEM.
+func (msg *Message) stampVersion() {
+	if msg.Headers == nil {
+		msg.Headers = make(KV)
+	}
+	msg.Headers.Set(Keyspace, "version", Version)
+	msg.Headers.Set(Keyspace, digestHeader, DigestV2)
+	msg.Headers.Set(Keyspace, aadHeader, aadV2)
+}
+
+// the header that says how the other headers are encoded as AAD.
+// Messages without it were encrypted with the legacy encoding.
+const aadHeader = "aad"
+const aadV2 = "v2"
+
+// aad encodes the headers, which are the additional authenticated data for encryption
+func (msg *Message) aad() ([]byte, error) {
+	if msg.Headers.Get(Keyspace, aadHeader) == aadV2 {
+		return msg.Headers.MarshalBinary()
+	}
+	return msg.Headers.marshalLegacy(), nil
+}
+
 // ensureNonce ensures the Message has a [Nonce], and returns it.
 func (msg *Message) ensureNonce(randy io.Reader) Nonce {
 	if !msg.Nonce.IsZero() {
@@ -84,14 +110,6 @@ func (msg *Message) ensureNonce(randy io.Reader) Nonce {
 	return msg.Nonce
 }
 
-// func (msg *Message) MarshalBinary() ([]byte, error) {
-// 	return msgpack.Marshal(msg)
-// }
-
-// func (msg *Message) UnmarshalBinary(p []byte) error {
-// 	return msgpack.Unmarshal(p, msg)
-// }
-
 // type msgBody struct {
 // 	To    Key    `json:"to,omitzero,format:hex"`
 // 	From  Key    `json:"from,omitzero,format:hex"`
@@ -119,22 +137,8 @@ func (msg *Message) ensureNonce(randy io.Reader) Nonce {
 // 	b, err := hex.DecodeString(val)
 // }
 
-func extractB64(hdrs map[string]string, key string) ([]byte, error) {
-
-	val, exists := hdrs[key]
-	if !exists {
-		return nil, pear.Errorf("key %q exist", key)
-	}
-
-	b, err := base64.StdEncoding.DecodeString(val)
-	if err != nil {
-		return nil, pear.Errorf("failed to extract: %w", err)
-	}
-
-	return b, nil
-}
-
-func (msg *Message) ToPEM() pem.Block {
+// ToPEM encodes a [Message] as a PEM. It fails on a Message whose slots are malformed.
+func (msg *Message) ToPEM() (pem.Block, error) {
 
 	//	ensure message type is correct
 	var body []byte
@@ -144,8 +148,12 @@ func (msg *Message) ToPEM() pem.Block {
 		body = msg.PlainText
 	}
 
-	hdrs := msg.Headers
-	hdrs["delphi/version"] = "v1"
+	//	transport headers must not leak back into msg.Headers, which is AAD
+	hdrs := maps.Clone(msg.Headers)
+	if hdrs == nil {
+		hdrs = make(KV)
+	}
+	hdrs[fmt.Sprintf("%s/%s", Keyspace, "version")] = Version
 
 	if !msg.RecipientKey.IsZero() {
 		hdrs["to"] = base64.StdEncoding.EncodeToString(msg.RecipientKey.Bytes())
@@ -162,47 +170,63 @@ func (msg *Message) ToPEM() pem.Block {
 	if len(msg.Sig) > 0 {
 		hdrs["sig"] = base64.StdEncoding.EncodeToString(msg.Sig)
 	}
+	if err := slotsToPEM(msg.Slots, hdrs); err != nil {
+		return pem.Block{}, fmt.Errorf("%w: %w", ErrInvalidMsg, err)
+	}
 
 	p := pem.Block{
 		Type:    string(msg.Subject),
 		Headers: hdrs,
 		Bytes:   body,
 	}
-	return p
+	return p, nil
 }
 
 func (msg *Message) FromPEM(p pem.Block) error {
 
 	msg.Headers = make(KV)
 
-	for k, v := range p.Headers {
+	slots, err := slotsFromPEM(p.Headers)
+	if err != nil {
+		return err
+	}
+	msg.Slots = slots
+
+	hdrs := KV(p.Headers)
+	for k, v := range hdrs {
+		if isSlotHeader(k) {
+			continue
+		}
 		switch k {
 		case "nonce":
-			bin, err := extractB64(p.Headers, "nonce")
+			bin, err := hdrs.bytesAt("nonce")
 			if err != nil {
 				return err
 			}
+			if len(bin) != NonceSize {
+				return fmt.Errorf("%w: nonce: wrong length. wanted %d but got %d", ErrBadHeader, NonceSize, len(bin))
+			}
 			msg.Nonce = Nonce(bin)
 		case "sig":
-			bin, err := extractB64(p.Headers, "sig")
+			bin, err := hdrs.bytesAt("sig")
 			if err != nil {
 				return err
 			}
 			msg.Sig = bin
 		case "from":
-			pubKeyBytes, err := extractB64(p.Headers, "from")
+			from, err := hdrs.keyAt("from")
 			if err != nil {
 				return err
 			}
-			msg.SenderKey = Key{}.From(pubKeyBytes)
+			msg.SenderKey = from
 		case "to":
-			pubKeyBytes, err := extractB64(p.Headers, "to")
+			to, err := hdrs.keyAt("to")
 			if err != nil {
 				return err
 			}
-			msg.RecipientKey = Key{}.From(pubKeyBytes)
+			msg.RecipientKey = to
 		case "eph":
-			bin, err := extractB64(p.Headers, "eph")
+			bin, err := hdrs.bytesAt("eph")
 			if err != nil {
 				return err
 			}
@@ -226,15 +250,22 @@ func (msg *Message) FromPEM(p pem.Block) error {
 	return nil
 }
 
+// String is the [Message] as a PEM, or the reason it can not be one
 func (msg *Message) String() string {
-	p := msg.ToPEM()
+	p, err := msg.ToPEM()
+	if err != nil {
+		return err.Error()
+	}
 	pemBytes := pem.EncodeToMemory(&p)
 	return string(pemBytes)
 }
 
 func (msg *Message) Read(b []byte) (int, error) {
 	if msg.readBuffer == nil {
-		p := msg.ToPEM()
+		p, err := msg.ToPEM()
+		if err != nil {
+			return 0, err
+		}
 		msg.readBuffer = pem.EncodeToMemory(&p)
 	}
 	if len(msg.readBuffer) > 0 {
@@ -279,14 +310,9 @@ var ErrInvalidMsg = pear.Defer("invalid message")
 var ErrNoNonce = pear.Defer("zero value nonce")
 var ErrNoSender = pear.Defer("no sender")
 
-// Digest returns a hash of the Message fields which should be hashed.
+// Digest returns a hash of the Message fields which should be hashed, according to its [Message.DigestVersion].
 func (msg *Message) Digest() ([]byte, error) {
 
-	//	Some fields are included. Some are required. Some are intentionally omitted.
-	//	TODO: Consider if SenderKey belongs here.
-
-	hash := sha256.New()
-
 	if !msg.Valid() {
 		return nil, ErrInvalidMsg
 	}
@@ -296,22 +322,14 @@ func (msg *Message) Digest() ([]byte, error) {
 	if msg.SenderKey.IsZero() {
 		return nil, ErrNoSender
 	}
-
-	sum := make([]byte, 0)
-	sum = append(sum, msg.SenderKey.Bytes()...)
-	sum = append(sum, msg.Nonce[:]...)
-	if msg.Encrypted() {
-		sum = append(sum, msg.CipherText...)
-	} else {
-		sum = append(sum, msg.PlainText...)
+	if err := checkDigestVersion(msg.DigestVersion()); err != nil {
+		return nil, err
 	}
 
-	for k, v := range msg.Headers.LexicalOrder() {
-		sum = append(sum, []byte(k)...)
-		sum = append(sum, []byte(v)...)
+	if msg.DigestVersion() == DigestV1 {
+		return msg.digestV1(), nil
 	}
-
-	return hash.Sum(sum), nil
+	return msg.digestV2(), nil
 }
 
 var ErrNoSign = pear.Defer("could not sign message")
@@ -324,6 +342,13 @@ func (msg *Message) Sign(randy io.Reader, signer crypto.Signer) error {
 		return pear.New("a source of randomness was not passed in")
 	}
 	msg.ensureNonce(randy)
+	//	the headers of an encrypted message are sealed in as AAD, and cannot change
+	if !msg.Encrypted() {
+		msg.stampVersion()
+		if msg.SignedAt().IsZero() {
+			msg.Headers.SetTime(Keyspace, "signed-at", time.Now())
+		}
+	}
 	digest, err := msg.Digest()
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrNoSign, err)
@@ -337,6 +362,15 @@ func (msg *Message) Sign(randy io.Reader, signer crypto.Signer) error {
 	return nil
 }
 
+// SignedAt returns when the [Message] was signed, as claimed by the signer, or zero if it does not say.
+func (msg *Message) SignedAt() time.Time {
+	t, err := msg.Headers.GetTime(Keyspace, "signed-at")
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
 // Verify verifies the signature on a [Message]
 func (msg *Message) Verify() bool {
 	digest, err := msg.Digest()
@@ -2,6 +2,8 @@ package delphi
 
 import (
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,6 +11,14 @@ import (
 
 var randy = rand.Reader
 
+// toPEM is [Message.ToPEM] for messages that are known to be well formed
+func toPEM(t *testing.T, msg *Message) pem.Block {
+	t.Helper()
+	p, err := msg.ToPEM()
+	assert.NoError(t, err)
+	return p
+}
+
 func TestEncrypt(t *testing.T) {
 
 	sentence := []byte("hello world")
@@ -41,7 +51,7 @@ func TestPEMIdempotent(t *testing.T) {
 		msg1.Headers["bing"] = "bat"
 
 		//	pem 1
-		p1 := msg1.ToPEM()
+		p1 := toPEM(t, msg1)
 
 		//	msg 2
 		msg2 := new(Message)
@@ -49,7 +59,7 @@ func TestPEMIdempotent(t *testing.T) {
 		assert.NoError(t, err)
 
 		//	pem 2
-		p2 := msg2.ToPEM()
+		p2 := toPEM(t, msg2)
 		assert.Equal(t, p2.Type, p1.Type)
 		assert.ElementsMatch(t, p1.Bytes, p2.Bytes)
 		assert.Equal(t, p1.Headers, p2.Headers)
@@ -66,10 +76,10 @@ func TestPEMIdempotent(t *testing.T) {
 		msg.Encrypt(randy, me, them.PublicKey(), nil)
 		assert.Equal(t, EncryptedMessage, msg.Subject)
 
-		p1 := msg.ToPEM()
+		p1 := toPEM(t, msg)
 		msg2 := new(Message)
 		msg2.FromPEM(p1)
-		p2 := msg2.ToPEM()
+		p2 := toPEM(t, msg2)
 
 		assert.Equal(t, msg.Nonce, msg2.Nonce)
 		assert.Equal(t, msg.RecipientKey, msg2.RecipientKey)
@@ -79,6 +89,14 @@ func TestPEMIdempotent(t *testing.T) {
 
 	})
 
+	t.Run("nonce of the wrong length", func(t *testing.T) {
+		p := toPEM(t, ComposeMessage(randy, PlainMessage, sentence))
+		for _, n := range []int{0, NonceSize - 1, NonceSize + 1} {
+			p.Headers["nonce"] = base64.StdEncoding.EncodeToString(make([]byte, n))
+			assert.ErrorIs(t, new(Message).FromPEM(p), ErrBadHeader, n)
+		}
+	})
+
 }
 
 func TestEncrypt_No_Recipient(t *testing.T) {
@@ -0,0 +1,62 @@
+package delphi
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// encryption modes, which say what a successful decryption proves about the sender
+const (
+	// ModeBase proves nothing about the sender. The "from" header can be forged unless the message is also signed.
+	ModeBase = "base"
+	// ModeAuth mixes the sender's static encryption key into the shared secret, so only the sender could have encrypted it.
+	ModeAuth = "auth"
+)
+
+var ErrUnknownMode = errors.New("unknown encryption mode")
+
+// the header that records the encryption mode. It is part of the AAD, so it cannot be altered.
+const modeHeader = "mode"
+
+// Mode returns the encryption mode of a [Message]. Messages that do not say are [ModeBase].
+// Once a Message has been decrypted, its mode can be relied upon.
+func (msg *Message) Mode() string {
+	mode := msg.Headers.Get(Keyspace, modeHeader)
+	if mode == "" {
+		return ModeBase
+	}
+	return mode
+}
+
+// checkMode refuses modes we don't know about
+func checkMode(mode string) error {
+	if !slices.Contains([]string{ModeBase, ModeAuth}, mode) {
+		return fmt.Errorf("%w: %q", ErrUnknownMode, mode)
+	}
+	return nil
+}
+
+// authenticateSecret mixes a static-static Diffie-Hellman into a shared secret.
+// The sender uses its own private key and the recipient's public key, and the recipient does the opposite.
+// Both whole keys are bound in as well, so that neither signing half can be swapped out.
+func authenticateSecret(sharedSec, privKey, counterPartyPubKey []byte, sender, recipient Key) ([]byte, error) {
+	staticScalar, err := curve25519.X25519(privKey, counterPartyPubKey)
+	if err != nil {
+		return nil, err
+	}
+	ikm := slices.Concat(sharedSec, staticScalar)
+	info := slices.Concat([]byte(GLOBAL_SALT+"/"+ModeAuth), sender.Bytes(), recipient.Bytes())
+	h := hkdf.New(sha256.New, ikm, nil, info)
+	authSec := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(h, authSec); err != nil {
+		return nil, err
+	}
+	return authSec, nil
+}
@@ -0,0 +1,70 @@
+package delphi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncrypt_Auth(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	mallory := NewPrincipal(randy)
+
+	msg := alice.ComposeMessage(randy, []byte("hello"))
+	assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Mode: ModeAuth}))
+	assert.Equal(t, ModeAuth, msg.Mode())
+
+	got := new(Message)
+	assert.NoError(t, got.FromPEM(toPEM(t, msg)))
+	assert.NoError(t, bob.Decrypt(got, nil))
+	assert.Equal(t, ModeAuth, got.Mode())
+	assert.Equal(t, []byte("hello"), got.PlainText)
+
+	t.Run("forged sender", func(t *testing.T) {
+		//	mallory encrypts to bob, and claims to be alice
+		msg := mallory.ComposeMessage(randy, []byte("send money"))
+		assert.NoError(t, mallory.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Mode: ModeAuth}))
+		msg.SenderKey = alice.PublicKey()
+		assert.Error(t, bob.Decrypt(msg, nil))
+	})
+
+	t.Run("swapped signing half", func(t *testing.T) {
+		//	the encryption half is really alice's, but the signing half is mallory's
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Mode: ModeAuth}))
+		forged := new(Message)
+		assert.NoError(t, forged.FromPEM(toPEM(t, msg)))
+		forged.SenderKey[1] = mallory.PublicKey().Signing()
+		assert.ErrorIs(t, bob.Decrypt(forged, nil), ErrDecryptionFailed)
+	})
+
+	t.Run("downgrade", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Mode: ModeAuth}))
+		msg.Headers.Set(Keyspace, modeHeader, ModeBase)
+		assert.Error(t, bob.Decrypt(msg, nil))
+	})
+
+	t.Run("base", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), nil))
+		assert.Equal(t, ModeBase, msg.Mode())
+		assert.NoError(t, bob.Decrypt(msg, nil))
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.ErrorIs(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Mode: "psk"}), ErrUnknownMode)
+	})
+
+	t.Run("subkey", func(t *testing.T) {
+		sp, _ := bob.NewSubkey(randy, 0)
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.EncryptToSubkey(randy, msg, sp.Subkey, EncryptOptions{Mode: ModeAuth}))
+		assert.NoError(t, Keychain{Principal: bob, Subkeys: []SubkeyPair{sp}}.Decrypt(msg, nil))
+		assert.Equal(t, ModeAuth, msg.Mode())
+	})
+
+}
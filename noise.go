@@ -0,0 +1,328 @@
+package delphi
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Noise handshake patterns. See https://noiseprotocol.org/noise.html
+const (
+	// NoiseXX sends both static keys during the handshake. Neither side needs to know the other beforehand.
+	NoiseXX = "XX"
+	// NoiseIK is for an initiator that already knows the responder's key. It takes one round trip instead of one and a half.
+	NoiseIK = "IK"
+)
+
+var ErrNoise = errors.New("noise error")
+var ErrHandshake = errors.New("noise handshake failed")
+
+// MaxNoiseMessage is the biggest Noise message, including its authentication tag
+const MaxNoiseMessage = 65535
+
+// the domain of the signature that binds a static X25519 key to an ed25519 identity
+const noiseBindingDomain = GLOBAL_SALT + "/noise/static-key"
+
+// the tokens of a Noise message pattern
+type noiseToken string
+
+const (
+	tokE  noiseToken = "e"
+	tokS  noiseToken = "s"
+	tokEE noiseToken = "ee"
+	tokES noiseToken = "es"
+	tokSE noiseToken = "se"
+	tokSS noiseToken = "ss"
+)
+
+// noisePatterns are the message patterns of each handshake, the initiator's first
+var noisePatterns = map[string][][]noiseToken{
+	NoiseXX: {
+		{tokE},
+		{tokE, tokEE, tokS, tokES},
+		{tokS, tokSE},
+	},
+	NoiseIK: {
+		{tokE, tokES, tokS, tokSS},
+		{tokE, tokEE, tokSE},
+	},
+}
+
+// noiseHKDF is the HKDF of the Noise spec, which returns two outputs
+func noiseHKDF(ck, ikm []byte) ([]byte, []byte) {
+	mac := hmac.New(sha256.New, ck)
+	mac.Write(ikm)
+	temp := mac.Sum(nil)
+	mac = hmac.New(sha256.New, temp)
+	mac.Write([]byte{1})
+	out1 := mac.Sum(nil)
+	mac = hmac.New(sha256.New, temp)
+	mac.Write(out1)
+	mac.Write([]byte{2})
+	return out1, mac.Sum(nil)
+}
+
+// a noiseCipher is the CipherState of the Noise spec
+type noiseCipher struct {
+	k []byte
+	n uint64
+}
+
+func (c *noiseCipher) nonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], c.n)
+	return nonce
+}
+
+func (c *noiseCipher) encrypt(ad, plain []byte) ([]byte, error) {
+	if c.k == nil {
+		return plain, nil
+	}
+	if c.n == ^uint64(0) {
+		return nil, fmt.Errorf("%w: nonces exhausted", ErrNoise)
+	}
+	ct, err := encrypt(c.k, plain, c.nonce(), ad)
+	c.n++
+	return ct, err
+}
+
+func (c *noiseCipher) decrypt(ad, ct []byte) ([]byte, error) {
+	if c.k == nil {
+		return ct, nil
+	}
+	if c.n == ^uint64(0) {
+		return nil, fmt.Errorf("%w: nonces exhausted", ErrNoise)
+	}
+	plain, err := decrypt(c.k, ct, c.nonce(), ad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+	c.n++
+	return plain, nil
+}
+
+// a noiseHandshake is the HandshakeState of the Noise spec, along with its SymmetricState
+type noiseHandshake struct {
+	ck, h     []byte
+	cipher    noiseCipher
+	initiator bool
+	patterns  [][]noiseToken
+	randy     io.Reader
+
+	sPriv, sPub []byte // our static key
+	ePriv, ePub []byte // our ephemeral key
+	rs, re      []byte // their static and ephemeral keys
+}
+
+// newNoiseHandshake initializes a handshake. rs must be set for the initiator of [NoiseIK].
+func newNoiseHandshake(randy io.Reader, pattern string, initiator bool, p Principal, rs []byte, prologue []byte) (*noiseHandshake, error) {
+	patterns, ok := noisePatterns[pattern]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown pattern %q", ErrNoise, pattern)
+	}
+	hs := &noiseHandshake{
+		initiator: initiator,
+		patterns:  patterns,
+		randy:     randy,
+		sPriv:     p.privateEncryptionKey().Bytes(),
+		sPub:      p.PublicKey().Encryption().Bytes(),
+		rs:        rs,
+	}
+	name := []byte("Noise_" + pattern + "_25519_ChaChaPoly_SHA256")
+	if len(name) <= sha256.Size {
+		hs.h = make([]byte, sha256.Size)
+		copy(hs.h, name)
+	} else {
+		sum := sha256.Sum256(name)
+		hs.h = sum[:]
+	}
+	hs.ck = hs.h
+	hs.mixHash(prologue)
+	if pattern == NoiseIK {
+		//	pre-message: <- s
+		if initiator {
+			if len(rs) != SubKeySize {
+				return nil, fmt.Errorf("%w: %s needs the responder's key", ErrNoise, NoiseIK)
+			}
+			hs.mixHash(rs)
+		} else {
+			hs.mixHash(hs.sPub)
+		}
+	}
+	return hs, nil
+}
+
+func (hs *noiseHandshake) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(hs.h)
+	h.Write(data)
+	hs.h = h.Sum(nil)
+}
+
+func (hs *noiseHandshake) mixKey(ikm []byte) {
+	var k []byte
+	hs.ck, k = noiseHKDF(hs.ck, ikm)
+	hs.cipher = noiseCipher{k: k}
+}
+
+func (hs *noiseHandshake) encryptAndHash(plain []byte) ([]byte, error) {
+	ct, err := hs.cipher.encrypt(hs.h, plain)
+	if err != nil {
+		return nil, err
+	}
+	hs.mixHash(ct)
+	return ct, nil
+}
+
+func (hs *noiseHandshake) decryptAndHash(ct []byte) ([]byte, error) {
+	plain, err := hs.cipher.decrypt(hs.h, ct)
+	if err != nil {
+		return nil, err
+	}
+	hs.mixHash(ct)
+	return plain, nil
+}
+
+// mixDH mixes a Diffie-Hellman into the chaining key
+func (hs *noiseHandshake) mixDH(priv, pub []byte) error {
+	out, err := curve25519.X25519(priv, pub)
+	if err != nil {
+		return err
+	}
+	hs.mixKey(out)
+	return nil
+}
+
+// dhToken does the Diffie-Hellman for ee, es, se or ss, from our side
+func (hs *noiseHandshake) dhToken(tok noiseToken) error {
+	//	the first letter is the initiator's key, and the second is the responder's
+	ours, theirs := tok[0], tok[1]
+	if !hs.initiator {
+		ours, theirs = theirs, ours
+	}
+	priv := hs.ePriv
+	if ours == 's' {
+		priv = hs.sPriv
+	}
+	pub := hs.re
+	if theirs == 's' {
+		pub = hs.rs
+	}
+	return hs.mixDH(priv, pub)
+}
+
+// myTurn reports whether it is our turn to write message i
+func (hs *noiseHandshake) myTurn(i int) bool {
+	return (i%2 == 0) == hs.initiator
+}
+
+// writeMessage writes handshake message i, carrying payload
+func (hs *noiseHandshake) writeMessage(i int, payload []byte) ([]byte, error) {
+	out := make([]byte, 0)
+	for _, tok := range hs.patterns[i] {
+		switch tok {
+		case tokE:
+			priv, pub, err := newRatchetKey(hs.randy)
+			if err != nil {
+				return nil, err
+			}
+			hs.ePriv, hs.ePub = priv, pub
+			out = append(out, pub...)
+			hs.mixHash(pub)
+		case tokS:
+			ct, err := hs.encryptAndHash(hs.sPub)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ct...)
+		default:
+			if err := hs.dhToken(tok); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ct, err := hs.encryptAndHash(payload)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, ct...), nil
+}
+
+// readMessage reads handshake message i, and returns its payload
+func (hs *noiseHandshake) readMessage(i int, msg []byte) ([]byte, error) {
+	for _, tok := range hs.patterns[i] {
+		switch tok {
+		case tokE:
+			if len(msg) < SubKeySize {
+				return nil, io.ErrUnexpectedEOF
+			}
+			hs.re, msg = msg[:SubKeySize], msg[SubKeySize:]
+			hs.mixHash(hs.re)
+		case tokS:
+			n := SubKeySize
+			if hs.cipher.k != nil {
+				n += chacha20poly1305.Overhead
+			}
+			if len(msg) < n {
+				return nil, io.ErrUnexpectedEOF
+			}
+			rs, err := hs.decryptAndHash(msg[:n])
+			if err != nil {
+				return nil, err
+			}
+			hs.rs, msg = rs, msg[n:]
+		default:
+			if err := hs.dhToken(tok); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return hs.decryptAndHash(msg)
+}
+
+// split returns the ciphers for sending and receiving, once the handshake is over
+func (hs *noiseHandshake) split() (send, recv *noiseCipher) {
+	k1, k2 := noiseHKDF(hs.ck, nil)
+	c1, c2 := &noiseCipher{k: k1}, &noiseCipher{k: k2}
+	if hs.initiator {
+		return c1, c2
+	}
+	return c2, c1
+}
+
+// hasStatic reports whether message i sends the static key of whoever writes it, so that its payload should bind their identity
+func (hs *noiseHandshake) hasStatic(i int) bool {
+	for _, tok := range hs.patterns[i] {
+		if tok == tokS {
+			return true
+		}
+	}
+	return false
+}
+
+// noiseBinding signs a static X25519 key with the ed25519 half of a [Principal], so that the peer
+// learns the whole [Key], and not just its encryption half. It is the payload of the message that carries the static key.
+func noiseBinding(p Principal) []byte {
+	pub := p.PublicKey()
+	sig := ed25519.Sign(p.privateSigningKey(), append([]byte(noiseBindingDomain), pub.Encryption().Bytes()...))
+	return append(pub.Signing().Bytes(), sig...)
+}
+
+// checkNoiseBinding checks a binding made by noiseBinding, and returns the whole [Key] of the peer
+func checkNoiseBinding(rs, payload []byte) (Key, error) {
+	if len(payload) != SubKeySize+ed25519.SignatureSize {
+		return Key{}, fmt.Errorf("%w: no identity binding", ErrHandshake)
+	}
+	signing, sig := payload[:SubKeySize], payload[SubKeySize:]
+	if !ed25519.Verify(ed25519.PublicKey(signing), append([]byte(noiseBindingDomain), rs...), sig) {
+		return Key{}, fmt.Errorf("%w: identity binding: %w", ErrHandshake, ErrNoValid)
+	}
+	return KeyFromBytes(append(append([]byte{}, rs...), signing...)), nil
+}
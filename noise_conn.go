@@ -0,0 +1,276 @@
+package delphi
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// NoiseConfig configures one side of a Noise link
+type NoiseConfig struct {
+	// Pattern is [NoiseXX] or [NoiseIK]. Empty means NoiseXX.
+	Pattern string
+	// Principal is who we are. Its encryption key is our Noise static key.
+	Principal Principal
+	// Peer, if set, is who we expect to be talking to. The initiator of NoiseIK must set it.
+	Peer Key
+	// BindIdentity signs our static key with our signing key, so that the peer learns our whole [Key],
+	// and requires the peer to do the same.
+	BindIdentity bool
+	// Prologue is data that both sides must agree on, such as a protocol name and version
+	Prologue []byte
+	// Authorize, if set, may refuse a peer once the handshake has authenticated them
+	Authorize func(peer Key) error
+	// Randomness is a source of randomness. Nil means [crypto/rand.Reader].
+	Randomness io.Reader
+}
+
+// A NoiseConn is a [net.Conn] encrypted and mutually authenticated with a Noise handshake.
+// The handshake happens on the first Read or Write, or on a call to [NoiseConn.Handshake].
+type NoiseConn struct {
+	net.Conn
+	cfg       NoiseConfig
+	initiator bool
+
+	hsMu   sync.Mutex
+	hsDone bool
+	hsErr  error
+	peer   Key
+
+	rMu  sync.Mutex
+	recv *noiseCipher
+	rbuf []byte
+
+	wMu  sync.Mutex
+	send *noiseCipher
+}
+
+// NoiseClient wraps conn as the initiator of a Noise handshake
+func NoiseClient(conn net.Conn, cfg NoiseConfig) *NoiseConn {
+	return &NoiseConn{Conn: conn, cfg: cfg, initiator: true}
+}
+
+// NoiseServer wraps conn as the responder of a Noise handshake
+func NoiseServer(conn net.Conn, cfg NoiseConfig) *NoiseConn {
+	return &NoiseConn{Conn: conn, cfg: cfg}
+}
+
+// Dial connects to address, and completes a Noise handshake as the initiator
+func Dial(network, address string, cfg NoiseConfig) (*NoiseConn, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	nc := NoiseClient(conn, cfg)
+	if err := nc.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return nc, nil
+}
+
+// a noiseListener wraps each accepted connection with [NoiseServer]
+type noiseListener struct {
+	net.Listener
+	cfg NoiseConfig
+}
+
+func (l noiseListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NoiseServer(conn, l.cfg), nil
+}
+
+// Listen listens on address. Accepted connections are [NoiseConn]s, which handshake as the responder on first use.
+func Listen(network, address string, cfg NoiseConfig) (net.Listener, error) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NoiseListener(l, cfg), nil
+}
+
+// NoiseListener wraps l, so that accepted connections are [NoiseConn]s
+func NoiseListener(l net.Listener, cfg NoiseConfig) net.Listener {
+	return noiseListener{Listener: l, cfg: cfg}
+}
+
+// Peer returns who is on the other end, once the handshake is done. Without BindIdentity, only the encryption half is known.
+func (c *NoiseConn) Peer() Key {
+	c.hsMu.Lock()
+	defer c.hsMu.Unlock()
+	return c.peer
+}
+
+// Handshake runs the Noise handshake, if it has not run already
+func (c *NoiseConn) Handshake() error {
+	c.hsMu.Lock()
+	defer c.hsMu.Unlock()
+	if !c.hsDone {
+		c.hsErr = c.handshake()
+		c.hsDone = true
+	}
+	return c.hsErr
+}
+
+func (c *NoiseConn) handshake() error {
+	cfg := c.cfg
+	if cfg.Pattern == "" {
+		cfg.Pattern = NoiseXX
+	}
+	if cfg.Randomness == nil {
+		cfg.Randomness = rand.Reader
+	}
+	var rs []byte
+	if c.initiator && cfg.Pattern == NoiseIK {
+		rs = cfg.Peer.Encryption().Bytes()
+	}
+	hs, err := newNoiseHandshake(cfg.Randomness, cfg.Pattern, c.initiator, cfg.Principal, rs, cfg.Prologue)
+	if err != nil {
+		return err
+	}
+
+	var peer Key
+	bound := false
+	for i := range hs.patterns {
+		if hs.myTurn(i) {
+			var payload []byte
+			if cfg.BindIdentity && hs.hasStatic(i) {
+				payload = noiseBinding(cfg.Principal)
+			}
+			msg, err := hs.writeMessage(i, payload)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrHandshake, err)
+			}
+			if err := writeNoiseFrame(c.Conn, msg); err != nil {
+				return fmt.Errorf("%w: %w", ErrHandshake, err)
+			}
+			continue
+		}
+		msg, err := readNoiseFrame(c.Conn)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrHandshake, err)
+		}
+		payload, err := hs.readMessage(i, msg)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrHandshake, err)
+		}
+		switch {
+		case len(payload) == 0:
+		case !hs.hasStatic(i):
+			//	a binding is only good on the message that carries the key it signs
+			return fmt.Errorf("%w: unexpected payload in message %d", ErrHandshake, i)
+		default:
+			if peer, err = checkNoiseBinding(hs.rs, payload); err != nil {
+				return err
+			}
+			bound = true
+		}
+	}
+
+	switch {
+	case bound:
+	case c.initiator && cfg.Pattern == NoiseIK:
+		//	we knew who they were before we started
+		peer = cfg.Peer
+	case cfg.BindIdentity:
+		return fmt.Errorf("%w: peer did not bind its identity", ErrHandshake)
+	default:
+		var k Key
+		copy(k[0][:], hs.rs)
+		peer = k
+	}
+	if !cfg.Peer.IsZero() {
+		same := peer.Encryption() == cfg.Peer.Encryption()
+		if cfg.BindIdentity {
+			same = peer.Equal(cfg.Peer)
+		}
+		if !same {
+			return fmt.Errorf("%w: expected %s but got %s", ErrHandshake, cfg.Peer.Nickname(), peer.Nickname())
+		}
+	}
+	if cfg.Authorize != nil {
+		if err := cfg.Authorize(peer); err != nil {
+			return fmt.Errorf("%w: %w", ErrHandshake, err)
+		}
+	}
+
+	c.peer = peer
+	c.send, c.recv = hs.split()
+	return nil
+}
+
+// Read reads decrypted data
+func (c *NoiseConn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.rMu.Lock()
+	defer c.rMu.Unlock()
+	for len(c.rbuf) == 0 {
+		frame, err := readNoiseFrame(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.rbuf, err = c.recv.decrypt(nil, frame)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// Write encrypts and writes data, in as many Noise messages as it takes
+func (c *NoiseConn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+	written := 0
+	for len(b) > 0 {
+		chunk := b[:min(len(b), MaxNoiseMessage-chacha20poly1305.Overhead)]
+		ct, err := c.send.encrypt(nil, chunk)
+		if err != nil {
+			return written, err
+		}
+		if err := writeNoiseFrame(c.Conn, ct); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// writeNoiseFrame writes a Noise message, prefixed by its length as two big-endian bytes
+func writeNoiseFrame(w io.Writer, msg []byte) error {
+	if len(msg) > MaxNoiseMessage {
+		return fmt.Errorf("%w: message of %d bytes is too big", ErrNoise, len(msg))
+	}
+	frame := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+// readNoiseFrame reads a Noise message written by writeNoiseFrame
+func readNoiseFrame(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,286 @@
+package delphi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// noisePair handshakes over a [net.Pipe], and returns both ends along with the errors of each side
+func noisePair(clientCfg, serverCfg NoiseConfig) (*NoiseConn, *NoiseConn, error, error) {
+	a, b := net.Pipe()
+	client := NoiseClient(a, clientCfg)
+	server := NoiseServer(b, serverCfg)
+	serverErr := make(chan error)
+	go func() {
+		err := server.Handshake()
+		if err != nil {
+			b.Close()
+		}
+		serverErr <- err
+	}()
+	clientErr := client.Handshake()
+	if clientErr != nil {
+		a.Close()
+	}
+	return client, server, clientErr, <-serverErr
+}
+
+func TestNoise(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	mallory := NewPrincipal(randy)
+
+	for _, pattern := range []string{NoiseXX, NoiseIK} {
+		t.Run(pattern, func(t *testing.T) {
+			client, server, clientErr, serverErr := noisePair(
+				NoiseConfig{Pattern: pattern, Principal: alice, Peer: bob.PublicKey(), BindIdentity: true, Prologue: []byte("test/1")},
+				NoiseConfig{Pattern: pattern, Principal: bob, BindIdentity: true, Prologue: []byte("test/1")},
+			)
+			assert.NoError(t, clientErr)
+			assert.NoError(t, serverErr)
+			assert.Equal(t, bob.PublicKey(), client.Peer())
+			assert.Equal(t, alice.PublicKey(), server.Peer())
+
+			//	more than fits in one Noise message, in both directions
+			big := bytes.Repeat([]byte("delphi "), 20000)
+			go func() {
+				client.Write(big)
+				client.Write([]byte("done"))
+			}()
+			got := make([]byte, len(big)+4)
+			_, err := io.ReadFull(server, got)
+			assert.NoError(t, err)
+			assert.Equal(t, append(big, "done"...), got)
+
+			go server.Write([]byte("hello alice"))
+			got = make([]byte, 11)
+			_, err = io.ReadFull(client, got)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("hello alice"), got)
+
+			client.Close()
+			server.Close()
+		})
+	}
+
+	t.Run("without binding, only the encryption key is known", func(t *testing.T) {
+		client, server, clientErr, serverErr := noisePair(NoiseConfig{Principal: alice}, NoiseConfig{Principal: bob})
+		assert.NoError(t, clientErr)
+		assert.NoError(t, serverErr)
+		assert.Equal(t, bob.PublicKey().Encryption(), client.Peer().Encryption())
+		assert.True(t, client.Peer().Signing().IsZero())
+		assert.Equal(t, alice.PublicKey().Encryption(), server.Peer().Encryption())
+	})
+
+	t.Run("binding required", func(t *testing.T) {
+		//	the client sends the last message of XX, so only the server can tell
+		_, _, _, serverErr := noisePair(NoiseConfig{Principal: alice}, NoiseConfig{Principal: bob, BindIdentity: true})
+		assert.ErrorIs(t, serverErr, ErrHandshake)
+	})
+
+	t.Run("IK to the wrong responder", func(t *testing.T) {
+		_, _, clientErr, serverErr := noisePair(
+			NoiseConfig{Pattern: NoiseIK, Principal: alice, Peer: bob.PublicKey()},
+			NoiseConfig{Pattern: NoiseIK, Principal: mallory},
+		)
+		assert.Error(t, clientErr)
+		assert.ErrorIs(t, serverErr, ErrDecryptionFailed)
+	})
+
+	t.Run("XX pinned to someone else", func(t *testing.T) {
+		_, _, clientErr, _ := noisePair(
+			NoiseConfig{Principal: alice, Peer: bob.PublicKey(), BindIdentity: true},
+			NoiseConfig{Principal: mallory, BindIdentity: true},
+		)
+		assert.ErrorIs(t, clientErr, ErrHandshake)
+	})
+
+	t.Run("prologues differ", func(t *testing.T) {
+		_, _, clientErr, serverErr := noisePair(
+			NoiseConfig{Principal: alice, Prologue: []byte("v1")},
+			NoiseConfig{Principal: bob, Prologue: []byte("v2")},
+		)
+		assert.Error(t, errors.Join(clientErr, serverErr))
+	})
+
+	t.Run("authorize", func(t *testing.T) {
+		refuse := errors.New("not on the list")
+		_, _, _, serverErr := noisePair(
+			NoiseConfig{Principal: mallory, BindIdentity: true},
+			NoiseConfig{Principal: bob, BindIdentity: true, Authorize: func(peer Key) error {
+				if !peer.Equal(alice.PublicKey()) {
+					return refuse
+				}
+				return nil
+			}},
+		)
+		assert.ErrorIs(t, serverErr, refuse)
+	})
+
+	t.Run("payload on a message without a static key", func(t *testing.T) {
+		//	the second message of IK carries no static key, so it has nothing to bind
+		a, b := net.Pipe()
+		client := NoiseClient(a, NoiseConfig{Pattern: NoiseIK, Principal: alice, Peer: bob.PublicKey(), BindIdentity: true})
+		clientErr := make(chan error)
+		go func() {
+			clientErr <- client.Handshake()
+			a.Close()
+		}()
+		hs, err := newNoiseHandshake(randy, NoiseIK, false, bob, nil, nil)
+		assert.NoError(t, err)
+		msg, err := readNoiseFrame(b)
+		assert.NoError(t, err)
+		_, err = hs.readMessage(0, msg)
+		assert.NoError(t, err)
+		msg, err = hs.writeMessage(1, noiseBinding(bob))
+		assert.NoError(t, err)
+		assert.NoError(t, writeNoiseFrame(b, msg))
+		assert.ErrorIs(t, <-clientErr, ErrHandshake)
+		b.Close()
+	})
+
+}
+
+func TestNoise_DialListen(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	l, err := Listen("tcp", "127.0.0.1:0", NoiseConfig{Principal: bob, BindIdentity: true})
+	if err != nil {
+		t.Skipf("no loopback: %s", err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	conn, err := Dial("tcp", l.Addr().String(), NoiseConfig{Pattern: NoiseXX, Principal: alice, Peer: bob.PublicKey(), BindIdentity: true})
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, bob.PublicKey(), conn.Peer())
+
+	_, err = conn.Write([]byte("echo"))
+	assert.NoError(t, err)
+	got := make([]byte, 4)
+	_, err = io.ReadFull(conn, got)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("echo"), got)
+
+}
+
+// noiseKeyPair builds a [Principal] around a known X25519 private key. Its signing half is left empty.
+func noiseKeyPair(t *testing.T, privHex string) Principal {
+	t.Helper()
+	priv, err := hex.DecodeString(privHex)
+	assert.NoError(t, err)
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	assert.NoError(t, err)
+	var p Principal
+	copy(p[0][0][:], pub)
+	copy(p[1][0][:], priv)
+	return p
+}
+
+func TestNoise_KnownAnswer(t *testing.T) {
+
+	t.Run("HKDF is RFC 5869 with an empty info", func(t *testing.T) {
+		ck := bytes.Repeat([]byte{1}, 32)
+		ikm := bytes.Repeat([]byte{2}, 32)
+		want := make([]byte, 64)
+		_, err := io.ReadFull(hkdf.New(sha256.New, ikm, ck, nil), want)
+		assert.NoError(t, err)
+		out1, out2 := noiseHKDF(ck, ikm)
+		assert.Equal(t, want[:32], out1)
+		assert.Equal(t, want[32:], out2)
+	})
+
+	//	fixed static and ephemeral keys, so that the whole transcript is fixed too
+	initStatic := noiseKeyPair(t, "e61ef9919cde45dd5f82166404bd08e38bceb5dfdfded0a34c8df7ed542214d1")
+	respStatic := noiseKeyPair(t, "4a3acbfdb163dec651dfa3194dece676d437029c62a408b4c5ea9114246e4893")
+	initEphemeral, _ := hex.DecodeString("893e28b9dc6ca8d611ab664754b8ceb7bac5117349a4439a6b0569da977c464a")
+	respEphemeral, _ := hex.DecodeString("bbdb4cdbd309f1a1f2e1456967fe288cadd6f712d65dc7b7793d5e63da6b375b")
+	prologue := []byte("John Galt")
+
+	vectors := []struct {
+		pattern   string
+		messages  []string
+		hash      string
+		transport string
+	}{
+		{
+			pattern: NoiseXX,
+			messages: []string{
+				"ca35def5ae56cec33dc2036731ab14896bc4c75dbb07a61f879f8e3afa4c79447061796c6f61642030",
+				"95ebc60d2b1fa672c1f46a8aa265ef51bfe38e7ccb39ec5be34069f14480884381cbad1f276e038c48378ffce2b65285e08d6b68aaa3629a5a8639392490e5b9aa6e7929d0caac7fcc181f16481d9ba3683cf38621e64dccc5b96d3d59c4e445ba7caca15587a82665",
+				"c7195ffacac1307ff99046f219750fc47693e23c3cb08b89c2af808b444850a80f9368ca72a3aceef65f776c6565f3836e86a78d95adaee3cdb9b18d7138d46172a848c001153ab743",
+			},
+			hash:      "8f3ecba29e6f7caae46c9197c99cba8bdd75a5a9c7397f7b4f8a8e217cfdfd42",
+			transport: "0057f15f310848ac44d45b43c5f9aae09311298f7051142808",
+		},
+		{
+			pattern: NoiseIK,
+			messages: []string{
+				"ca35def5ae56cec33dc2036731ab14896bc4c75dbb07a61f879f8e3afa4c7944718da798efbcd91528520204f904b9bd6c7413dccdc214d951e15253e39987f18146e8cd0873654207148333479d4d16fe9ded324d2fd25c2d36b63d83d61ac1c104c27ebb1ba94726",
+				"95ebc60d2b1fa672c1f46a8aa265ef51bfe38e7ccb39ec5be34069f1448088436e75ec1520cc0294971d1706e44ac715987e47a1ca5e007619",
+			},
+			hash:      "92b89bfdcc81e178ab6e4cd3b1ea70e7dc0bf8fc943a73a09311ef9a484e35a6",
+			transport: "3752de13d2fc31a580637944669a19001a2a6145ea468c0fd3",
+		},
+	}
+
+	for _, v := range vectors {
+		t.Run(v.pattern, func(t *testing.T) {
+			var rs []byte
+			if v.pattern == NoiseIK {
+				rs = respStatic.PublicKey().Encryption().Bytes()
+			}
+			initiator, err := newNoiseHandshake(bytes.NewReader(initEphemeral), v.pattern, true, initStatic, rs, prologue)
+			assert.NoError(t, err)
+			responder, err := newNoiseHandshake(bytes.NewReader(respEphemeral), v.pattern, false, respStatic, nil, prologue)
+			assert.NoError(t, err)
+
+			for i, want := range v.messages {
+				w, r := initiator, responder
+				if i%2 == 1 {
+					w, r = responder, initiator
+				}
+				payload := []byte(fmt.Sprintf("payload %d", i))
+				msg, err := w.writeMessage(i, payload)
+				assert.NoError(t, err)
+				assert.Equal(t, want, hex.EncodeToString(msg), "message %d", i)
+				got, err := r.readMessage(i, msg)
+				assert.NoError(t, err)
+				assert.Equal(t, payload, got)
+			}
+			assert.Equal(t, v.hash, hex.EncodeToString(initiator.h))
+			assert.Equal(t, initiator.h, responder.h)
+
+			send, _ := initiator.split()
+			_, recv := responder.split()
+			ct, err := send.encrypt(nil, []byte("transport"))
+			assert.NoError(t, err)
+			assert.Equal(t, v.transport, hex.EncodeToString(ct))
+			plain, err := recv.decrypt(nil, ct)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("transport"), plain)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package delphi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// padding schemes, which hide how long plain text is by padding it before it is encrypted
+const (
+	PadNone = "none"
+	// PadPowerOfTwo pads to the next power of two, and at least to minPowerOfTwo. It never more than doubles the size.
+	PadPowerOfTwo = "pow2"
+	// PadBucket pads to the next multiple of a bucket size
+	PadBucket = "bucket"
+)
+
+// the smallest size that [PadPowerOfTwo] pads to, so that short answers all look alike
+const minPowerOfTwo = 32
+
+// MaxPadBucket is the biggest bucket that [PadBucket] may use
+const MaxPadBucket = 1 << 20
+
+var ErrBadPadding = errors.New("bad padding")
+
+// the header that records the padding scheme. It is part of the AAD, so it cannot be altered.
+const paddingHeader = "padding"
+
+// Padding is a padding scheme, along with its bucket size if it is [PadBucket].
+// The zero value means [PadNone].
+type Padding struct {
+	Scheme string
+	Bucket int
+}
+
+// String writes a Padding as "none", "pow2" or "bucket/N", as it appears in headers.
+func (p Padding) String() string {
+	switch p.Scheme {
+	case "":
+		return PadNone
+	case PadBucket:
+		return fmt.Sprintf("%s/%d", PadBucket, p.Bucket)
+	default:
+		return p.Scheme
+	}
+}
+
+// ParsePadding reads a Padding written by [Padding.String]
+func ParsePadding(s string) (Padding, error) {
+	scheme, size, hasSize := strings.Cut(s, "/")
+	p := Padding{Scheme: scheme}
+	if hasSize {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return Padding{}, fmt.Errorf("%w: %q: %w", ErrBadPadding, s, err)
+		}
+		p.Bucket = n
+	}
+	if err := p.check(); err != nil {
+		return Padding{}, err
+	}
+	return p, nil
+}
+
+// check refuses schemes we don't know about, and buckets that make no sense
+func (p Padding) check() error {
+	switch p.Scheme {
+	case "", PadNone, PadPowerOfTwo:
+		if p.Bucket != 0 {
+			return fmt.Errorf("%w: %s does not take a bucket size", ErrBadPadding, p.Scheme)
+		}
+	case PadBucket:
+		if p.Bucket < 1 || p.Bucket > MaxPadBucket {
+			return fmt.Errorf("%w: bucket size %d is not between 1 and %d", ErrBadPadding, p.Bucket, MaxPadBucket)
+		}
+	default:
+		return fmt.Errorf("%w: unknown scheme %q", ErrBadPadding, p.Scheme)
+	}
+	return nil
+}
+
+// paddedLen is how long n bytes become once padded, counting the byte that marks where padding starts
+func (p Padding) paddedLen(n int) int {
+	n++
+	switch p.Scheme {
+	case PadPowerOfTwo:
+		if n <= minPowerOfTwo {
+			return minPowerOfTwo
+		}
+		return 1 << bits.Len(uint(n-1))
+	case PadBucket:
+		return (n + p.Bucket - 1) / p.Bucket * p.Bucket
+	}
+	return n - 1
+}
+
+// Padding returns the padding scheme of a [Message]. Messages that do not say are [PadNone].
+func (msg *Message) Padding() (Padding, error) {
+	s := msg.Headers.Get(Keyspace, paddingHeader)
+	if s == "" {
+		return Padding{Scheme: PadNone}, nil
+	}
+	return ParsePadding(s)
+}
+
+// Pad pads the plain text of a [Message] with a single 0x80 byte followed by zeros, and records p in a header.
+// [Principal.Encrypt] does this itself when [EncryptOptions] asks for it. Call it before [Principal.EncryptToMany].
+// Decryption removes the padding transparently.
+// Padding goes on after compression, so that it hides the compressed length.
+func (msg *Message) Pad(p Padding) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+	if p.Scheme == "" || p.Scheme == PadNone {
+		return nil
+	}
+	if msg.Encrypted() {
+		return fmt.Errorf("%w: already encrypted", ErrDelphi)
+	}
+	if msg.Headers.Get(Keyspace, paddingHeader) != "" {
+		return fmt.Errorf("%w: already padded", ErrDelphi)
+	}
+	padded := make([]byte, p.paddedLen(len(msg.PlainText)))
+	copy(padded, msg.PlainText)
+	padded[len(msg.PlainText)] = 0x80
+	if msg.Headers == nil {
+		msg.Headers = make(KV)
+	}
+	msg.Headers.Set(Keyspace, paddingHeader, p.String())
+	msg.PlainText = padded
+	return nil
+}
+
+// unpad removes the padding added by [Message.Pad]
+func unpad(p Padding, padded []byte) ([]byte, error) {
+	if p.Scheme == "" || p.Scheme == PadNone {
+		return padded, nil
+	}
+	trimmed := bytes.TrimRight(padded, "\x00")
+	if len(trimmed) == 0 || trimmed[len(trimmed)-1] != 0x80 {
+		return nil, fmt.Errorf("%w: no end marker", ErrBadPadding)
+	}
+	return trimmed[:len(trimmed)-1], nil
+}
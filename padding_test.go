@@ -0,0 +1,85 @@
+package delphi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPadding(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+
+	t.Run("hides length", func(t *testing.T) {
+		for _, p := range []Padding{{Scheme: PadPowerOfTwo}, {Scheme: PadBucket, Bucket: 256}} {
+			t.Run(p.String(), func(t *testing.T) {
+				yes := alice.ComposeMessage(randy, []byte("yes"))
+				no := alice.ComposeMessage(randy, []byte("no"))
+				assert.NoError(t, alice.Encrypt(randy, yes, bob.PublicKey(), EncryptOptions{Padding: p}))
+				assert.NoError(t, alice.Encrypt(randy, no, bob.PublicKey(), EncryptOptions{Padding: p}))
+				assert.Equal(t, len(yes.CipherText), len(no.CipherText))
+				assert.NoError(t, bob.Decrypt(yes, nil))
+				assert.Equal(t, []byte("yes"), yes.PlainText)
+			})
+		}
+	})
+
+	t.Run("sizes", func(t *testing.T) {
+		pow2 := Padding{Scheme: PadPowerOfTwo}
+		bucket := Padding{Scheme: PadBucket, Bucket: 100}
+		for n, want := range map[int][2]int{0: {32, 100}, 31: {32, 100}, 32: {64, 100}, 99: {128, 100}, 100: {128, 200}, 1000: {1024, 1100}} {
+			assert.Equal(t, want[0], pow2.paddedLen(n), "pow2 of %d", n)
+			assert.Equal(t, want[1], bucket.paddedLen(n), "bucket of %d", n)
+		}
+	})
+
+	t.Run("decrypt and encrypt again", func(t *testing.T) {
+		o := EncryptOptions{Compression: CompressDeflate, Padding: Padding{Scheme: PadBucket, Bucket: 64}}
+		msg := alice.ComposeMessage(randy, []byte("hello hello hello hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), o))
+		assert.NoError(t, bob.Decrypt(msg, nil))
+		assert.Equal(t, "", msg.Headers.Get(Keyspace, paddingHeader))
+		assert.Equal(t, "", msg.Headers.Get(Keyspace, compressionHeader))
+
+		//	through a PEM, as the CLI would
+		again := new(Message)
+		assert.NoError(t, again.FromPEM(toPEM(t, msg)))
+		assert.NoError(t, bob.Encrypt(randy, again, carol.PublicKey(), o))
+		assert.NoError(t, carol.Decrypt(again, nil))
+		assert.Equal(t, []byte("hello hello hello hello"), again.PlainText)
+	})
+
+	t.Run("with compression and many recipients", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello hello hello hello"))
+		assert.NoError(t, msg.Compress(CompressDeflate))
+		assert.NoError(t, msg.Pad(Padding{Scheme: PadBucket, Bucket: 64}))
+		assert.NoError(t, alice.EncryptToMany(randy, msg, bob.PublicKey(), carol.PublicKey()))
+		assert.NoError(t, carol.Decrypt(msg, nil))
+		assert.Equal(t, []byte("hello hello hello hello"), msg.PlainText)
+	})
+
+	t.Run("trailing zeros survive", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte{1, 0, 0x80, 0})
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{Padding: Padding{Scheme: PadPowerOfTwo}}))
+		assert.NoError(t, bob.Decrypt(msg, nil))
+		assert.Equal(t, []byte{1, 0, 0x80, 0}, msg.PlainText)
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		p, err := ParsePadding("bucket/512")
+		assert.NoError(t, err)
+		assert.Equal(t, Padding{Scheme: PadBucket, Bucket: 512}, p)
+		for _, bad := range []string{"bucket", "bucket/0", "bucket/x", "pow2/8", "pad-it-all"} {
+			_, err := ParsePadding(bad)
+			assert.ErrorIs(t, err, ErrBadPadding, bad)
+		}
+	})
+
+	t.Run("no end marker", func(t *testing.T) {
+		_, err := unpad(Padding{Scheme: PadPowerOfTwo}, make([]byte, 32))
+		assert.ErrorIs(t, err, ErrBadPadding)
+	})
+
+}
@@ -0,0 +1,193 @@
+package delphi
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+var ErrPassphraseRequired = errors.New("private key is protected by a passphrase")
+var ErrBadPassphrase = errors.New("wrong passphrase, or corrupt private key")
+
+// ScryptParams are the cost parameters for deriving a key from a passphrase
+type ScryptParams struct {
+	N int
+	R int
+	P int
+}
+
+// DefaultScryptParams are used when protecting a private key
+var DefaultScryptParams = ScryptParams{N: 1 << 15, R: 8, P: 1}
+
+// maxScryptParams bounds what we are willing to compute when reading a PEM from someone else.
+// scrypt needs 128*N*R bytes of memory, so this is 1 GiB at most.
+var maxScryptParams = ScryptParams{N: 1 << 20, R: 8, P: 1}
+
+const kdfSaltSize = 16
+
+// header keys for protected private keys
+const (
+	hdrKDF     = "kdf"
+	hdrKDFSalt = "kdf-salt"
+	hdrKDFN    = "kdf-n"
+	hdrKDFR    = "kdf-r"
+	hdrKDFP    = "kdf-p"
+	hdrCipher  = "cipher"
+	hdrNonce   = "nonce"
+)
+
+func (sp ScryptParams) valid() bool {
+	if sp.N < 2 || sp.N&(sp.N-1) != 0 || sp.R < 1 || sp.P < 1 {
+		return false
+	}
+	return sp.N <= maxScryptParams.N && sp.R <= maxScryptParams.R && sp.P <= maxScryptParams.P
+}
+
+func (sp ScryptParams) deriveKey(passphrase, salt []byte) ([]byte, error) {
+	if !sp.valid() {
+		return nil, fmt.Errorf("%w: unacceptable scrypt parameters", ErrBadKey)
+	}
+	return scrypt.Key(passphrase, salt, sp.N, sp.R, sp.P, chacha20poly1305.KeySize)
+}
+
+// protectedAAD binds the PEM type, and every header that says how the key was protected, to the encrypted body
+func protectedAAD(typ string, hdrs KV) ([]byte, error) {
+	bound := KV{}
+	for _, k := range []string{hdrKDF, hdrKDFSalt, hdrKDFN, hdrKDFR, hdrKDFP, hdrCipher, hdrNonce} {
+		bound.Set(Keyspace, k, hdrs.Get(Keyspace, k))
+	}
+	b, err := bound.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(typ), b...), nil
+}
+
+// IsProtectedPEM reports whether a private key PEM is protected by a passphrase
+func IsProtectedPEM(b pem.Block) bool {
+	_, ok := b.Headers[fmt.Sprintf("%s/%s", Keyspace, hdrKDF)]
+	return ok
+}
+
+// protectPEM encrypts the body of a PEM with a key derived from passphrase, using scrypt and ChaCha20-Poly1305,
+// and records how in its headers
+func protectPEM(randy io.Reader, blk *pem.Block, passphrase []byte) error {
+
+	params := DefaultScryptParams
+
+	salt := make([]byte, kdfSaltSize)
+	if _, err := io.ReadFull(randy, salt); err != nil {
+		return err
+	}
+	nonce := NewNonce(randy)
+
+	key, err := params.deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	if blk.Headers == nil {
+		blk.Headers = KV{}
+	}
+	hdrs := KV(blk.Headers)
+	hdrs.Set(Keyspace, hdrKDF, "scrypt")
+	hdrs.SetBytes(Keyspace, hdrKDFSalt, salt)
+	hdrs.SetInt(Keyspace, hdrKDFN, int64(params.N))
+	hdrs.SetInt(Keyspace, hdrKDFR, int64(params.R))
+	hdrs.SetInt(Keyspace, hdrKDFP, int64(params.P))
+	hdrs.Set(Keyspace, hdrCipher, "chacha20poly1305")
+	hdrs.SetBytes(Keyspace, hdrNonce, nonce.Bytes())
+
+	aad, err := protectedAAD(blk.Type, hdrs)
+	if err != nil {
+		return err
+	}
+	body, err := encrypt(key, blk.Bytes, nonce.Bytes(), aad)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrEncryptionFailed, err)
+	}
+	blk.Bytes = body
+	return nil
+}
+
+// unprotectPEM decrypts the body of a PEM protected by protectPEM
+func unprotectPEM(b pem.Block, passphrase []byte) ([]byte, error) {
+
+	hdrs := KV(b.Headers)
+	if kdf := hdrs.Get(Keyspace, hdrKDF); kdf != "scrypt" {
+		return nil, fmt.Errorf("%w: unsupported kdf %q", ErrBadKey, kdf)
+	}
+	if cipher := hdrs.Get(Keyspace, hdrCipher); cipher != "chacha20poly1305" {
+		return nil, fmt.Errorf("%w: unsupported cipher %q", ErrBadKey, cipher)
+	}
+
+	var params ScryptParams
+	for ptr, k := range map[*int]string{&params.N: hdrKDFN, &params.R: hdrKDFR, &params.P: hdrKDFP} {
+		n, err := hdrs.GetInt(Keyspace, k)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBadKey, err)
+		}
+		*ptr = int(n)
+	}
+
+	salt, err := hdrs.GetBytes(Keyspace, hdrKDFSalt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadKey, err)
+	}
+	nonce, err := hdrs.GetBytes(Keyspace, hdrNonce)
+	if err != nil || len(nonce) != NonceSize {
+		return nil, fmt.Errorf("%w: bad nonce", ErrBadKey)
+	}
+
+	key, err := params.deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	aad, err := protectedAAD(b.Type, hdrs)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decrypt(key, b.Bytes, nonce, aad)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return plain, nil
+}
+
+// MarshalProtectedPEM encodes a [Principal] as a PEM whose body is encrypted
+// with a key derived from passphrase, using scrypt and ChaCha20-Poly1305.
+func (p Principal) MarshalProtectedPEM(randy io.Reader, passphrase []byte) (pem.Block, error) {
+
+	hdrs := KV{}
+	hdrs.Set(Keyspace, "nick", p.Nickname())
+	hdrs.Set(Keyspace, "version", Version)
+
+	blk := pem.Block{
+		Type:    string(Privkey),
+		Headers: hdrs,
+		Bytes:   p.Bytes(),
+	}
+	if err := protectPEM(randy, &blk, passphrase); err != nil {
+		return pem.Block{}, err
+	}
+	return blk, nil
+}
+
+// UnmarshalProtectedPEM decodes a PEM produced by [Principal.MarshalProtectedPEM].
+// An unprotected PEM is accepted too, in which case passphrase is ignored.
+func (p *Principal) UnmarshalProtectedPEM(b pem.Block, passphrase []byte) error {
+
+	if !IsProtectedPEM(b) {
+		return p.UnmarshalPEM(b)
+	}
+	plain, err := unprotectPEM(b, passphrase)
+	if err != nil {
+		return err
+	}
+	return p.UnmarshalBinary(plain)
+}
@@ -0,0 +1,82 @@
+package delphi
+
+import (
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectedPEM(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	passphrase := []byte("correct horse battery staple")
+
+	blk, err := alice.MarshalProtectedPEM(randy, passphrase)
+	assert.NoError(t, err)
+	assert.Equal(t, string(Privkey), blk.Type)
+	assert.True(t, IsProtectedPEM(blk))
+	assert.Equal(t, alice.Nickname(), blk.Headers["delphi/nick"])
+	assert.NotContains(t, string(blk.Bytes), string(alice.PrivateKey().Bytes()))
+
+	//	survive encoding
+	got, _ := pem.Decode(pem.EncodeToMemory(&blk))
+	assert.NotNil(t, got)
+
+	t.Run("right passphrase", func(t *testing.T) {
+		p := new(Principal)
+		err := p.UnmarshalProtectedPEM(*got, passphrase)
+		assert.NoError(t, err)
+		assert.Equal(t, alice, *p)
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		p := new(Principal)
+		err := p.UnmarshalProtectedPEM(*got, []byte("hunter2"))
+		assert.ErrorIs(t, err, ErrBadPassphrase)
+	})
+
+	t.Run("no passphrase", func(t *testing.T) {
+		p := new(Principal)
+		err := p.UnmarshalPEM(*got)
+		assert.ErrorIs(t, err, ErrPassphraseRequired)
+	})
+
+	t.Run("greedy kdf parameters", func(t *testing.T) {
+		greedy := *got
+		greedy.Headers = KV{}
+		for k, v := range got.Headers {
+			greedy.Headers[k] = v
+		}
+		for k, v := range map[string]string{"delphi/kdf-n": "1073741824", "delphi/kdf-r": "32", "delphi/kdf-p": "16"} {
+			greedy.Headers[k] = v
+			p := new(Principal)
+			err := p.UnmarshalProtectedPEM(greedy, passphrase)
+			assert.ErrorIs(t, err, ErrBadKey, k)
+			greedy.Headers[k] = got.Headers[k]
+		}
+	})
+
+	t.Run("headers are bound to the body", func(t *testing.T) {
+		//	the same key and nonce, but sealed without the headers in the AAD
+		params := DefaultScryptParams
+		salt, _ := KV(got.Headers).GetBytes(Keyspace, hdrKDFSalt)
+		nonce, _ := KV(got.Headers).GetBytes(Keyspace, hdrNonce)
+		key, err := params.deriveKey(passphrase, salt)
+		assert.NoError(t, err)
+		unbound := *got
+		unbound.Bytes, err = encrypt(key, alice.Bytes(), nonce, []byte(Privkey))
+		assert.NoError(t, err)
+		p := new(Principal)
+		assert.ErrorIs(t, p.UnmarshalProtectedPEM(unbound, passphrase), ErrBadPassphrase)
+	})
+
+	t.Run("unprotected PEM", func(t *testing.T) {
+		plain, _ := alice.MarshalPEM()
+		p := new(Principal)
+		err := p.UnmarshalProtectedPEM(plain, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, alice, *p)
+	})
+
+}
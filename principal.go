@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"encoding/pem"
 
@@ -55,7 +56,7 @@ func (p Principal) Verify(delphiPubKey crypto.PublicKey, digest []byte, sig []by
 }
 
 // Encrypt encrypts a [Message]
-func (p Principal) Encrypt(randy io.Reader, msg *Message, recipient Key, _ any) error {
+func (p Principal) Encrypt(randy io.Reader, msg *Message, recipient Key, opts EncrypterOpts) error {
 
 	if msg.Encrypted() {
 		return fmt.Errorf("%w: already encrypted", ErrDelphi)
@@ -67,21 +68,71 @@ func (p Principal) Encrypt(randy io.Reader, msg *Message, recipient Key, _ any)
 		return ErrBadKey
 	}
 
-	msg.SenderKey = p.PublicKey()
-	msg.RecipientKey = recipient
-	if msg.RecipientKey.IsZero() {
+	o := encryptOptions(opts)
+	if o.RecipientValidity != nil {
+		if err := o.RecipientValidity.Check(recipient, time.Now()); err != nil {
+			return fmt.Errorf("%w: recipient: %w", ErrDelphi, err)
+		}
+	}
+
+	return p.seal(randy, msg, recipient, recipient.Encryption().Bytes(), o)
+}
+
+// seal encrypts a [Message] for recipient, using the X25519 public key encryptionKey,
+// which is usually, but not always, recipient's own encryption key.
+func (p Principal) seal(randy io.Reader, msg *Message, recipient Key, encryptionKey []byte, o EncryptOptions) error {
+
+	mode := o.Mode
+	if err := checkMode(mode); err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+	if err := checkCompression(o.Compression); err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+	if err := o.Padding.check(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+	if o.HideSender && mode == ModeAuth {
+		return fmt.Errorf("%w: a hidden sender cannot be used with %s mode", ErrDelphi, ModeAuth)
+	}
+
+	if recipient.IsZero() {
 		return fmt.Errorf("%w: recipient: %w", ErrDelphi, ErrBadKey)
 	}
+	msg.SenderKey = p.PublicKey()
+	msg.RecipientKey = recipient
 
-	sec, eph, err := generateSharedSecret(msg.RecipientKey.Encryption().Bytes(), randy)
+	sec, eph, err := generateSharedSecret(encryptionKey, randy)
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrDelphi, err)
 	}
+	if mode == ModeAuth {
+		sec, err = authenticateSecret(sec, p.privateEncryptionKey().Bytes(), encryptionKey, p.PublicKey(), recipient)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrDelphi, err)
+		}
+	}
 
 	msg.ensureNonce(randy)
 	msg.Eph = eph
 
-	aad, err := msg.Headers.MarshalBinary()
+	msg.stampVersion()
+	msg.Headers.Set(Keyspace, modeHeader, mode)
+	if o.HideRecipient {
+		if err := hideRecipient(msg, sec); err != nil {
+			return fmt.Errorf("%w: %w", ErrDelphi, err)
+		}
+	}
+	if o.HideSender {
+		p.hideSender(msg, recipient, o.SignHiddenSender)
+	}
+	if err := msg.Compress(o.Compression); err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+	if err := msg.Pad(o.Padding); err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+	aad, err := msg.aad()
 	if err != nil {
 		return err
 	}
@@ -102,22 +153,92 @@ func (p Principal) Encrypt(randy io.Reader, msg *Message, recipient Key, _ any)
 }
 
 // Decrypt decrypts a [Message]
-func (p Principal) Decrypt(msg *Message, _ crypto.DecrypterOpts) error {
+func (p Principal) Decrypt(msg *Message, opts crypto.DecrypterOpts) error {
+
+	o := decryptOptions(opts)
+	if len(msg.Slots) > 0 {
+		if msg.Mode() != ModeBase {
+			return fmt.Errorf("could not decrypt: %w: %q with slots", ErrUnknownMode, msg.Mode())
+		}
+		sharedSec, err := p.unwrapContentKey(msg.Slots)
+		if err != nil {
+			return fmt.Errorf("could not decrypt: %w", err)
+		}
+		return openMessage(msg, sharedSec, p.PublicKey(), o)
+	}
+	err := openSealed(msg, p.privateEncryptionKey().Bytes(), p.publicEncryptionKey().Bytes(), p.PublicKey(), o)
+	if err == nil && msg.HiddenRecipient() {
+		msg.RecipientKey = p.PublicKey()
+	}
+	return err
+}
 
-	sharedSec, err := extractSharedSecret(msg.Eph, p.privateEncryptionKey().Bytes(), p.publicEncryptionKey().Bytes())
+// openSealed decrypts a [Message] made by seal, using the private half of the X25519 key it was sealed to.
+// self is the identity of the recipient, which may differ from the key that was sealed to when that is a subkey.
+func openSealed(msg *Message, privKey, pubKey []byte, self Key, o DecryptOptions) error {
+	if err := checkMode(msg.Mode()); err != nil {
+		return fmt.Errorf("could not decrypt: %w", err)
+	}
+	sharedSec, err := extractSharedSecret(msg.Eph, privKey, pubKey)
+	if err == nil && msg.Mode() == ModeAuth {
+		sharedSec, err = authenticateSecret(sharedSec, privKey, msg.SenderKey.Encryption().Bytes(), msg.SenderKey, self)
+	}
+	if err == nil {
+		err = checkHint(msg, sharedSec)
+	}
 	if err != nil {
 		return fmt.Errorf("could not decrypt: %w", err)
 	}
+	return openMessage(msg, sharedSec, self, o)
+}
+
+// openMessage decrypts a [Message] whose shared secret is known. self is the identity of the recipient.
+// If there is a replay guard, a replayed message is refused, and left as it was.
+// Padding is removed, compressed plain text is decompressed, and a hidden sender is restored to SenderKey.
+func openMessage(msg *Message, sharedSec []byte, self Key, o DecryptOptions) error {
 
-	aad, err := msg.Headers.MarshalBinary()
+	aad, err := msg.aad()
 	if err != nil {
 		return fmt.Errorf("could not decrypt: %w", err)
 	}
 
 	plainTxt, err := decrypt(sharedSec, msg.CipherText, msg.Nonce.Bytes(), aad)
+	if err != nil {
+		return fmt.Errorf("could not decrypt: %w: %w", ErrDecryptionFailed, err)
+	}
+	padding, err := msg.Padding()
+	if err == nil {
+		plainTxt, err = unpad(padding, plainTxt)
+	}
 	if err != nil {
 		return fmt.Errorf("could not decrypt: %w", err)
 	}
+	plainTxt, err = decompress(msg.Compression(), plainTxt, o.DecompressLimit)
+	if err != nil {
+		return fmt.Errorf("could not decrypt: %w", err)
+	}
+	sender := msg.SenderKey
+	if msg.HiddenSender() {
+		var signed bool
+		sender, signed, plainTxt, err = revealSender(msg, self, plainTxt)
+		if err != nil {
+			return fmt.Errorf("could not decrypt: %w", err)
+		}
+		if o.RequireSignedSender && !signed {
+			return fmt.Errorf("could not decrypt: %w: not signed", ErrBadHiddenSender)
+		}
+	}
+	if o.ReplayGuard != nil {
+		if err := o.ReplayGuard.Check(msg); err != nil {
+			return fmt.Errorf("could not decrypt: %w", err)
+		}
+	}
+	//	the plain text is no longer padded or compressed, and the sender is back in the clear,
+	//	so those headers no longer describe it
+	msg.Headers.Delete(Keyspace, paddingHeader)
+	msg.Headers.Delete(Keyspace, compressionHeader)
+	msg.Headers.Delete(Keyspace, senderHeader)
+	msg.SenderKey = sender
 	msg.Subject = PlainMessage
 	msg.PlainText = plainTxt
 	msg.CipherText = nil
@@ -223,6 +344,17 @@ func (p Peer) MarshalPEM() (pem.Block, error) {
 	return blk, nil
 }
 
+func (p *Peer) UnmarshalPEM(b pem.Block) error {
+	if !Subject(b.Type).Equals(string(Pubkey)) {
+		return errors.New("wrong type of PEM")
+	}
+	if len(b.Bytes) != SubKeySize*2 {
+		return fmt.Errorf("%w: wrong byte size for public key. wanted %d but got %d", ErrBadKey, SubKeySize*2, len(b.Bytes))
+	}
+	*p = KeyFromBytes(b.Bytes)
+	return nil
+}
+
 func (p Principal) MarshalPEM() (pem.Block, error) {
 	blk := pem.Block{
 		Type: string(Privkey),
@@ -241,6 +373,10 @@ func (p *Principal) UnmarshalPEM(b pem.Block) error {
 		return errors.New("wrong type of PEM")
 	}
 
+	if IsProtectedPEM(b) {
+		return ErrPassphraseRequired
+	}
+
 	if len(b.Bytes) != SubKeySize*4 {
 		return fmt.Errorf("wrong byte size for private key. wanted %d but got %d", SubKeySize*4, len(b.Bytes))
 	}
@@ -0,0 +1,103 @@
+package delphi
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// the header that says the recipient is not named. It is part of the AAD, so it cannot be altered.
+const recipientHeader = "recipient"
+const recipientHidden = "hidden"
+
+// the header that holds a blinded hint, which lets the recipient skip messages that are not theirs without decrypting them
+const hintHeader = "hint"
+
+// HintSize is the size of the blinded hint on a [Message] with a hidden recipient.
+// One message in 2^32 that is not for a recipient will get past the hint, and then fail to decrypt.
+const HintSize = 4
+
+// HiddenRecipient reports whether a [Message] does not name its recipient
+func (msg *Message) HiddenRecipient() bool {
+	return msg.Headers.Get(Keyspace, recipientHeader) == recipientHidden
+}
+
+// recipientHint derives the blinded hint from a shared secret.
+// Only the sender and the recipient know the secret, so to anyone else, the hint is random.
+func recipientHint(sharedSec []byte) ([]byte, error) {
+	h := hkdf.New(sha256.New, sharedSec, nil, []byte(GLOBAL_SALT+"/hint"))
+	hint := make([]byte, HintSize)
+	if _, err := io.ReadFull(h, hint); err != nil {
+		return nil, err
+	}
+	return hint, nil
+}
+
+// hideRecipient marks a [Message] as not naming its recipient, and leaves a hint for them
+func hideRecipient(msg *Message, sharedSec []byte) error {
+	hint, err := recipientHint(sharedSec)
+	if err != nil {
+		return err
+	}
+	msg.RecipientKey = Key{}
+	msg.Headers.Set(Keyspace, recipientHeader, recipientHidden)
+	msg.Headers.SetBytes(Keyspace, hintHeader, hint)
+	return nil
+}
+
+// checkHint returns [ErrNotRecipient] if a [Message] with a hidden recipient carries a hint that sharedSec did not make
+func checkHint(msg *Message, sharedSec []byte) error {
+	if !msg.HiddenRecipient() {
+		return nil
+	}
+	got, err := msg.Headers.GetBytes(Keyspace, hintHeader)
+	if errors.Is(err, ErrNoHeader) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	want, err := recipientHint(sharedSec)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(got, want) {
+		return ErrNotRecipient
+	}
+	return nil
+}
+
+// TrialDecrypt tries each of decrypters on a [Message] until one opens it, and returns which one did.
+// It is meant for messages with a hidden recipient, but works on any.
+// If none of them can, it returns [ErrNotRecipient], and msg is left as it was.
+func TrialDecrypt(msg *Message, opts crypto.DecrypterOpts, decrypters ...Decrypter) (int, error) {
+	for i, d := range decrypters {
+		if err := d.Decrypt(msg, opts); err == nil {
+			return i, nil
+		} else if !errors.Is(err, ErrNotRecipient) && !errors.Is(err, ErrDecryptionFailed) {
+			//	a replay, or a decompression bomb, is not a reason to try the next one
+			return i, err
+		}
+	}
+	return -1, ErrNotRecipient
+}
+
+// TrialDecryptAll runs [TrialDecrypt] on each of msgs, and returns the ones that opened.
+// The rest are not for any of decrypters, and are left as they were.
+func TrialDecryptAll(msgs []*Message, opts crypto.DecrypterOpts, decrypters ...Decrypter) ([]*Message, error) {
+	opened := make([]*Message, 0)
+	for _, msg := range msgs {
+		_, err := TrialDecrypt(msg, opts, decrypters...)
+		switch {
+		case err == nil:
+			opened = append(opened, msg)
+		case !errors.Is(err, ErrNotRecipient):
+			return opened, err
+		}
+	}
+	return opened, nil
+}
@@ -0,0 +1,100 @@
+package delphi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHiddenRecipient(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+	hidden := EncryptOptions{HideRecipient: true}
+
+	t.Run("not named", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("for bob"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), hidden))
+		assert.True(t, msg.HiddenRecipient())
+		p := toPEM(t, msg)
+		assert.NotContains(t, p.Headers, "to")
+		assert.Contains(t, p.Headers, "delphi/hint")
+
+		got := new(Message)
+		assert.NoError(t, got.FromPEM(p))
+		assert.ErrorIs(t, carol.Decrypt(got, nil), ErrNotRecipient)
+		assert.True(t, got.Encrypted())
+		assert.NoError(t, bob.Decrypt(got, nil))
+		assert.Equal(t, []byte("for bob"), got.PlainText)
+		assert.Equal(t, bob.PublicKey(), got.RecipientKey)
+	})
+
+	t.Run("hint is authenticated", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("for bob"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), hidden))
+		delete(msg.Headers, "delphi/hint")
+		assert.ErrorIs(t, bob.Decrypt(msg, nil), ErrDecryptionFailed)
+	})
+
+	t.Run("with a hidden sender", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("from nobody to nobody"))
+		opts := EncryptOptions{HideRecipient: true, HideSender: true, SignHiddenSender: true}
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), opts))
+		assert.True(t, msg.RecipientKey.IsZero())
+		assert.True(t, msg.SenderKey.IsZero())
+		assert.NoError(t, bob.Decrypt(msg, DecryptOptions{RequireSignedSender: true}))
+		assert.Equal(t, alice.PublicKey(), msg.SenderKey)
+	})
+
+	t.Run("subkey is not named", func(t *testing.T) {
+		sp, err := bob.NewSubkey(randy, time.Hour)
+		assert.NoError(t, err)
+		msg := alice.ComposeMessage(randy, []byte("for bob's subkey"))
+		assert.NoError(t, alice.EncryptToSubkey(randy, msg, sp.Subkey, hidden))
+		assert.Empty(t, msg.Headers.Get(Keyspace, subkeyHeader))
+		assert.NoError(t, Keychain{Principal: bob, Subkeys: []SubkeyPair{sp}}.Decrypt(msg, nil))
+		assert.Equal(t, []byte("for bob's subkey"), msg.PlainText)
+		assert.Equal(t, bob.PublicKey(), msg.RecipientKey)
+	})
+
+}
+
+func TestTrialDecrypt(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+	dave := NewPrincipal(randy)
+	hidden := EncryptOptions{HideRecipient: true}
+
+	batch := make([]*Message, 0)
+	for _, recipient := range []Principal{bob, carol, dave, bob} {
+		msg := alice.ComposeMessage(randy, []byte("hello "+recipient.Nickname()))
+		assert.NoError(t, alice.Encrypt(randy, msg, recipient.PublicKey(), hidden))
+		batch = append(batch, msg)
+	}
+	plain := alice.ComposeMessage(randy, []byte("hello carol"))
+	assert.NoError(t, alice.Encrypt(randy, plain, carol.PublicKey(), nil))
+	batch = append(batch, plain)
+
+	opened, err := TrialDecryptAll(batch, nil, bob, carol)
+	assert.NoError(t, err)
+	assert.Len(t, opened, 4)
+	assert.True(t, batch[2].Encrypted())
+	assert.Equal(t, []byte("hello "+carol.Nickname()), batch[1].PlainText)
+	assert.Equal(t, []byte("hello "+bob.Nickname()), batch[3].PlainText)
+	assert.Equal(t, []byte("hello carol"), batch[4].PlainText)
+
+	t.Run("which one opened it", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, carol.PublicKey(), hidden))
+		i, err := TrialDecrypt(msg, nil, bob, carol)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, i)
+		_, err = TrialDecrypt(batch[2], nil, bob, carol)
+		assert.ErrorIs(t, err, ErrNotRecipient)
+	})
+
+}
@@ -0,0 +1,205 @@
+package delphi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var ErrReplay = errors.New("replayed message")
+var ErrStale = errors.New("message is too old to be checked for replay")
+
+// DefaultReplayWindow is how long a [ReplayGuard] remembers a message, unless told otherwise
+const DefaultReplayWindow = 24 * time.Hour
+
+// A ReplayGuard remembers which messages it has seen, so that the same one is not accepted twice.
+type ReplayGuard interface {
+	// Check records msg as seen, or returns [ErrReplay] if it was seen already.
+	Check(msg *Message) error
+}
+
+// replayKey identifies a message by its sender and nonce.
+// An encrypted message is identified by its nonce and cipher text instead,
+// because the "from" header is not bound to the cipher text, and could be altered to dodge the guard.
+// A [Challenge] is identified by its value alone, so that it can be answered only once.
+func replayKey(msg *Message) (string, error) {
+	var id []byte
+	switch {
+	case msg.Subject == ChallengeMessage:
+		id = slices.Concat([]byte(ChallengeMessage), msg.PlainText)
+	case msg.Nonce.IsZero():
+		return "", ErrNoNonce
+	case len(msg.CipherText) > 0:
+		id = slices.Concat(msg.Nonce.Bytes(), msg.CipherText)
+	default:
+		id = slices.Concat(msg.Nonce.Bytes(), msg.SenderKey.Bytes())
+	}
+	sum := sha256.Sum256(id)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// A MemoryReplayGuard is a [ReplayGuard] that remembers messages for Window.
+// A signed message whose time of signing is older than Window is refused, because it can no longer be told apart from a replay.
+// A message with no time of signing, such as an encrypted one, can never be told apart that way, so it is remembered forever.
+// The zero value is ready to use, with a window of [DefaultReplayWindow].
+type MemoryReplayGuard struct {
+	Window time.Duration
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	now    func() time.Time
+}
+
+// NewMemoryReplayGuard creates a [MemoryReplayGuard]. A window of zero means [DefaultReplayWindow].
+func NewMemoryReplayGuard(window time.Duration) *MemoryReplayGuard {
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+	return &MemoryReplayGuard{
+		Window: window,
+		seen:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Check records msg as seen, or returns [ErrReplay] if it was seen already, or [ErrStale] if it is too old to tell.
+func (g *MemoryReplayGuard) Check(msg *Message) error {
+	_, err := g.check(msg)
+	return err
+}
+
+// check reports whether anything changed
+func (g *MemoryReplayGuard) check(msg *Message) (bool, error) {
+	k, err := replayKey(msg)
+	if err != nil {
+		return false, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seen == nil {
+		g.seen = make(map[string]time.Time)
+	}
+	now := time.Now()
+	if g.now != nil {
+		now = g.now()
+	}
+	pruned := g.prune(now)
+	signedAt := msg.SignedAt()
+	if !signedAt.IsZero() && now.Sub(signedAt) > g.window() {
+		return pruned, fmt.Errorf("%w: signed at %s", ErrStale, signedAt.Format(time.RFC3339))
+	}
+	if _, seen := g.seen[k]; seen {
+		return pruned, ErrReplay
+	}
+	if signedAt.IsZero() {
+		//	the zero time marks a message that is never forgotten
+		g.seen[k] = time.Time{}
+	} else {
+		g.seen[k] = now
+	}
+	return true, nil
+}
+
+// window is Window, or [DefaultReplayWindow] if that is not set
+func (g *MemoryReplayGuard) window() time.Duration {
+	if g.Window <= 0 {
+		return DefaultReplayWindow
+	}
+	return g.Window
+}
+
+// prune forgets signed messages that are older than the window
+func (g *MemoryReplayGuard) prune(now time.Time) bool {
+	n := len(g.seen)
+	maps.DeleteFunc(g.seen, func(_ string, t time.Time) bool {
+		return !t.IsZero() && now.Sub(t) > g.window()
+	})
+	return len(g.seen) != n
+}
+
+// A FileReplayGuard is a [MemoryReplayGuard] that persists what it has seen to a file,
+// so that it survives restarts. Each line of the file is a message's key and the unix time it was seen,
+// or 0 for a message that is never forgotten.
+type FileReplayGuard struct {
+	*MemoryReplayGuard
+	fs   afero.Fs
+	path string
+}
+
+// OpenFileReplayGuard opens, or creates, a [FileReplayGuard] backed by the file at path.
+func OpenFileReplayGuard(fsys afero.Fs, path string, window time.Duration) (*FileReplayGuard, error) {
+	g := &FileReplayGuard{
+		MemoryReplayGuard: NewMemoryReplayGuard(window),
+		fs:                fsys,
+		path:              path,
+	}
+	if exists, _ := afero.Exists(fsys, path); !exists {
+		return g, nil
+	}
+	b, err := afero.ReadFile(fsys, path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open replay cache: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		k, unix, ok := strings.Cut(scanner.Text(), " ")
+		seconds, err := strconv.ParseInt(unix, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("could not open replay cache: %s: bad line %d", path, line)
+		}
+		if seconds == 0 {
+			g.seen[k] = time.Time{}
+		} else {
+			g.seen[k] = time.Unix(seconds, 0)
+		}
+	}
+	return g, nil
+}
+
+// Check records msg as seen, or returns [ErrReplay] if it was seen already, or [ErrStale] if it is too old to tell.
+func (g *FileReplayGuard) Check(msg *Message) error {
+	changed, err := g.check(msg)
+	if changed {
+		if saveErr := g.save(); saveErr != nil {
+			return errors.Join(err, saveErr)
+		}
+	}
+	return err
+}
+
+// save writes out everything that is remembered
+func (g *FileReplayGuard) save() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	buf := new(bytes.Buffer)
+	for _, k := range slices.Sorted(maps.Keys(g.seen)) {
+		var unix int64
+		if t := g.seen[k]; !t.IsZero() {
+			unix = t.Unix()
+		}
+		fmt.Fprintf(buf, "%s %d\n", k, unix)
+	}
+	if err := g.fs.MkdirAll(filepath.Dir(g.path), 0700); err != nil {
+		return err
+	}
+	return afero.WriteFile(g.fs, g.path, buf.Bytes(), 0600)
+}
+
+// VerifyOnce verifies the signature on a [Message], and checks with guard that it has not been seen before.
+func (msg *Message) VerifyOnce(guard ReplayGuard) error {
+	if !msg.Verify() {
+		return ErrNoValid
+	}
+	return guard.Check(msg)
+}
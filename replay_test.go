@@ -0,0 +1,123 @@
+package delphi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayGuard(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	t.Run("verify", func(t *testing.T) {
+		guard := NewMemoryReplayGuard(time.Hour)
+		msg, _ := alice.Assert(randy)
+		assert.NoError(t, msg.VerifyOnce(guard))
+		assert.ErrorIs(t, msg.VerifyOnce(guard), ErrReplay)
+
+		other, _ := alice.Assert(randy)
+		assert.NoError(t, other.VerifyOnce(guard))
+	})
+
+	t.Run("window", func(t *testing.T) {
+		guard := NewMemoryReplayGuard(time.Hour)
+		now := time.Now()
+		guard.now = func() time.Time { return now }
+		msg, _ := alice.Assert(randy)
+		assert.NoError(t, guard.Check(msg))
+
+		//	after the window, the message is forgotten, but also too old to accept
+		now = now.Add(2 * time.Hour)
+		assert.ErrorIs(t, guard.Check(msg), ErrStale)
+		assert.Empty(t, guard.seen)
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		var guard MemoryReplayGuard
+		msg, _ := alice.Assert(randy)
+		assert.NoError(t, msg.VerifyOnce(&guard))
+		assert.ErrorIs(t, msg.VerifyOnce(&guard), ErrReplay)
+	})
+
+	t.Run("no timestamp is never forgotten", func(t *testing.T) {
+		fsys := afero.NewMemMapFs()
+		guard, err := OpenFileReplayGuard(fsys, "replay/seen.txt", time.Hour)
+		assert.NoError(t, err)
+		now := time.Now()
+		guard.now = func() time.Time { return now }
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), nil))
+		assert.True(t, msg.SignedAt().IsZero())
+		assert.NoError(t, guard.Check(msg))
+
+		//	long after the window, and after a restart, it is still a replay
+		guard, err = OpenFileReplayGuard(fsys, "replay/seen.txt", time.Hour)
+		assert.NoError(t, err)
+		guard.now = func() time.Time { return now.Add(48 * time.Hour) }
+		assert.ErrorIs(t, guard.Check(msg), ErrReplay)
+		assert.Len(t, guard.seen, 1)
+	})
+
+	t.Run("decrypt", func(t *testing.T) {
+		guard := NewMemoryReplayGuard(0)
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), nil))
+		blk := toPEM(t, msg)
+
+		first := new(Message)
+		first.FromPEM(blk)
+		assert.NoError(t, bob.Decrypt(first, DecryptOptions{ReplayGuard: guard}))
+
+		//	a different "from" does not dodge the guard
+		again := new(Message)
+		again.FromPEM(blk)
+		again.SenderKey = NewPrincipal(randy).PublicKey()
+		assert.ErrorIs(t, bob.Decrypt(again, &DecryptOptions{ReplayGuard: guard}), ErrReplay)
+		assert.True(t, again.Encrypted())
+
+		//	messages that do not decrypt are not recorded
+		forged := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, forged, alice.PublicKey(), nil))
+		assert.Error(t, bob.Decrypt(forged, DecryptOptions{ReplayGuard: guard}))
+		assert.Len(t, guard.seen, 1)
+	})
+
+	t.Run("decrypt with slots", func(t *testing.T) {
+		guard := NewMemoryReplayGuard(0)
+		carol := NewPrincipal(randy)
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.EncryptToMany(randy, msg, bob.PublicKey(), carol.PublicKey()))
+		blk := toPEM(t, msg)
+
+		first := new(Message)
+		first.FromPEM(blk)
+		assert.NoError(t, bob.Decrypt(first, DecryptOptions{ReplayGuard: guard}))
+
+		again := new(Message)
+		again.FromPEM(blk)
+		again.SenderKey = NewPrincipal(randy).PublicKey()
+		assert.ErrorIs(t, bob.Decrypt(again, DecryptOptions{ReplayGuard: guard}), ErrReplay)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		fsys := afero.NewMemMapFs()
+		guard, err := OpenFileReplayGuard(fsys, "replay/seen.txt", time.Hour)
+		assert.NoError(t, err)
+		msg, _ := alice.Assert(randy)
+		assert.NoError(t, guard.Check(msg))
+
+		//	survives a restart
+		guard, err = OpenFileReplayGuard(fsys, "replay/seen.txt", time.Hour)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, guard.Check(msg), ErrReplay)
+
+		afero.WriteFile(fsys, "replay/bad.txt", []byte("garbage\n"), 0600)
+		_, err = OpenFileReplayGuard(fsys, "replay/bad.txt", time.Hour)
+		assert.Error(t, err)
+	})
+
+}
@@ -0,0 +1,113 @@
+package delphi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+var ErrRevoked = errors.New("signed by a revoked key")
+var ErrBadRevocation = errors.New("bad revocation")
+
+// reasons for revoking a key
+const (
+	ReasonUnspecified = "unspecified"
+	ReasonCompromised = "compromised" // the private key has leaked. No signature by it can be trusted.
+	ReasonSuperseded  = "superseded"  // the key has been replaced. Signatures made before revocation still stand.
+	ReasonRetired     = "retired"     // the key is no longer used. Signatures made before revocation still stand.
+)
+
+// checkReason refuses reasons we don't know about, so that a typo cannot pass for a milder reason
+func checkReason(reason string) error {
+	if !slices.Contains([]string{ReasonUnspecified, ReasonCompromised, ReasonSuperseded, ReasonRetired}, reason) {
+		return fmt.Errorf("%w: unknown reason %q", ErrBadRevocation, reason)
+	}
+	return nil
+}
+
+// A Revocation is a key declaring, over its own signature, that it should no longer be trusted.
+// On the wire, it is a signed [Message] with subject [KeyRevocation], whose body is the revoked key.
+type Revocation struct {
+	Key     Key
+	Reason  string
+	Time    time.Time
+	Message *Message
+}
+
+// Revoke produces a signed revocation of p. Anyone holding it can check it against p's public key.
+func (p Principal) Revoke(randy io.Reader, reason string) (*Message, error) {
+	if reason == "" {
+		reason = ReasonUnspecified
+	}
+	if err := checkReason(reason); err != nil {
+		return nil, fmt.Errorf("could not revoke: %w", err)
+	}
+	msg := p.ComposeMessage(randy, p.PublicKey().Bytes())
+	msg.Subject = KeyRevocation
+	msg.Headers.Set(Keyspace, "reason", reason)
+	if err := msg.Sign(randy, p); err != nil {
+		return nil, fmt.Errorf("could not revoke: %w", err)
+	}
+	return msg, nil
+}
+
+// ParseRevocation checks that msg is a revocation signed by the very key it revokes, and parses it.
+func ParseRevocation(msg *Message) (Revocation, error) {
+	if msg == nil || msg.Subject != KeyRevocation {
+		return Revocation{}, fmt.Errorf("%w: wrong subject", ErrBadRevocation)
+	}
+	if len(msg.PlainText) != 2*SubKeySize {
+		return Revocation{}, fmt.Errorf("%w: body is not a key", ErrBadRevocation)
+	}
+	revoked := KeyFromBytes(msg.PlainText)
+	if !revoked.Equal(msg.SenderKey) {
+		return Revocation{}, fmt.Errorf("%w: a key can only be revoked by itself", ErrBadRevocation)
+	}
+	if err := msg.verifyV2(); err != nil {
+		return Revocation{}, fmt.Errorf("%w: %w", ErrBadRevocation, err)
+	}
+	when := msg.SignedAt()
+	if when.IsZero() {
+		return Revocation{}, fmt.Errorf("%w: no time of signing", ErrBadRevocation)
+	}
+	reason := msg.Headers.Get(Keyspace, "reason")
+	if err := checkReason(reason); err != nil {
+		return Revocation{}, err
+	}
+	rev := Revocation{
+		Key:     revoked,
+		Reason:  reason,
+		Time:    when,
+		Message: msg,
+	}
+	return rev, nil
+}
+
+// Invalidates reports whether a signature made at signedAt is invalidated by this revocation.
+// A signature of unknown time, or by a compromised key, is always invalidated.
+// A reason we don't know about is taken to mean compromised.
+func (r Revocation) Invalidates(signedAt time.Time) bool {
+	if signedAt.IsZero() || r.Reason == ReasonCompromised || checkReason(r.Reason) != nil {
+		return true
+	}
+	return !signedAt.Before(r.Time)
+}
+
+// VerifyAgainst verifies the signature on a [Message], and checks that the signer has not been revoked.
+// Only a [DigestV2] signature can be dated before a revocation. One of the signer's [DigestV1] signatures is always invalidated.
+func (msg *Message) VerifyAgainst(revocations ...Revocation) error {
+	if !msg.Verify() {
+		return ErrNoValid
+	}
+	for _, rev := range revocations {
+		if !rev.Key.Equal(msg.SenderKey) {
+			continue
+		}
+		if msg.DigestVersion() != DigestV2 || rev.Invalidates(msg.SignedAt()) {
+			return fmt.Errorf("%w: %s revoked at %s (%s)", ErrRevoked, rev.Key.Nickname(), rev.Time.Format(time.RFC3339), rev.Reason)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package delphi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevoke(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	msg, err := alice.Revoke(randy, ReasonCompromised)
+	assert.NoError(t, err)
+	assert.Equal(t, KeyRevocation, msg.Subject)
+
+	//	survive PEM
+	got := new(Message)
+	assert.NoError(t, got.FromPEM(toPEM(t, msg)))
+
+	rev, err := ParseRevocation(got)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.PublicKey(), rev.Key)
+	assert.Equal(t, ReasonCompromised, rev.Reason)
+
+	t.Run("only a key can revoke itself", func(t *testing.T) {
+		forged := bob.ComposeMessage(randy, alice.PublicKey().Bytes())
+		forged.Subject = KeyRevocation
+		forged.Sign(randy, bob)
+		_, err := ParseRevocation(forged)
+		assert.ErrorIs(t, err, ErrBadRevocation)
+	})
+
+	t.Run("unknown reasons", func(t *testing.T) {
+		_, err := alice.Revoke(randy, "Compromised")
+		assert.ErrorIs(t, err, ErrBadRevocation)
+
+		odd := alice.ComposeMessage(randy, alice.PublicKey().Bytes())
+		odd.Subject = KeyRevocation
+		odd.Headers.Set(Keyspace, "reason", "comprimised")
+		assert.NoError(t, odd.Sign(randy, alice))
+		_, err = ParseRevocation(odd)
+		assert.ErrorIs(t, err, ErrBadRevocation)
+	})
+
+	t.Run("signature by a revoked key", func(t *testing.T) {
+		signed := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, signed.Sign(randy, alice))
+		assert.True(t, signed.Verify())
+		assert.ErrorIs(t, signed.VerifyAgainst(rev), ErrRevoked)
+
+		//	bob's revocation has nothing to do with alice
+		bobs, _ := bob.Revoke(randy, "")
+		bobRev, _ := ParseRevocation(bobs)
+		assert.NoError(t, signed.VerifyAgainst(bobRev))
+	})
+
+	t.Run("v1 is refused", func(t *testing.T) {
+		msg, err := alice.Revoke(randy, ReasonSuperseded)
+		assert.NoError(t, err)
+		signV1(t, msg, alice)
+		_, err = ParseRevocation(msg)
+		assert.ErrorIs(t, err, ErrWeakDigest)
+
+		//	and a v1 signature can not be dated before a revocation
+		superseded, err := alice.Revoke(randy, ReasonSuperseded)
+		assert.NoError(t, err)
+		later, err := ParseRevocation(superseded)
+		assert.NoError(t, err)
+		later.Time = time.Now().Add(time.Hour)
+		signed := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, signed.Sign(randy, alice))
+		assert.NoError(t, signed.VerifyAgainst(later))
+		signV1(t, signed, alice)
+		assert.ErrorIs(t, signed.VerifyAgainst(later), ErrRevoked)
+	})
+
+}
+
+func TestRevocation_Invalidates(t *testing.T) {
+
+	now := time.Now()
+	superseded := Revocation{Reason: ReasonSuperseded, Time: now}
+	compromised := Revocation{Reason: ReasonCompromised, Time: now}
+
+	assert.False(t, superseded.Invalidates(now.Add(-time.Hour)))
+	assert.True(t, superseded.Invalidates(now.Add(time.Hour)))
+	assert.True(t, superseded.Invalidates(time.Time{}))
+	assert.True(t, compromised.Invalidates(now.Add(-time.Hour)))
+
+	//	a reason we don't know is as bad as compromised
+	unknown := Revocation{Reason: "Superseded", Time: now}
+	assert.True(t, unknown.Invalidates(now.Add(-time.Hour)))
+
+}
+
+func TestKeyring_Revocations(t *testing.T) {
+
+	root := NewPrincipal(randy)
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	kr, _ := OpenKeyring(afero.NewMemMapFs(), "keyring/")
+	for _, pair := range [][2]Principal{{root, alice}, {alice, bob}} {
+		msg, _ := pair[0].Certify(randy, pair[1].PublicKey(), nil)
+		assert.NoError(t, kr.AddCertification(msg))
+	}
+	trust := Trust{Roots: []Peer{root.PublicKey()}}
+	_, err := kr.TrustPath(trust, bob.PublicKey())
+	assert.NoError(t, err)
+
+	signed := alice.ComposeMessage(randy, []byte("hello"))
+	signed.Sign(randy, alice)
+	assert.NoError(t, kr.Verify(signed))
+
+	revMsg, _ := alice.Revoke(randy, ReasonCompromised)
+	assert.NoError(t, kr.AddRevocation(revMsg))
+	assert.NoError(t, kr.Save())
+
+	kr, err = OpenKeyring(kr.fs, "keyring/")
+	assert.NoError(t, err)
+	_, revoked := kr.Revoked(alice.PublicKey())
+	assert.True(t, revoked)
+
+	assert.ErrorIs(t, kr.Verify(signed), ErrRevoked)
+
+	//	alice's certification of bob no longer counts
+	_, err = kr.TrustPath(trust, bob.PublicKey())
+	assert.ErrorIs(t, err, ErrUntrusted)
+	_, err = kr.TrustPath(trust, alice.PublicKey())
+	assert.ErrorIs(t, err, ErrUntrusted)
+
+}
@@ -0,0 +1,93 @@
+package delphi
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrBadHiddenSender = errors.New("bad hidden sender")
+
+// the header that says the sender is inside the cipher text. It is part of the AAD, so it cannot be altered.
+const senderHeader = "sender"
+const senderHidden = "hidden"
+
+// the plain text of a message with a hidden sender starts with a version byte, a flags byte,
+// the sender's key, and, if it is signed, the sender's signature. The real plain text follows.
+const (
+	hiddenSenderVersion byte = 1
+	hiddenSenderSigned  byte = 1
+)
+
+// HiddenSender reports whether the sender of a [Message] travels inside its cipher text
+func (msg *Message) HiddenSender() bool {
+	return msg.Headers.Get(Keyspace, senderHeader) == senderHidden
+}
+
+// hiddenSenderDigest is what a hidden sender signs. It binds the sender to this recipient and this encryption,
+// so that the signature cannot be lifted into another message.
+func hiddenSenderDigest(sender, recipient Key, eph []byte, nonce Nonce, plain []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(GLOBAL_SALT + "/hidden-sender/v1"))
+	writeField(h, sender.Bytes())
+	writeField(h, recipient.Bytes())
+	writeField(h, eph)
+	writeField(h, nonce.Bytes())
+	writeField(h, plain)
+	return h.Sum(nil)
+}
+
+// hideSender moves the sender's key from the clear into the plain text, optionally signing it over recipient.
+// The recipient is passed in, rather than read from msg, because a hidden recipient has already been zeroed there.
+// It must come after the ephemeral key and nonce are set, and before the plain text is compressed, padded and encrypted.
+func (p Principal) hideSender(msg *Message, recipient Key, sign bool) {
+	inner := new(bytes.Buffer)
+	inner.WriteByte(hiddenSenderVersion)
+	if sign {
+		inner.WriteByte(hiddenSenderSigned)
+	} else {
+		inner.WriteByte(0)
+	}
+	inner.Write(p.PublicKey().Bytes())
+	if sign {
+		digest := hiddenSenderDigest(p.PublicKey(), recipient, msg.Eph, msg.Nonce, msg.PlainText)
+		inner.Write(ed25519.Sign(p.privateSigningKey(), digest))
+	}
+	inner.Write(msg.PlainText)
+	msg.PlainText = inner.Bytes()
+	msg.SenderKey = Key{}
+	msg.Headers.Set(Keyspace, senderHeader, senderHidden)
+}
+
+// revealSender takes the sender's key back out of decrypted plain text, checking its signature over recipient if there is one.
+// It returns the sender, whether the sender signed, and the real plain text.
+func revealSender(msg *Message, recipient Key, plain []byte) (Key, bool, []byte, error) {
+	if len(plain) < 2+2*SubKeySize {
+		return Key{}, false, nil, fmt.Errorf("%w: too short", ErrBadHiddenSender)
+	}
+	if plain[0] != hiddenSenderVersion {
+		return Key{}, false, nil, fmt.Errorf("%w: unsupported version %d", ErrBadHiddenSender, plain[0])
+	}
+	flags := plain[1]
+	sender := KeyFromBytes(plain[2 : 2+2*SubKeySize])
+	rest := plain[2+2*SubKeySize:]
+	switch flags {
+	case 0:
+		return sender, false, rest, nil
+	case hiddenSenderSigned:
+		if len(rest) < ed25519.SignatureSize {
+			return Key{}, false, nil, fmt.Errorf("%w: too short", ErrBadHiddenSender)
+		}
+		sig, body := rest[:ed25519.SignatureSize], rest[ed25519.SignatureSize:]
+		digest := hiddenSenderDigest(sender, recipient, msg.Eph, msg.Nonce, body)
+		if !ed25519.Verify(ed25519.PublicKey(sender.Signing().Bytes()), digest, sig) {
+			return Key{}, false, nil, fmt.Errorf("%w: %w", ErrBadHiddenSender, ErrNoValid)
+		}
+		return sender, true, slices.Clone(body), nil
+	default:
+		return Key{}, false, nil, fmt.Errorf("%w: unknown flags %d", ErrBadHiddenSender, flags)
+	}
+}
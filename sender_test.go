@@ -0,0 +1,102 @@
+package delphi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHiddenSender(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+
+	t.Run("not in the clear", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("psst"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{HideSender: true}))
+		assert.True(t, msg.SenderKey.IsZero())
+		assert.True(t, msg.HiddenSender())
+		p := toPEM(t, msg)
+		assert.NotContains(t, p.Headers, "from")
+		assert.Contains(t, p.Headers, "to")
+		assert.Contains(t, p.Headers, "eph")
+
+		got := new(Message)
+		assert.NoError(t, got.FromPEM(p))
+		assert.NoError(t, bob.Decrypt(got, nil))
+		assert.Equal(t, alice.PublicKey(), got.SenderKey)
+		assert.Equal(t, []byte("psst"), got.PlainText)
+		assert.False(t, got.HiddenSender())
+
+		//	bob can pass it on, in the clear
+		assert.NoError(t, bob.Encrypt(randy, got, carol.PublicKey(), nil))
+		assert.NoError(t, carol.Decrypt(got, nil))
+		assert.Equal(t, bob.PublicKey(), got.SenderKey)
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("psst"))
+		opts := EncryptOptions{HideSender: true, SignHiddenSender: true, Compression: CompressDeflate, Padding: Padding{Scheme: PadPowerOfTwo}}
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), opts))
+		assert.NoError(t, bob.Decrypt(msg, DecryptOptions{RequireSignedSender: true}))
+		assert.Equal(t, alice.PublicKey(), msg.SenderKey)
+		assert.Equal(t, []byte("psst"), msg.PlainText)
+	})
+
+	t.Run("signed, to a hidden recipient", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("psst"))
+		opts := EncryptOptions{HideSender: true, SignHiddenSender: true, HideRecipient: true}
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), opts))
+		assert.True(t, msg.RecipientKey.IsZero())
+
+		//	the signature is over bob, even though he is not named
+		sec, err := extractSharedSecret(msg.Eph, bob.privateEncryptionKey().Bytes(), bob.publicEncryptionKey().Bytes())
+		assert.NoError(t, err)
+		aad, err := msg.aad()
+		assert.NoError(t, err)
+		plain, err := decrypt(sec, msg.CipherText, msg.Nonce.Bytes(), aad)
+		assert.NoError(t, err)
+		_, signed, _, err := revealSender(msg, bob.PublicKey(), plain)
+		assert.NoError(t, err)
+		assert.True(t, signed)
+		_, _, _, err = revealSender(msg, carol.PublicKey(), plain)
+		assert.ErrorIs(t, err, ErrNoValid)
+		_, _, _, err = revealSender(msg, Key{}, plain)
+		assert.ErrorIs(t, err, ErrNoValid)
+
+		assert.NoError(t, bob.Decrypt(msg, DecryptOptions{RequireSignedSender: true}))
+		assert.Equal(t, alice.PublicKey(), msg.SenderKey)
+		assert.Equal(t, bob.PublicKey(), msg.RecipientKey)
+		assert.Equal(t, []byte("psst"), msg.PlainText)
+	})
+
+	t.Run("unsigned refused when required", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("psst"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{HideSender: true}))
+		err := bob.Decrypt(msg, DecryptOptions{RequireSignedSender: true})
+		assert.ErrorIs(t, err, ErrBadHiddenSender)
+		assert.True(t, msg.Encrypted())
+	})
+
+	t.Run("forged signature", func(t *testing.T) {
+		//	carol claims to be alice, but can only sign as herself
+		msg := carol.ComposeMessage(randy, []byte("psst"))
+		msg.RecipientKey = bob.PublicKey()
+		msg.Eph = make([]byte, SubKeySize)
+		msg.ensureNonce(randy)
+		msg.Headers = make(KV)
+		carol.hideSender(msg, bob.PublicKey(), true)
+		copy(msg.PlainText[2:], alice.PublicKey().Bytes())
+		_, _, _, err := revealSender(msg, bob.PublicKey(), msg.PlainText)
+		assert.ErrorIs(t, err, ErrNoValid)
+	})
+
+	t.Run("not with auth mode", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("psst"))
+		err := alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{HideSender: true, Mode: ModeAuth})
+		assert.ErrorIs(t, err, ErrDelphi)
+		assert.True(t, msg.Plain())
+	})
+
+}
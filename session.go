@@ -0,0 +1,471 @@
+package delphi
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+var ErrSession = errors.New("session error")
+var ErrTooManySkipped = errors.New("too many skipped messages")
+
+// MaxSkip is the most messages a [Session] will skip over in one chain, waiting for them to arrive out of order
+const MaxSkip = 1000
+
+// MaxSkippedKeys is the most message keys a [Session] keeps for messages that have not arrived. The oldest are forgotten first.
+const MaxSkippedKeys = 2000
+
+// headers that carry a [Session]'s ratchet state. They are part of the AAD, so they cannot be altered.
+const (
+	ratchetKeyHeader = "ratchet-key"
+	ratchetNHeader   = "ratchet-n"
+	ratchetPNHeader  = "ratchet-pn"
+	x3dhEphHeader    = "x3dh-eph"
+)
+
+// a skippedKey is the key for a message that was skipped over, so that it can still be read when it arrives
+type skippedKey struct {
+	dh []byte
+	n  uint64
+	mk []byte
+}
+
+// A Session is a conversation between two [Principal]s, encrypted with the Double Ratchet.
+// Every message has its own key, and keys are forgotten once used, so that a leaked key
+// cannot read past messages (forward secrecy), and a leaked state heals itself once both sides
+// have sent again (post-compromise security).
+//
+// The initiator starts a Session with [Principal.StartSession], using one of the responder's subkeys as a signed prekey,
+// in an X3DH-style handshake. The responder accepts it with [Keychain.AcceptSession] on the first message.
+// A Session is not safe for concurrent use. Save it with [Session.MarshalBinary] after every message.
+type Session struct {
+	Self Key
+	Peer Key
+
+	ad      []byte // the identities of the initiator and the responder, bound into every message
+	rk      []byte // root key
+	cks     []byte // sending chain key
+	ckr     []byte // receiving chain key
+	dhsPriv []byte // our ratchet key
+	dhsPub  []byte
+	dhr     []byte // their ratchet key
+	ns      uint64
+	nr      uint64
+	pn      uint64
+	// a new ratchet key has been received, and a new one of ours must be made before sending
+	pending bool
+	// until the initiator hears back, every message repeats the handshake
+	x3dhEph    []byte
+	x3dhSubkey string
+	skipped    []skippedKey
+}
+
+// dh does an X25519 Diffie-Hellman
+func dh(priv, pub []byte) ([]byte, error) {
+	return curve25519.X25519(priv, pub)
+}
+
+// newRatchetKey makes a fresh X25519 key pair
+func newRatchetKey(randy io.Reader) ([]byte, []byte, error) {
+	priv := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(randy, priv); err != nil {
+		return nil, nil, err
+	}
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	return priv, pub, err
+}
+
+// kdfRK ratchets the root key forward with a Diffie-Hellman output, and returns a new root key and chain key
+func kdfRK(rk, dhOut []byte) ([]byte, []byte, error) {
+	h := hkdf.New(sha256.New, dhOut, rk, []byte(GLOBAL_SALT+"/ratchet"))
+	out := make([]byte, 64)
+	if _, err := io.ReadFull(h, out); err != nil {
+		return nil, nil, err
+	}
+	return out[:32], out[32:], nil
+}
+
+// kdfCK ratchets a chain key forward, and returns the next chain key and a message key
+func kdfCK(ck []byte) ([]byte, []byte) {
+	mac := hmac.New(sha256.New, ck)
+	mac.Write([]byte{1})
+	mk := mac.Sum(nil)
+	mac = hmac.New(sha256.New, ck)
+	mac.Write([]byte{2})
+	return mac.Sum(nil), mk
+}
+
+// x3dhSecret derives the shared secret of the handshake from its three Diffie-Hellmans
+func x3dhSecret(dh1, dh2, dh3 []byte) ([]byte, error) {
+	h := hkdf.New(sha256.New, slices.Concat(dh1, dh2, dh3), nil, []byte(GLOBAL_SALT+"/x3dh"))
+	sk := make([]byte, chacha20poly1305.KeySize)
+	_, err := io.ReadFull(h, sk)
+	return sk, err
+}
+
+// StartSession begins a [Session] with peer, using prekey, a subkey that peer has certified.
+// Messages can be sent straight away. The first one tells peer how to accept the Session.
+func (p Principal) StartSession(randy io.Reader, peer Key, prekey Subkey) (*Session, error) {
+	if err := prekey.Verify(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSession, err)
+	}
+	if !prekey.Identity.Equal(peer) {
+		return nil, fmt.Errorf("%w: prekey belongs to %s, not %s", ErrSession, prekey.Identity.Nickname(), peer.Nickname())
+	}
+	if err := prekey.Validity.ValidAt(time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: prekey: %w", ErrSession, err)
+	}
+
+	ephPriv, ephPub, err := newRatchetKey(randy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSession, err)
+	}
+	spk := prekey.Public.Bytes()
+	dh1, err1 := dh(p.privateEncryptionKey().Bytes(), spk)
+	dh2, err2 := dh(ephPriv, peer.Encryption().Bytes())
+	dh3, err3 := dh(ephPriv, spk)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSession, err)
+	}
+	sk, err := x3dhSecret(dh1, dh2, dh3)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSession, err)
+	}
+
+	s := &Session{
+		Self:       p.PublicKey(),
+		Peer:       peer,
+		ad:         slices.Concat(p.PublicKey().Bytes(), peer.Bytes()),
+		rk:         sk,
+		dhr:        spk,
+		pending:    true,
+		x3dhEph:    ephPub,
+		x3dhSubkey: prekey.ID(),
+	}
+	return s, nil
+}
+
+// AcceptSession accepts a [Session] started by the sender of msg, which must be the first message of it, or any message
+// before a reply. msg is not decrypted. Pass it to [Session.Decrypt] next.
+func (kc Keychain) AcceptSession(msg *Message) (*Session, error) {
+	id := msg.Headers.Get(Keyspace, subkeyHeader)
+	i := slices.IndexFunc(kc.Subkeys, func(sp SubkeyPair) bool {
+		return sp.ID() == id
+	})
+	if id == "" || i < 0 {
+		return nil, fmt.Errorf("%w: %w: %q", ErrSession, ErrNoSubkey, id)
+	}
+	spk := kc.Subkeys[i]
+	ephPub, err := msg.Headers.GetBytes(Keyspace, x3dhEphHeader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSession, err)
+	}
+	if msg.SenderKey.IsZero() {
+		return nil, fmt.Errorf("%w: no sender", ErrSession)
+	}
+
+	dh1, err1 := dh(spk.Private.Bytes(), msg.SenderKey.Encryption().Bytes())
+	dh2, err2 := dh(kc.Principal.privateEncryptionKey().Bytes(), ephPub)
+	dh3, err3 := dh(spk.Private.Bytes(), ephPub)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSession, err)
+	}
+	sk, err := x3dhSecret(dh1, dh2, dh3)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSession, err)
+	}
+
+	s := &Session{
+		Self:    kc.Principal.PublicKey(),
+		Peer:    msg.SenderKey,
+		ad:      slices.Concat(msg.SenderKey.Bytes(), kc.Principal.PublicKey().Bytes()),
+		rk:      sk,
+		dhsPriv: slices.Clone(spk.Private.Bytes()),
+		dhsPub:  slices.Clone(spk.Public.Bytes()),
+	}
+	return s, nil
+}
+
+// clone copies a Session deeply, so that a failed decryption can be thrown away
+func (s *Session) clone() *Session {
+	c := *s
+	c.skipped = slices.Clone(s.skipped)
+	return &c
+}
+
+// Encrypt encrypts a [Message] with the next key of the sending chain
+func (s *Session) Encrypt(randy io.Reader, msg *Message) error {
+	if msg.Encrypted() {
+		return fmt.Errorf("%w: already encrypted", ErrDelphi)
+	}
+	if !msg.Plain() {
+		return fmt.Errorf("%w: there is no plain text to encrypt", ErrDelphi)
+	}
+	if s.pending {
+		priv, pub, err := newRatchetKey(randy)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSession, err)
+		}
+		dhOut, err := dh(priv, s.dhr)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSession, err)
+		}
+		rk, cks, err := kdfRK(s.rk, dhOut)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSession, err)
+		}
+		s.dhsPriv, s.dhsPub, s.rk, s.cks = priv, pub, rk, cks
+		s.pending = false
+	}
+	if s.cks == nil {
+		return fmt.Errorf("%w: cannot send before the first message is received", ErrSession)
+	}
+
+	cks, mk := kdfCK(s.cks)
+
+	msg.SenderKey = s.Self
+	msg.RecipientKey = s.Peer
+	msg.Eph = nil
+	msg.ensureNonce(randy)
+	msg.stampVersion()
+	msg.Headers.SetBytes(Keyspace, ratchetKeyHeader, s.dhsPub)
+	msg.Headers.SetInt(Keyspace, ratchetNHeader, int64(s.ns))
+	msg.Headers.SetInt(Keyspace, ratchetPNHeader, int64(s.pn))
+	if s.x3dhEph != nil {
+		msg.Headers.SetBytes(Keyspace, x3dhEphHeader, s.x3dhEph)
+		msg.Headers.Set(Keyspace, subkeyHeader, s.x3dhSubkey)
+	}
+	aad, err := msg.aad()
+	if err != nil {
+		return err
+	}
+	cipherText, err := encrypt(mk, msg.PlainText, msg.Nonce.Bytes(), slices.Concat(s.ad, aad))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+
+	s.cks = cks
+	s.ns++
+	msg.CipherText = cipherText
+	msg.PlainText = nil
+	if msg.Subject == PlainMessage {
+		msg.Subject = EncryptedMessage
+	}
+	return nil
+}
+
+// Decrypt decrypts a [Message] sent in this Session, which may have arrived out of order.
+// If it fails, the Session is left as it was.
+func (s *Session) Decrypt(msg *Message) error {
+	if !msg.SenderKey.Equal(s.Peer) {
+		return fmt.Errorf("could not decrypt: %w: not from %s", ErrSession, s.Peer.Nickname())
+	}
+	dhr, err := msg.Headers.GetBytes(Keyspace, ratchetKeyHeader)
+	if err != nil {
+		return fmt.Errorf("could not decrypt: %w: %w", ErrSession, err)
+	}
+	n, err1 := msg.Headers.GetInt(Keyspace, ratchetNHeader)
+	pn, err2 := msg.Headers.GetInt(Keyspace, ratchetPNHeader)
+	if err := errors.Join(err1, err2); err != nil || n < 0 || pn < 0 {
+		return fmt.Errorf("could not decrypt: %w: bad counters", ErrSession)
+	}
+
+	next := s.clone()
+	mk, err := next.messageKey(dhr, uint64(n), uint64(pn))
+	if err != nil {
+		return fmt.Errorf("could not decrypt: %w", err)
+	}
+	aad, err := msg.aad()
+	if err != nil {
+		return fmt.Errorf("could not decrypt: %w", err)
+	}
+	plainTxt, err := decrypt(mk, msg.CipherText, msg.Nonce.Bytes(), slices.Concat(s.ad, aad))
+	if err != nil {
+		return fmt.Errorf("could not decrypt: %w: %w", ErrDecryptionFailed, err)
+	}
+
+	//	hearing back means the handshake got through
+	next.x3dhEph = nil
+	next.x3dhSubkey = ""
+	*s = *next
+	msg.Subject = PlainMessage
+	msg.PlainText = plainTxt
+	msg.CipherText = nil
+	return nil
+}
+
+// messageKey finds the key for message n of the chain belonging to ratchet key dhr,
+// ratcheting forward, and remembering the keys of skipped messages, as needed.
+func (s *Session) messageKey(dhr []byte, n, pn uint64) ([]byte, error) {
+	if i := slices.IndexFunc(s.skipped, func(k skippedKey) bool {
+		return k.n == n && bytes.Equal(k.dh, dhr)
+	}); i >= 0 {
+		mk := s.skipped[i].mk
+		s.skipped = slices.Delete(s.skipped, i, i+1)
+		return mk, nil
+	}
+	if !bytes.Equal(dhr, s.dhr) {
+		if err := s.skip(pn); err != nil {
+			return nil, err
+		}
+		if s.dhsPriv == nil {
+			//	the initiator has not sent yet, so it cannot have heard a new ratchet key
+			return nil, fmt.Errorf("%w: unexpected ratchet key", ErrSession)
+		}
+		dhOut, err := dh(s.dhsPriv, dhr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSession, err)
+		}
+		rk, ckr, err := kdfRK(s.rk, dhOut)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSession, err)
+		}
+		s.pn, s.ns, s.nr = s.ns, 0, 0
+		s.dhr, s.rk, s.ckr = dhr, rk, ckr
+		s.pending = true
+	}
+	if s.ckr == nil {
+		return nil, fmt.Errorf("%w: unexpected ratchet key", ErrSession)
+	}
+	if err := s.skip(n); err != nil {
+		return nil, err
+	}
+	ckr, mk := kdfCK(s.ckr)
+	s.ckr = ckr
+	s.nr++
+	return mk, nil
+}
+
+// skip ratchets the receiving chain up to message until, remembering the keys it passes
+func (s *Session) skip(until uint64) error {
+	if s.ckr == nil {
+		return nil
+	}
+	if until < s.nr {
+		return fmt.Errorf("%w: message %d was already received", ErrSession, until)
+	}
+	if until-s.nr > MaxSkip {
+		return fmt.Errorf("%w: %w: %d", ErrSession, ErrTooManySkipped, until-s.nr)
+	}
+	for s.nr < until {
+		ckr, mk := kdfCK(s.ckr)
+		s.skipped = append(s.skipped, skippedKey{dh: s.dhr, n: s.nr, mk: mk})
+		s.ckr = ckr
+		s.nr++
+	}
+	if over := len(s.skipped) - MaxSkippedKeys; over > 0 {
+		s.skipped = slices.Delete(s.skipped, 0, over)
+	}
+	return nil
+}
+
+// sessionMagic starts every [Session] in binary form
+const sessionMagic = "DSES"
+
+// MarshalBinary saves a [Session], secrets and all. Keep it somewhere safe.
+func (s *Session) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(sessionMagic)
+	buf.WriteByte(WireVersion)
+	buf.Write(s.Self.Bytes())
+	buf.Write(s.Peer.Bytes())
+	for _, b := range [][]byte{s.ad, s.rk, s.cks, s.ckr, s.dhsPriv, s.dhsPub, s.dhr, s.x3dhEph, []byte(s.x3dhSubkey)} {
+		putBytes(buf, b)
+	}
+	for _, n := range []uint64{s.ns, s.nr, s.pn} {
+		putUvarint(buf, n)
+	}
+	if s.pending {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	putUvarint(buf, uint64(len(s.skipped)))
+	for _, k := range s.skipped {
+		putBytes(buf, k.dh)
+		putUvarint(buf, k.n)
+		putBytes(buf, k.mk)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary restores a [Session] saved by [Session.MarshalBinary]
+func (s *Session) UnmarshalBinary(b []byte) error {
+	r := bytes.NewReader(b)
+	fail := func(what string, err error) error {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("%w: %s: %w", ErrSession, what, err)
+	}
+
+	head := make([]byte, len(sessionMagic)+1+4*SubKeySize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return fail("header", err)
+	}
+	if string(head[:len(sessionMagic)]) != sessionMagic {
+		return fail("magic", errors.New("not a session"))
+	}
+	if head[len(sessionMagic)] != WireVersion {
+		return fail("version", fmt.Errorf("unsupported version %d", head[len(sessionMagic)]))
+	}
+	var t Session
+	keys := head[len(sessionMagic)+1:]
+	t.Self = KeyFromBytes(keys[:2*SubKeySize])
+	t.Peer = KeyFromBytes(keys[2*SubKeySize:])
+
+	var subkey []byte
+	for _, ptr := range []*[]byte{&t.ad, &t.rk, &t.cks, &t.ckr, &t.dhsPriv, &t.dhsPub, &t.dhr, &t.x3dhEph, &subkey} {
+		v, err := getBytes(r, 4*SubKeySize)
+		if err != nil {
+			return fail("keys", err)
+		}
+		*ptr = v
+	}
+	t.x3dhSubkey = string(subkey)
+	for _, ptr := range []*uint64{&t.ns, &t.nr, &t.pn} {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fail("counters", err)
+		}
+		*ptr = n
+	}
+	pending, err := r.ReadByte()
+	if err != nil || pending > 1 {
+		return fail("pending", errors.Join(err, errors.New("bad flag")))
+	}
+	t.pending = pending == 1
+
+	n, err := getCount(r, MaxSkippedKeys)
+	if err != nil {
+		return fail("skipped", err)
+	}
+	for range n {
+		var k skippedKey
+		if k.dh, err = getBytes(r, SubKeySize); err != nil {
+			return fail("skipped", err)
+		}
+		if k.n, err = binary.ReadUvarint(r); err != nil {
+			return fail("skipped", err)
+		}
+		if k.mk, err = getBytes(r, SubKeySize); err != nil {
+			return fail("skipped", err)
+		}
+		t.skipped = append(t.skipped, k)
+	}
+	if r.Len() > 0 {
+		return fail("trailing data", fmt.Errorf("%d bytes", r.Len()))
+	}
+	*s = t
+	return nil
+}
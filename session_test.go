@@ -0,0 +1,178 @@
+package delphi
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSessions starts a session from alice to bob, and has bob accept it
+func newSessions(t *testing.T) (alice, bob Principal, a, b *Session) {
+	t.Helper()
+	alice = NewPrincipal(randy)
+	bob = NewPrincipal(randy)
+	prekey, err := bob.NewSubkey(randy, time.Hour)
+	assert.NoError(t, err)
+	a, err = alice.StartSession(randy, bob.PublicKey(), prekey.Subkey)
+	assert.NoError(t, err)
+
+	first := alice.ComposeMessage(randy, []byte("hello bob"))
+	assert.NoError(t, a.Encrypt(randy, first))
+	b, err = Keychain{Principal: bob, Subkeys: []SubkeyPair{prekey}}.AcceptSession(first)
+	assert.NoError(t, err)
+	assert.NoError(t, b.Decrypt(first))
+	assert.Equal(t, []byte("hello bob"), first.PlainText)
+	return alice, bob, a, b
+}
+
+func TestSession(t *testing.T) {
+
+	t.Run("conversation", func(t *testing.T) {
+		alice, bob, a, b := newSessions(t)
+		for i := range 5 {
+			//	back and forth, with a ratchet step each time, and sometimes more than one message
+			for j := range i % 3 {
+				msg := bob.ComposeMessage(randy, fmt.Appendf(nil, "bob %d.%d", i, j))
+				assert.NoError(t, b.Encrypt(randy, msg))
+				assert.NoError(t, a.Decrypt(msg))
+				assert.Equal(t, fmt.Appendf(nil, "bob %d.%d", i, j), msg.PlainText)
+			}
+			msg := alice.ComposeMessage(randy, fmt.Appendf(nil, "alice %d", i))
+			assert.NoError(t, a.Encrypt(randy, msg))
+			assert.NoError(t, b.Decrypt(msg))
+			assert.Equal(t, fmt.Appendf(nil, "alice %d", i), msg.PlainText)
+		}
+		assert.Nil(t, a.x3dhEph)
+	})
+
+	t.Run("every message has its own key", func(t *testing.T) {
+		alice, _, a, _ := newSessions(t)
+		one := alice.ComposeMessage(randy, []byte("same"))
+		two := alice.ComposeMessage(randy, []byte("same"))
+		two.Nonce = one.Nonce
+		assert.NoError(t, a.Encrypt(randy, one))
+		assert.NoError(t, a.Encrypt(randy, two))
+		assert.NotEqual(t, one.CipherText, two.CipherText)
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		_, bob, a, b := newSessions(t)
+		msgs := make([]*Message, 4)
+		for i := range msgs {
+			msgs[i] = bob.ComposeMessage(randy, fmt.Appendf(nil, "%d", i))
+			assert.NoError(t, b.Encrypt(randy, msgs[i]))
+		}
+		for _, i := range []int{2, 0, 3, 1} {
+			assert.NoError(t, a.Decrypt(msgs[i]))
+			assert.Equal(t, fmt.Appendf(nil, "%d", i), msgs[i].PlainText)
+		}
+		assert.Empty(t, a.skipped)
+	})
+
+	t.Run("old chain after a ratchet step", func(t *testing.T) {
+		alice, bob, a, b := newSessions(t)
+		late := bob.ComposeMessage(randy, []byte("late"))
+		assert.NoError(t, b.Encrypt(randy, late))
+		early := bob.ComposeMessage(randy, []byte("early"))
+		assert.NoError(t, b.Encrypt(randy, early))
+		assert.NoError(t, a.Decrypt(early))
+		reply := alice.ComposeMessage(randy, []byte("reply"))
+		assert.NoError(t, a.Encrypt(randy, reply))
+		assert.NoError(t, b.Decrypt(reply))
+		next := bob.ComposeMessage(randy, []byte("next"))
+		assert.NoError(t, b.Encrypt(randy, next))
+		assert.NoError(t, a.Decrypt(next))
+		assert.NoError(t, a.Decrypt(late))
+		assert.Equal(t, []byte("late"), late.PlainText)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		_, bob, a, b := newSessions(t)
+		msg := bob.ComposeMessage(randy, []byte("once"))
+		assert.NoError(t, b.Encrypt(randy, msg))
+		replayed := *msg
+		assert.NoError(t, a.Decrypt(msg))
+		assert.ErrorIs(t, a.Decrypt(&replayed), ErrSession)
+	})
+
+	t.Run("failure leaves the session alone", func(t *testing.T) {
+		_, bob, a, b := newSessions(t)
+		msg := bob.ComposeMessage(randy, []byte("tampered"))
+		assert.NoError(t, b.Encrypt(randy, msg))
+		before, _ := a.MarshalBinary()
+		msg.CipherText[0] ^= 1
+		assert.ErrorIs(t, a.Decrypt(msg), ErrDecryptionFailed)
+		after, _ := a.MarshalBinary()
+		assert.Equal(t, before, after)
+
+		msg.CipherText[0] ^= 1
+		msg.Headers.SetInt(Keyspace, ratchetNHeader, 5)
+		assert.Error(t, a.Decrypt(msg))
+		after, _ = a.MarshalBinary()
+		assert.Equal(t, before, after)
+	})
+
+	t.Run("too many skipped", func(t *testing.T) {
+		_, bob, a, b := newSessions(t)
+		msg := bob.ComposeMessage(randy, []byte("far ahead"))
+		b.ns = MaxSkip + 1
+		assert.NoError(t, b.Encrypt(randy, msg))
+		assert.ErrorIs(t, a.Decrypt(msg), ErrTooManySkipped)
+	})
+
+	t.Run("not from the peer", func(t *testing.T) {
+		_, bob, _, b := newSessions(t)
+		_, _, a2, _ := newSessions(t)
+		msg := bob.ComposeMessage(randy, []byte("wrong session"))
+		assert.NoError(t, b.Encrypt(randy, msg))
+		assert.ErrorIs(t, a2.Decrypt(msg), ErrSession)
+	})
+
+	t.Run("serialize", func(t *testing.T) {
+		alice, bob, a, b := newSessions(t)
+		pending := bob.ComposeMessage(randy, []byte("skipped"))
+		assert.NoError(t, b.Encrypt(randy, pending))
+		msg := bob.ComposeMessage(randy, []byte("hi"))
+		assert.NoError(t, b.Encrypt(randy, msg))
+		assert.NoError(t, a.Decrypt(msg))
+
+		bin, err := a.MarshalBinary()
+		assert.NoError(t, err)
+		restored := new(Session)
+		assert.NoError(t, restored.UnmarshalBinary(bin))
+		assert.Equal(t, a, restored)
+
+		assert.NoError(t, restored.Decrypt(pending))
+		reply := alice.ComposeMessage(randy, []byte("from a restored session"))
+		assert.NoError(t, restored.Encrypt(randy, reply))
+		assert.NoError(t, b.Decrypt(reply))
+
+		assert.ErrorIs(t, new(Session).UnmarshalBinary(bin[:len(bin)-1]), ErrSession)
+		assert.ErrorIs(t, new(Session).UnmarshalBinary(append(bin, 0)), ErrSession)
+	})
+
+	t.Run("bad prekey", func(t *testing.T) {
+		alice := NewPrincipal(randy)
+		bob := NewPrincipal(randy)
+		carol := NewPrincipal(randy)
+		prekey, err := carol.NewSubkey(randy, time.Hour)
+		assert.NoError(t, err)
+		_, err = alice.StartSession(randy, bob.PublicKey(), prekey.Subkey)
+		assert.ErrorIs(t, err, ErrSession)
+	})
+
+	t.Run("responder cannot speak first", func(t *testing.T) {
+		alice := NewPrincipal(randy)
+		bob := NewPrincipal(randy)
+		prekey, _ := bob.NewSubkey(randy, time.Hour)
+		a, _ := alice.StartSession(randy, bob.PublicKey(), prekey.Subkey)
+		first := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, a.Encrypt(randy, first))
+		b, err := Keychain{Principal: bob, Subkeys: []SubkeyPair{prekey}}.AcceptSession(first)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, b.Encrypt(randy, bob.ComposeMessage(randy, []byte("me first"))), ErrSession)
+	})
+
+}
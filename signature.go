@@ -0,0 +1,103 @@
+package delphi
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"slices"
+)
+
+var ErrBadSignature = errors.New("bad signature")
+var ErrDigestMismatch = errors.New("file does not match signature")
+
+// DefaultSignatureHash is the hash used for detached signatures, unless another is asked for
+const DefaultSignatureHash = "sha256"
+
+// the hashes that a detached signature may use
+var signatureHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// A Signature is a detached signature over a file, which is never embedded.
+// On the wire, it is a signed [Message] with subject [DetachedSignature], whose body is the hash of the file.
+type Signature struct {
+	Signer  Key
+	Hash    string
+	Sum     []byte
+	Message *Message
+}
+
+// hashFile streams r through the named hash
+func hashFile(algo string, r io.Reader) ([]byte, error) {
+	newHash, ok := signatureHashes[algo]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown hash %q. Try one of %v", ErrBadSignature, algo, slices.Sorted(maps.Keys(signatureHashes)))
+	}
+	h := newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SignDetached streams r through a hash, and signs the result. The hash defaults to [DefaultSignatureHash].
+func (p Principal) SignDetached(randy io.Reader, r io.Reader, algo string) (*Message, error) {
+	if algo == "" {
+		algo = DefaultSignatureHash
+	}
+	sum, err := hashFile(algo, r)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign: %w", err)
+	}
+	msg := p.ComposeMessage(randy, sum)
+	msg.Subject = DetachedSignature
+	msg.Headers.Set(Keyspace, "hash", algo)
+	if err := msg.Sign(randy, p); err != nil {
+		return nil, fmt.Errorf("could not sign: %w", err)
+	}
+	return msg, nil
+}
+
+// ParseSignature checks that msg is a well-formed, validly signed detached signature, and parses it.
+// It says nothing about any file. See [Signature.Check].
+func ParseSignature(msg *Message) (Signature, error) {
+	if msg == nil || msg.Subject != DetachedSignature {
+		return Signature{}, fmt.Errorf("%w: wrong subject", ErrBadSignature)
+	}
+	algo := msg.Headers.Get(Keyspace, "hash")
+	newHash, ok := signatureHashes[algo]
+	if !ok {
+		return Signature{}, fmt.Errorf("%w: unknown hash %q", ErrBadSignature, algo)
+	}
+	if len(msg.PlainText) != newHash().Size() {
+		return Signature{}, fmt.Errorf("%w: body is not a %s hash", ErrBadSignature, algo)
+	}
+	if err := msg.verifyV2(); err != nil {
+		return Signature{}, fmt.Errorf("%w: %w", ErrBadSignature, err)
+	}
+	sig := Signature{
+		Signer:  msg.SenderKey,
+		Hash:    algo,
+		Sum:     msg.PlainText,
+		Message: msg,
+	}
+	return sig, nil
+}
+
+// Check streams r through the signature's hash, and checks that it is the file that was signed.
+func (s Signature) Check(r io.Reader) error {
+	sum, err := hashFile(s.Hash, r)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(sum, s.Sum) != 1 {
+		return ErrDigestMismatch
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package delphi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignDetached(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	file := bytes.Repeat([]byte("a large release tarball. "), 100_000)
+
+	msg, err := alice.SignDetached(randy, bytes.NewReader(file), "")
+	assert.NoError(t, err)
+	assert.Len(t, msg.PlainText, 32)
+
+	//	over the wire
+	got := new(Message)
+	assert.NoError(t, got.FromPEM(toPEM(t, msg)))
+	sig, err := ParseSignature(got)
+	assert.NoError(t, err)
+	assert.True(t, sig.Signer.Equal(alice.PublicKey()))
+	assert.Equal(t, DefaultSignatureHash, sig.Hash)
+	assert.NoError(t, sig.Check(bytes.NewReader(file)))
+	assert.ErrorIs(t, sig.Check(strings.NewReader("something else")), ErrDigestMismatch)
+
+	t.Run("sha512", func(t *testing.T) {
+		msg, err := alice.SignDetached(randy, bytes.NewReader(file), "sha512")
+		assert.NoError(t, err)
+		sig, err := ParseSignature(msg)
+		assert.NoError(t, err)
+		assert.NoError(t, sig.Check(bytes.NewReader(file)))
+	})
+
+	t.Run("unknown hash", func(t *testing.T) {
+		_, err := alice.SignDetached(randy, bytes.NewReader(file), "md5")
+		assert.ErrorIs(t, err, ErrBadSignature)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		msg, _ := alice.SignDetached(randy, bytes.NewReader(file), "")
+		msg.PlainText[0] ^= 1
+		_, err := ParseSignature(msg)
+		assert.ErrorIs(t, err, ErrBadSignature)
+		msg.PlainText[0] ^= 1
+		msg.Headers.Set(Keyspace, "hash", "sha512")
+		_, err = ParseSignature(msg)
+		assert.ErrorIs(t, err, ErrBadSignature)
+	})
+
+	t.Run("v1 is refused", func(t *testing.T) {
+		msg, _ := alice.SignDetached(randy, bytes.NewReader(file), "")
+		signV1(t, msg, alice)
+		_, err := ParseSignature(msg)
+		assert.ErrorIs(t, err, ErrWeakDigest)
+	})
+
+}
@@ -0,0 +1,110 @@
+package delphi
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrSSH = errors.New("bad SSH key")
+
+// the info for deriving the encryption half of a [Principal] imported from SSH, which only has a signing half
+const sshDerivationInfo = GLOBAL_SALT + "/ssh/x25519"
+
+// MarshalAuthorizedKey returns the signing half of a [Key] as an ssh-ed25519 line for an authorized_keys file.
+// The encryption half has no place in SSH, and is left out.
+func (k Key) MarshalAuthorizedKey(comment string) ([]byte, error) {
+	pub, err := ssh.NewPublicKey(ed25519.PublicKey(k.Signing().Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSSH, err)
+	}
+	line := bytes.TrimSuffix(ssh.MarshalAuthorizedKey(pub), []byte("\n"))
+	if comment != "" {
+		line = append(append(line, ' '), comment...)
+	}
+	return append(line, '\n'), nil
+}
+
+// MarshalSSH encodes the signing half of a [Principal] as an OpenSSH private key.
+// The X25519 half is dropped, because SSH has no place for it. Importing the result with [PrincipalFromSSH]
+// derives a new one, so messages encrypted to the original [Key] can not be decrypted with the imported one.
+func (p Principal) MarshalSSH(comment string) (pem.Block, error) {
+	b, err := ssh.MarshalPrivateKey(p.privateSigningKey(), comment)
+	if err != nil {
+		return pem.Block{}, fmt.Errorf("%w: %w", ErrSSH, err)
+	}
+	return *b, nil
+}
+
+// MarshalProtectedSSH is like [Principal.MarshalSSH], but encrypts the key with passphrase, as ssh-keygen would
+func (p Principal) MarshalProtectedSSH(comment string, passphrase []byte) (pem.Block, error) {
+	b, err := ssh.MarshalPrivateKeyWithPassphrase(p.privateSigningKey(), comment, passphrase)
+	if err != nil {
+		return pem.Block{}, fmt.Errorf("%w: %w", ErrSSH, err)
+	}
+	return *b, nil
+}
+
+// PrincipalFromSSH imports an OpenSSH ed25519 private key. Pass a nil passphrase if the key is not protected.
+// SSH keys have no encryption half, so it is derived from the signing half.
+// Importing the same key twice gives the same [Principal], and exporting it with [Principal.MarshalSSH] gives back the same key.
+// That only holds for principals that came from SSH in the first place. One made by [NewPrincipal] and exported
+// comes back with the same signing half but a different encryption half.
+func PrincipalFromSSH(pemBytes []byte, passphrase []byte) (Principal, error) {
+	var raw any
+	var err error
+	if passphrase == nil {
+		raw, err = ssh.ParseRawPrivateKey(pemBytes)
+	} else {
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, passphrase)
+	}
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case errors.As(err, &missing):
+		return Principal{}, ErrPassphraseRequired
+	case errors.Is(err, x509.IncorrectPasswordError):
+		return Principal{}, ErrBadPassphrase
+	case err != nil:
+		return Principal{}, fmt.Errorf("%w: %w", ErrSSH, err)
+	}
+	var signPriv ed25519.PrivateKey
+	switch k := raw.(type) {
+	case ed25519.PrivateKey:
+		signPriv = k
+	case *ed25519.PrivateKey:
+		signPriv = *k
+	default:
+		return Principal{}, fmt.Errorf("%w: only ed25519 keys can be imported, not %T", ErrSSH, raw)
+	}
+	return principalFromSigningSeed(signPriv.Seed())
+}
+
+// principalFromSigningSeed builds a [Principal] around an ed25519 seed, deriving the X25519 half from it
+func principalFromSigningSeed(seed []byte) (Principal, error) {
+	h := hkdf.New(sha256.New, seed, nil, []byte(sshDerivationInfo))
+	encSeed := make([]byte, SubKeySize)
+	if _, err := io.ReadFull(h, encSeed); err != nil {
+		return Principal{}, err
+	}
+	encPriv, err := ecdh.X25519().NewPrivateKey(encSeed)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrBadKey, err)
+	}
+	signPriv := ed25519.NewKeyFromSeed(seed)
+
+	var p Principal
+	p[0][0] = subKey(encPriv.PublicKey().Bytes())
+	p[0][1] = subKey(signPriv.Public().(ed25519.PublicKey))
+	p[1][0] = subKey(encPriv.Bytes())
+	p[1][1] = subKey(seed)
+	return p, nil
+}
@@ -0,0 +1,93 @@
+package delphi
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSH(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	t.Run("authorized key", func(t *testing.T) {
+		line, err := alice.PublicKey().MarshalAuthorizedKey(alice.Nickname())
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(line), "ssh-ed25519 "))
+		pub, comment, _, _, err := ssh.ParseAuthorizedKey(line)
+		assert.NoError(t, err)
+		assert.Equal(t, alice.Nickname(), comment)
+		assert.Equal(t, alice.publicSigningKey(), pub.(ssh.CryptoPublicKey).CryptoPublicKey())
+	})
+
+	t.Run("a key exported from delphi signs the same in SSH", func(t *testing.T) {
+		b, err := alice.MarshalSSH("alice")
+		assert.NoError(t, err)
+		signer, err := ssh.ParsePrivateKey(pem.EncodeToMemory(&b))
+		assert.NoError(t, err)
+		sig, err := signer.Sign(randy, []byte("hello"))
+		assert.NoError(t, err)
+		assert.True(t, ed25519.Verify(alice.publicSigningKey(), []byte("hello"), sig.Blob))
+	})
+
+	t.Run("deriving the encryption half", func(t *testing.T) {
+		b, err := alice.MarshalSSH("")
+		assert.NoError(t, err)
+		pemBytes := pem.EncodeToMemory(&b)
+		imported, err := PrincipalFromSSH(pemBytes, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, alice.PublicKey().Signing(), imported.PublicKey().Signing())
+		assert.Equal(t, alice.PrivateKey().Signing(), imported.PrivateKey().Signing())
+		assert.NotEqual(t, alice.PublicKey().Encryption(), imported.PublicKey().Encryption())
+
+		again, err := PrincipalFromSSH(pemBytes, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, imported, again)
+		assert.Equal(t, imported.publicEncryptionKey().Bytes(), imported.PublicKey().Encryption().Bytes())
+
+		//	the imported principal works like any other
+		msg := bob.ComposeMessage(randy, []byte("hi"))
+		assert.NoError(t, bob.Encrypt(randy, msg, imported.PublicKey(), nil))
+		assert.NoError(t, imported.Decrypt(msg, nil))
+		assert.Equal(t, []byte("hi"), msg.PlainText)
+
+		//	and exports back to the same SSH key
+		b2, err := imported.MarshalSSH("")
+		assert.NoError(t, err)
+		k1, _ := ssh.ParseRawPrivateKey(pemBytes)
+		k2, _ := ssh.ParseRawPrivateKey(pem.EncodeToMemory(&b2))
+		assert.Equal(t, k1, k2)
+	})
+
+	t.Run("passphrase", func(t *testing.T) {
+		b, err := alice.MarshalProtectedSSH("alice", []byte("hunter2"))
+		assert.NoError(t, err)
+		pemBytes := pem.EncodeToMemory(&b)
+		_, err = PrincipalFromSSH(pemBytes, nil)
+		assert.ErrorIs(t, err, ErrPassphraseRequired)
+		_, err = PrincipalFromSSH(pemBytes, []byte("wrong"))
+		assert.ErrorIs(t, err, ErrBadPassphrase)
+		p, err := PrincipalFromSSH(pemBytes, []byte("hunter2"))
+		assert.NoError(t, err)
+		assert.Equal(t, alice.PublicKey().Signing(), p.PublicKey().Signing())
+	})
+
+	t.Run("only ed25519", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), randy)
+		assert.NoError(t, err)
+		b, err := ssh.MarshalPrivateKey(ecKey, "")
+		assert.NoError(t, err)
+		_, err = PrincipalFromSSH(pem.EncodeToMemory(b), nil)
+		assert.ErrorIs(t, err, ErrSSH)
+
+		_, err = PrincipalFromSSH([]byte("not a key"), nil)
+		assert.ErrorIs(t, err, ErrSSH)
+	})
+}
@@ -0,0 +1,276 @@
+package delphi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+/**
+ * Stream layout:
+ *	header:	magic, sender key, recipient key, ephemeral key, nonce
+ *	chunks:	ChunkSize bytes of plain text each, sealed. The last one may be shorter.
+ *
+ * Every chunk is sealed with the header as AAD, and a chunk nonce made of
+ * an 11 byte big-endian counter followed by a flag that is 1 for the last chunk only.
+ * A stream that ends without a chunk marked as last has been truncated.
+ **/
+
+// ChunkSize is the size of plain text sealed in each chunk of a stream
+const ChunkSize = 64 * 1024
+
+const streamMagic = "delphi/stream/v1\n"
+const streamInfo = "delphi/stream"
+const streamHeaderSize = len(streamMagic) + 2*(2*SubKeySize) + SubKeySize + NonceSize
+
+var ErrStreamTruncated = errors.New("stream truncated")
+var ErrStreamHeader = errors.New("bad stream header")
+
+// a streamHeader is what goes over the wire before the first chunk
+type streamHeader struct {
+	SenderKey    Key
+	RecipientKey Key
+	Eph          []byte
+	Nonce        Nonce
+}
+
+func (h streamHeader) MarshalBinary() ([]byte, error) {
+	if len(h.Eph) != SubKeySize {
+		return nil, fmt.Errorf("%w: wrong length for ephemeral key", ErrStreamHeader)
+	}
+	b := make([]byte, 0, streamHeaderSize)
+	b = append(b, streamMagic...)
+	b = append(b, h.SenderKey.Bytes()...)
+	b = append(b, h.RecipientKey.Bytes()...)
+	b = append(b, h.Eph...)
+	b = append(b, h.Nonce.Bytes()...)
+	return b, nil
+}
+
+func (h *streamHeader) UnmarshalBinary(b []byte) error {
+	if len(b) != streamHeaderSize || !bytes.HasPrefix(b, []byte(streamMagic)) {
+		return ErrStreamHeader
+	}
+	b = b[len(streamMagic):]
+	h.SenderKey = KeyFromBytes(b[:2*SubKeySize])
+	b = b[2*SubKeySize:]
+	h.RecipientKey = KeyFromBytes(b[:2*SubKeySize])
+	b = b[2*SubKeySize:]
+	h.Eph = bytes.Clone(b[:SubKeySize])
+	h.Nonce = NonceFromBytes(b[SubKeySize:])
+	return nil
+}
+
+// streamKey derives a per-stream key from a shared secret and the stream's nonce
+func streamKey(sharedSecret []byte, nonce Nonce) ([]byte, error) {
+	h := hkdf.New(sha256.New, sharedSecret, nonce.Bytes(), []byte(streamInfo))
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(h, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// chunkNonce is a counter with a final-chunk flag in the last byte
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// a streamWriter encrypts everything written to it, one chunk at a time
+type streamWriter struct {
+	w       io.Writer
+	key     []byte
+	aad     []byte
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func (sw *streamWriter) flush(last bool) error {
+	ciph, err := encrypt(sw.key, sw.buf, chunkNonce(sw.counter, last), sw.aad)
+	if err != nil {
+		return err
+	}
+	if _, err := sw.w.Write(ciph); err != nil {
+		return err
+	}
+	sw.buf = sw.buf[:0]
+	sw.counter++
+	return nil
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, fmt.Errorf("%w: write to closed stream", ErrDelphi)
+	}
+	n := 0
+	for len(p) > 0 {
+		//	a full buffer is only flushed once we know more is coming,
+		//	so that the last chunk can always be marked as such.
+		if len(sw.buf) == ChunkSize {
+			if err := sw.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(sw.buf[len(sw.buf):ChunkSize], p)
+		sw.buf = sw.buf[:len(sw.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close seals the last chunk. It does not close the underlying writer.
+func (sw *streamWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+	return sw.flush(true)
+}
+
+// a streamReader decrypts a stream one chunk at a time
+type streamReader struct {
+	r       *bufio.Reader
+	key     []byte
+	aad     []byte
+	chunk   []byte
+	plain   []byte
+	counter uint64
+	done    bool
+	// noEmptyLast refuses an empty last chunk unless it is the only one, as age does
+	noEmptyLast bool
+}
+
+func (sr *streamReader) next() error {
+	n, err := io.ReadFull(sr.r, sr.chunk)
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		sr.done = true
+	case err != nil:
+		return err
+	default:
+		//	a full chunk is the last one only if nothing follows it
+		if _, err := sr.r.Peek(1); errors.Is(err, io.EOF) {
+			sr.done = true
+		}
+	}
+	if n < chacha20poly1305.Overhead {
+		return ErrStreamTruncated
+	}
+
+	plain, err := decrypt(sr.key, sr.chunk[:n], chunkNonce(sr.counter, sr.done), sr.aad)
+	if err != nil {
+		if sr.done {
+			//	either tampered with, or cut short on a chunk boundary
+			return fmt.Errorf("%w: %w", ErrDecryptionFailed, ErrStreamTruncated)
+		}
+		return fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+	if sr.done && sr.noEmptyLast && sr.counter > 0 && len(plain) == 0 {
+		return fmt.Errorf("%w: empty last chunk", ErrDecryptionFailed)
+	}
+	sr.counter++
+	sr.plain = plain
+	return nil
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	for len(sr.plain) == 0 {
+		if sr.done {
+			return 0, io.EOF
+		}
+		if err := sr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, sr.plain)
+	sr.plain = sr.plain[n:]
+	return n, nil
+}
+
+// EncryptWriter returns a writer that encrypts a stream of arbitrary length to a recipient, chunk by chunk.
+// The caller must Close it to seal the last chunk.
+func (p Principal) EncryptWriter(randy io.Reader, w io.Writer, recipient Key) (io.WriteCloser, error) {
+
+	if recipient.IsZero() {
+		return nil, fmt.Errorf("%w: recipient: %w", ErrDelphi, ErrBadKey)
+	}
+
+	sec, eph, err := generateSharedSecret(recipient.Encryption().Bytes(), randy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+
+	hdr := streamHeader{
+		SenderKey:    p.PublicKey(),
+		RecipientKey: recipient,
+		Eph:          eph,
+		Nonce:        NewNonce(randy),
+	}
+	aad, err := hdr.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	key, err := streamKey(sec, hdr.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+	if _, err := w.Write(aad); err != nil {
+		return nil, err
+	}
+
+	sw := &streamWriter{
+		w:   w,
+		key: key,
+		aad: aad,
+		buf: make([]byte, 0, ChunkSize),
+	}
+	return sw, nil
+}
+
+// DecryptReader returns a reader of the plain text of a stream produced by [Principal.EncryptWriter].
+// It also returns the sender's public key, as claimed in the stream header.
+func (p Principal) DecryptReader(r io.Reader) (io.Reader, Key, error) {
+
+	aad := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, aad); err != nil {
+		return nil, Key{}, fmt.Errorf("%w: %w", ErrStreamHeader, err)
+	}
+	var hdr streamHeader
+	if err := hdr.UnmarshalBinary(aad); err != nil {
+		return nil, Key{}, err
+	}
+	if !hdr.RecipientKey.Equal(p.PublicKey()) {
+		return nil, Key{}, ErrNotRecipient
+	}
+
+	sec, err := extractSharedSecret(hdr.Eph, p.privateEncryptionKey().Bytes(), p.publicEncryptionKey().Bytes())
+	if err != nil {
+		return nil, Key{}, fmt.Errorf("could not decrypt: %w", err)
+	}
+	key, err := streamKey(sec, hdr.Nonce)
+	if err != nil {
+		return nil, Key{}, fmt.Errorf("could not decrypt: %w", err)
+	}
+
+	sr := &streamReader{
+		r:     bufio.NewReader(r),
+		key:   key,
+		aad:   aad,
+		chunk: make([]byte, ChunkSize+chacha20poly1305.Overhead),
+	}
+	return sr, hdr.SenderKey, nil
+}
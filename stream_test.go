@@ -0,0 +1,88 @@
+package delphi
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	sizes := map[string]int{
+		"empty":              0,
+		"small":              11,
+		"exactly one chunk":  ChunkSize,
+		"one chunk and more": ChunkSize + 1,
+		"several chunks":     3*ChunkSize + 123,
+	}
+
+	for name, size := range sizes {
+		t.Run(name, func(t *testing.T) {
+			plain := make([]byte, size)
+			randy.Read(plain)
+
+			ciph := new(bytes.Buffer)
+			w, err := alice.EncryptWriter(randy, ciph, bob.PublicKey())
+			assert.NoError(t, err)
+			_, err = io.Copy(w, bytes.NewReader(plain))
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+
+			r, sender, err := bob.DecryptReader(ciph)
+			assert.NoError(t, err)
+			assert.Equal(t, alice.PublicKey(), sender)
+			got, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, plain, got)
+		})
+	}
+
+}
+
+func TestStream_Tampering(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	plain := make([]byte, 2*ChunkSize+10)
+	randy.Read(plain)
+
+	ciph := new(bytes.Buffer)
+	w, _ := alice.EncryptWriter(randy, ciph, bob.PublicKey())
+	w.Write(plain)
+	w.Close()
+	sealed := ciph.Bytes()
+
+	t.Run("truncated on a chunk boundary", func(t *testing.T) {
+		cut := streamHeaderSize + 2*(ChunkSize+16)
+		r, _, err := bob.DecryptReader(bytes.NewReader(sealed[:cut]))
+		assert.NoError(t, err)
+		_, err = io.ReadAll(r)
+		assert.ErrorIs(t, err, ErrStreamTruncated)
+	})
+
+	t.Run("truncated header", func(t *testing.T) {
+		_, _, err := bob.DecryptReader(bytes.NewReader(sealed[:10]))
+		assert.ErrorIs(t, err, ErrStreamHeader)
+	})
+
+	t.Run("flipped bit", func(t *testing.T) {
+		bad := bytes.Clone(sealed)
+		bad[streamHeaderSize+5] ^= 1
+		r, _, err := bob.DecryptReader(bytes.NewReader(bad))
+		assert.NoError(t, err)
+		_, err = io.ReadAll(r)
+		assert.ErrorIs(t, err, ErrDecryptionFailed)
+	})
+
+	t.Run("wrong recipient", func(t *testing.T) {
+		_, _, err := alice.DecryptReader(bytes.NewReader(sealed))
+		assert.ErrorIs(t, err, ErrNotRecipient)
+	})
+
+}
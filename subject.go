@@ -15,9 +15,15 @@ func (subj Subject) String() string {
 }
 
 const (
-	PlainMessage     Subject = "DELPHI PLAIN MESSAGE"
-	EncryptedMessage Subject = "DELPHI ENCRYPTED MESSAGE"
-	Assertion        Subject = "DELPHI ASSERTION"
-	Pubkey           Subject = "DELPHI PUBLIC KEY"
-	Privkey          Subject = "DELPHI PRIVATE KEY"
+	PlainMessage      Subject = "DELPHI PLAIN MESSAGE"
+	EncryptedMessage  Subject = "DELPHI ENCRYPTED MESSAGE"
+	Assertion         Subject = "DELPHI ASSERTION"
+	Pubkey            Subject = "DELPHI PUBLIC KEY"
+	Privkey           Subject = "DELPHI PRIVATE KEY"
+	KeyCertification  Subject = "DELPHI KEY CERTIFICATION"
+	KeyRevocation     Subject = "DELPHI KEY REVOCATION"
+	PublicSubkey      Subject = "DELPHI SUBKEY"
+	PrivateSubkey     Subject = "DELPHI PRIVATE SUBKEY"
+	DetachedSignature Subject = "DELPHI SIGNATURE"
+	ChallengeMessage  Subject = "DELPHI CHALLENGE"
 )
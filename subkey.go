@@ -0,0 +1,286 @@
+package delphi
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+var ErrBadSubkey = errors.New("bad subkey")
+var ErrNoSubkey = errors.New("no valid subkey")
+
+const subkeyDomain = "delphi/subkey/v1"
+
+// the header that says which subkey a [Message] was encrypted to
+const subkeyHeader = "subkey"
+
+// A Subkey is a short-lived X25519 encryption key, certified by the signing half of a long-term identity.
+// Rotating subkeys leaves the identity, and so its [Peer.Nickname], unchanged.
+type Subkey struct {
+	Identity Key
+	Public   subKey
+	Validity Validity // the validity period of the subkey. Its Sig is made by Identity, over the subkey and its validity period.
+}
+
+// ID is a short identifier for a Subkey
+func (sk Subkey) ID() string {
+	sum := sha256.Sum256(sk.Public.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
+
+// digest binds a subkey and its validity period to an identity
+func (sk Subkey) digest() []byte {
+	h := sha256.New()
+	h.Write([]byte(subkeyDomain))
+	h.Write(sk.Identity.Bytes())
+	h.Write(sk.Public.Bytes())
+	for _, t := range []time.Time{sk.Validity.Created, sk.Validity.NotBefore, sk.Validity.NotAfter} {
+		var unix int64
+		if !t.IsZero() {
+			unix = t.Unix()
+		}
+		binary.Write(h, binary.BigEndian, unix)
+	}
+	return h.Sum(nil)
+}
+
+// Verify checks that the identity certified this subkey
+func (sk Subkey) Verify() error {
+	if sk.Identity.IsZero() || sk.Public.IsZero() {
+		return fmt.Errorf("%w: %w", ErrBadSubkey, ErrBadKey)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(sk.Identity.Signing().Bytes()), sk.digest(), sk.Validity.Sig) {
+		return fmt.Errorf("%w: %w", ErrBadSubkey, ErrNoValid)
+	}
+	return nil
+}
+
+func (sk Subkey) MarshalPEM() (pem.Block, error) {
+	hdrs := KV{}
+	hdrs.Set(Keyspace, "nick", sk.Identity.Nickname())
+	hdrs.Set(Keyspace, "version", Version)
+	hdrs.SetKey(Keyspace, "identity", sk.Identity)
+	sk.Validity.SetHeaders(hdrs)
+	blk := pem.Block{
+		Type:    string(PublicSubkey),
+		Headers: hdrs,
+		Bytes:   sk.Public.Bytes(),
+	}
+	return blk, nil
+}
+
+func (sk *Subkey) UnmarshalPEM(b pem.Block) error {
+	if Subject(b.Type) != PublicSubkey {
+		return fmt.Errorf("%w: wrong type of PEM", ErrBadSubkey)
+	}
+	if len(b.Bytes) != SubKeySize {
+		return fmt.Errorf("%w: wrong length. wanted %d but got %d", ErrBadSubkey, SubKeySize, len(b.Bytes))
+	}
+	identity, err := KV(b.Headers).GetKey(Keyspace, "identity")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadSubkey, err)
+	}
+	v, err := ValidityFromHeaders(b.Headers)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("%w: no signature", ErrBadSubkey)
+	}
+	sk.Identity = identity
+	sk.Public = subKey(b.Bytes)
+	sk.Validity = *v
+	return nil
+}
+
+// A SubkeyPair is a [Subkey] along with its private half. Keep these after they expire,
+// to decrypt messages that were sent to them.
+type SubkeyPair struct {
+	Subkey
+	Private subKey
+}
+
+func (sp SubkeyPair) MarshalPEM() (pem.Block, error) {
+	blk, err := sp.Subkey.MarshalPEM()
+	if err != nil {
+		return blk, err
+	}
+	blk.Type = string(PrivateSubkey)
+	blk.Bytes = slices.Concat(sp.Public.Bytes(), sp.Private.Bytes())
+	return blk, nil
+}
+
+// MarshalProtectedPEM is like [SubkeyPair.MarshalPEM], but encrypts the body as [Principal.MarshalProtectedPEM] does
+func (sp SubkeyPair) MarshalProtectedPEM(randy io.Reader, passphrase []byte) (pem.Block, error) {
+	blk, err := sp.MarshalPEM()
+	if err != nil {
+		return blk, err
+	}
+	if err := protectPEM(randy, &blk, passphrase); err != nil {
+		return pem.Block{}, err
+	}
+	return blk, nil
+}
+
+// UnmarshalProtectedPEM decodes a PEM produced by [SubkeyPair.MarshalProtectedPEM].
+// An unprotected PEM is accepted too, in which case passphrase is ignored.
+func (sp *SubkeyPair) UnmarshalProtectedPEM(b pem.Block, passphrase []byte) error {
+	if !IsProtectedPEM(b) {
+		return sp.UnmarshalPEM(b)
+	}
+	plain, err := unprotectPEM(b, passphrase)
+	if err != nil {
+		return err
+	}
+	b.Bytes = plain
+	return sp.unmarshalPEM(b)
+}
+
+func (sp *SubkeyPair) UnmarshalPEM(b pem.Block) error {
+	if IsProtectedPEM(b) {
+		return ErrPassphraseRequired
+	}
+	return sp.unmarshalPEM(b)
+}
+
+// unmarshalPEM decodes a PEM whose body is in the clear, and checks that its two halves belong together
+func (sp *SubkeyPair) unmarshalPEM(b pem.Block) error {
+	if Subject(b.Type) != PrivateSubkey {
+		return fmt.Errorf("%w: wrong type of PEM", ErrBadSubkey)
+	}
+	if len(b.Bytes) != 2*SubKeySize {
+		return fmt.Errorf("%w: wrong length. wanted %d but got %d", ErrBadSubkey, 2*SubKeySize, len(b.Bytes))
+	}
+	pub := b
+	pub.Type = string(PublicSubkey)
+	pub.Bytes = b.Bytes[:SubKeySize]
+	if err := sp.Subkey.UnmarshalPEM(pub); err != nil {
+		return err
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(b.Bytes[SubKeySize:])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadSubkey, err)
+	}
+	if !bytes.Equal(priv.PublicKey().Bytes(), sp.Public.Bytes()) {
+		return fmt.Errorf("%w: private half does not match public half", ErrBadSubkey)
+	}
+	sp.Private = subKey(priv.Bytes())
+	return nil
+}
+
+// NewSubkey generates an encryption subkey, certified by p, valid from now for lifetime.
+func (p Principal) NewSubkey(randy io.Reader, lifetime time.Duration) (SubkeyPair, error) {
+	priv, err := ecdh.X25519().GenerateKey(randy)
+	if err != nil {
+		return SubkeyPair{}, fmt.Errorf("%w: %w", ErrBadSubkey, err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	sk := Subkey{
+		Identity: p.PublicKey(),
+		Public:   subKey(priv.PublicKey().Bytes()),
+		Validity: Validity{Created: now, NotBefore: now},
+	}
+	if lifetime > 0 {
+		sk.Validity.NotAfter = now.Add(lifetime)
+	}
+	sk.Validity.Sig = ed25519.Sign(p.privateSigningKey(), sk.digest())
+	return SubkeyPair{Subkey: sk, Private: subKey(priv.Bytes())}, nil
+}
+
+// NewestSubkey picks, from subkeys, the most recently created one that identity certified, and that is valid at t.
+func NewestSubkey(identity Peer, subkeys []Subkey, t time.Time) (Subkey, error) {
+	var newest *Subkey
+	for i, sk := range subkeys {
+		if !sk.Identity.Equal(identity) || sk.Verify() != nil || sk.Validity.ValidAt(t) != nil {
+			continue
+		}
+		if newest == nil || sk.Validity.Created.After(newest.Validity.Created) {
+			newest = &subkeys[i]
+		}
+	}
+	if newest == nil {
+		return Subkey{}, fmt.Errorf("%w for %s", ErrNoSubkey, identity.Nickname())
+	}
+	return *newest, nil
+}
+
+// EncryptToSubkey encrypts a [Message] to the identity that certified sk, using sk instead of the identity's own encryption key.
+// Of the [EncryptOptions], RecipientValidity does not apply, because the subkey has its own.
+// With HideRecipient, the subkey is not named either.
+func (p Principal) EncryptToSubkey(randy io.Reader, msg *Message, sk Subkey, opts EncrypterOpts) error {
+	if msg.Encrypted() {
+		return fmt.Errorf("%w: already encrypted", ErrDelphi)
+	}
+	if !msg.Plain() {
+		return fmt.Errorf("%w: there is no plain text to encrypt", ErrDelphi)
+	}
+	if err := sk.Verify(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDelphi, err)
+	}
+	if err := sk.Validity.ValidAt(time.Now()); err != nil {
+		return fmt.Errorf("%w: subkey: %w", ErrDelphi, err)
+	}
+	if msg.Headers == nil {
+		msg.Headers = make(KV)
+	}
+	o := encryptOptions(opts)
+	if !o.HideRecipient {
+		msg.Headers.Set(Keyspace, subkeyHeader, sk.ID())
+	}
+	return p.seal(randy, msg, sk.Identity, sk.Public.Bytes(), o)
+}
+
+// A Keychain is a [Principal] along with the private halves of its subkeys, past and present.
+type Keychain struct {
+	Principal Principal
+	Subkeys   []SubkeyPair
+}
+
+// Decrypt decrypts a [Message] sent either to the Principal, or to any of its subkeys, expired or not.
+// A message with a hidden recipient is tried with each of them.
+func (kc Keychain) Decrypt(msg *Message, opts crypto.DecrypterOpts) error {
+	id := msg.Headers.Get(Keyspace, subkeyHeader)
+	if id == "" && msg.HiddenRecipient() && len(msg.Slots) == 0 {
+		return kc.trialDecrypt(msg, decryptOptions(opts))
+	}
+	if id == "" {
+		return kc.Principal.Decrypt(msg, opts)
+	}
+	i := slices.IndexFunc(kc.Subkeys, func(sp SubkeyPair) bool {
+		return sp.ID() == id
+	})
+	if i < 0 {
+		return fmt.Errorf("could not decrypt: %w: %w: %s", ErrNotRecipient, ErrNoSubkey, id)
+	}
+	sp := kc.Subkeys[i]
+	return openSealed(msg, sp.Private.Bytes(), sp.Public.Bytes(), kc.Principal.PublicKey(), decryptOptions(opts))
+}
+
+// trialDecrypt tries the Principal, then each subkey, on a [Message] with a hidden recipient.
+// Like [TrialDecrypt], it moves on from a key that is not the recipient, or that fails to decrypt.
+func (kc Keychain) trialDecrypt(msg *Message, o DecryptOptions) error {
+	err := kc.Principal.Decrypt(msg, o)
+	for _, sp := range kc.Subkeys {
+		if !errors.Is(err, ErrNotRecipient) && !errors.Is(err, ErrDecryptionFailed) {
+			break
+		}
+		err = openSealed(msg, sp.Private.Bytes(), sp.Public.Bytes(), kc.Principal.PublicKey(), o)
+		if err == nil {
+			msg.RecipientKey = kc.Principal.PublicKey()
+		}
+	}
+	if errors.Is(err, ErrDecryptionFailed) {
+		return ErrNotRecipient
+	}
+	return err
+}
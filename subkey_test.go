@@ -0,0 +1,186 @@
+package delphi
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// oldSubkey makes a subkey for p that expired a year ago
+func oldSubkey(t *testing.T, p Principal) SubkeyPair {
+	t.Helper()
+	sp, err := p.NewSubkey(randy, 0)
+	assert.NoError(t, err)
+	lastYear := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+	sp.Validity = Validity{Created: lastYear, NotBefore: lastYear, NotAfter: lastYear.Add(time.Hour)}
+	sp.Validity.Sig = ed25519.Sign(p.privateSigningKey(), sp.digest())
+	return sp
+}
+
+func TestSubkey(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	sp, err := bob.NewSubkey(randy, time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, sp.Verify())
+	assert.True(t, sp.Identity.Equal(bob.PublicKey()))
+
+	t.Run("bound to the identity", func(t *testing.T) {
+		forged := sp.Subkey
+		forged.Identity = alice.PublicKey()
+		assert.ErrorIs(t, forged.Verify(), ErrBadSubkey)
+		extended := sp.Subkey
+		extended.Validity.NotAfter = extended.Validity.NotAfter.Add(time.Hour)
+		assert.ErrorIs(t, extended.Verify(), ErrBadSubkey)
+	})
+
+	t.Run("PEM", func(t *testing.T) {
+		blk, err := sp.Subkey.MarshalPEM()
+		assert.NoError(t, err)
+		var pub Subkey
+		assert.NoError(t, pub.UnmarshalPEM(blk))
+		assert.NoError(t, pub.Verify())
+		assert.Equal(t, sp.ID(), pub.ID())
+
+		blk, err = sp.MarshalPEM()
+		assert.NoError(t, err)
+		var priv SubkeyPair
+		assert.NoError(t, priv.UnmarshalPEM(blk))
+		assert.Equal(t, sp.Private, priv.Private)
+		assert.Error(t, pub.UnmarshalPEM(blk))
+
+		//	a private half that does not belong to the public half
+		other := NewPrincipal(randy)
+		copy(blk.Bytes[SubKeySize:], other.PrivateKey().Encryption().Bytes())
+		assert.ErrorIs(t, new(SubkeyPair).UnmarshalPEM(blk), ErrBadSubkey)
+	})
+
+	t.Run("protected PEM", func(t *testing.T) {
+		blk, err := sp.MarshalProtectedPEM(randy, []byte("hunter2"))
+		assert.NoError(t, err)
+		assert.True(t, IsProtectedPEM(blk))
+		var priv SubkeyPair
+		assert.ErrorIs(t, priv.UnmarshalPEM(blk), ErrPassphraseRequired)
+		assert.ErrorIs(t, priv.UnmarshalProtectedPEM(blk, []byte("wrong")), ErrBadPassphrase)
+		assert.NoError(t, priv.UnmarshalProtectedPEM(blk, []byte("hunter2")))
+		assert.Equal(t, sp.Private, priv.Private)
+		assert.Equal(t, sp.ID(), priv.ID())
+	})
+
+	t.Run("newest", func(t *testing.T) {
+		old := oldSubkey(t, bob)
+		_, err := NewestSubkey(bob.PublicKey(), []Subkey{old.Subkey}, time.Now())
+		assert.ErrorIs(t, err, ErrNoSubkey)
+		newest, err := NewestSubkey(bob.PublicKey(), []Subkey{old.Subkey, sp.Subkey}, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, sp.ID(), newest.ID())
+		_, err = NewestSubkey(alice.PublicKey(), []Subkey{old.Subkey, sp.Subkey}, time.Now())
+		assert.ErrorIs(t, err, ErrNoSubkey)
+	})
+
+}
+
+func TestEncryptToSubkey(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	sp, _ := bob.NewSubkey(randy, time.Hour)
+
+	msg := alice.ComposeMessage(randy, []byte("hello"))
+	assert.NoError(t, alice.EncryptToSubkey(randy, msg, sp.Subkey, nil))
+	assert.True(t, msg.RecipientKey.Equal(bob.PublicKey()))
+
+	//	over the wire
+	blk := toPEM(t, msg)
+	got := new(Message)
+	assert.NoError(t, got.FromPEM(blk))
+
+	//	the identity's own key cannot decrypt it. The keychain can.
+	assert.Error(t, bob.Decrypt(got, nil))
+	kc := Keychain{Principal: bob, Subkeys: []SubkeyPair{oldSubkey(t, bob), sp}}
+	assert.NoError(t, kc.Decrypt(got, nil))
+	assert.Equal(t, []byte("hello"), got.PlainText)
+
+	t.Run("expired subkeys still decrypt", func(t *testing.T) {
+		old := oldSubkey(t, bob)
+		msg := alice.ComposeMessage(randy, []byte("archived"))
+		assert.ErrorIs(t, alice.EncryptToSubkey(randy, msg, old.Subkey, nil), ErrExpired)
+
+		//	as if it had been sent last year
+		msg.Headers.Set(Keyspace, subkeyHeader, old.ID())
+		assert.NoError(t, alice.seal(randy, msg, bob.PublicKey(), old.Public.Bytes(), encryptOptions(nil)))
+		assert.NoError(t, Keychain{Principal: bob, Subkeys: []SubkeyPair{old}}.Decrypt(msg, nil))
+		assert.Equal(t, []byte("archived"), msg.PlainText)
+	})
+
+	t.Run("no subkey", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.EncryptToSubkey(randy, msg, sp.Subkey, nil))
+		assert.ErrorIs(t, Keychain{Principal: bob}.Decrypt(msg, nil), ErrNoSubkey)
+	})
+
+	t.Run("hidden recipient, with the right subkey last", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.EncryptToSubkey(randy, msg, sp.Subkey, EncryptOptions{HideRecipient: true}))
+		assert.NoError(t, kc.Decrypt(msg, nil))
+		assert.Equal(t, []byte("hello"), msg.PlainText)
+
+		//	without a hint, each wrong key fails to decrypt, rather than knowing it is not the recipient
+		msg = alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.EncryptToSubkey(randy, msg, sp.Subkey, EncryptOptions{HideRecipient: true}))
+		sharedSec, err := extractSharedSecret(msg.Eph, sp.Private.Bytes(), sp.Public.Bytes())
+		assert.NoError(t, err)
+		msg.Headers.Delete(Keyspace, hintHeader)
+		aad, err := msg.aad()
+		assert.NoError(t, err)
+		msg.CipherText, err = encrypt(sharedSec, []byte("hello"), msg.Nonce.Bytes(), aad)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, bob.Decrypt(msg, nil), ErrDecryptionFailed)
+		assert.NoError(t, kc.Decrypt(msg, nil))
+		assert.Equal(t, []byte("hello"), msg.PlainText)
+
+		msg = alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.EncryptToSubkey(randy, msg, sp.Subkey, EncryptOptions{HideRecipient: true}))
+		assert.ErrorIs(t, Keychain{Principal: bob, Subkeys: []SubkeyPair{oldSubkey(t, bob)}}.Decrypt(msg, nil), ErrNotRecipient)
+	})
+
+	t.Run("plain keys still work", func(t *testing.T) {
+		msg := alice.ComposeMessage(randy, []byte("hello"))
+		assert.NoError(t, alice.Encrypt(randy, msg, bob.PublicKey(), nil))
+		assert.NoError(t, kc.Decrypt(msg, nil))
+	})
+
+}
+
+func TestKeyring_Subkeys(t *testing.T) {
+
+	bob := NewPrincipal(randy)
+	old := oldSubkey(t, bob)
+	sp, _ := bob.NewSubkey(randy, time.Hour)
+
+	fsys := afero.NewMemMapFs()
+	kr, _ := OpenKeyring(fsys, "keyring.pem")
+	assert.NoError(t, kr.Add(bob.PublicKey()))
+	assert.NoError(t, kr.AddSubkey(old.Subkey))
+	assert.NoError(t, kr.AddSubkey(sp.Subkey))
+	forged := sp.Subkey
+	forged.Validity.NotAfter = time.Time{}
+	assert.ErrorIs(t, kr.AddSubkey(forged), ErrBadSubkey)
+	assert.NoError(t, kr.Save())
+
+	kr, err := OpenKeyring(fsys, "keyring.pem")
+	assert.NoError(t, err)
+	assert.Len(t, kr.Subkeys(bob.PublicKey()), 2)
+	newest, err := kr.NewestSubkey(bob.PublicKey(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, sp.ID(), newest.ID())
+
+	assert.NoError(t, kr.Remove(bob.PublicKey()))
+	assert.Empty(t, kr.Subkeys(bob.PublicKey()))
+
+}
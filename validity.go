@@ -0,0 +1,138 @@
+package delphi
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrExpired = errors.New("key has expired")
+var ErrNotYetValid = errors.New("key is not yet valid")
+var ErrBadValidity = errors.New("bad validity")
+
+const validityDomain = "delphi/validity/v1"
+
+// A Validity is the period during which a key may be used.
+// It is bound to the key by the key's own signature, so that it cannot be edited by anyone else.
+type Validity struct {
+	Created   time.Time
+	NotBefore time.Time
+	NotAfter  time.Time // zero means the key never expires
+	Sig       []byte
+}
+
+// digest binds the validity period to a key
+func (v Validity) digest(k Key) []byte {
+	h := sha256.New()
+	h.Write([]byte(validityDomain))
+	h.Write(k.Bytes())
+	for _, t := range []time.Time{v.Created, v.NotBefore, v.NotAfter} {
+		var unix int64
+		if !t.IsZero() {
+			unix = t.Unix()
+		}
+		binary.Write(h, binary.BigEndian, unix)
+	}
+	return h.Sum(nil)
+}
+
+// NewValidity creates a self-signed [Validity] for p, valid from now for lifetime.
+// A lifetime of zero means forever.
+func (p Principal) NewValidity(lifetime time.Duration) Validity {
+	now := time.Now().UTC().Truncate(time.Second)
+	v := Validity{Created: now, NotBefore: now}
+	if lifetime > 0 {
+		v.NotAfter = now.Add(lifetime)
+	}
+	return p.SignValidity(v)
+}
+
+// SignValidity binds a validity period to p, by signing it
+func (p Principal) SignValidity(v Validity) Validity {
+	v.Sig = ed25519.Sign(p.privateSigningKey(), v.digest(p.PublicKey()))
+	return v
+}
+
+// Verify checks that k itself signed this validity period
+func (v Validity) Verify(k Key) error {
+	if len(v.Sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: no signature", ErrBadValidity)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(k.Signing().Bytes()), v.digest(k), v.Sig) {
+		return fmt.Errorf("%w: %w", ErrBadValidity, ErrNoValid)
+	}
+	return nil
+}
+
+// ValidAt checks that t falls within the validity period
+func (v Validity) ValidAt(t time.Time) error {
+	if !v.NotBefore.IsZero() && t.Before(v.NotBefore) {
+		return fmt.Errorf("%w: not before %s", ErrNotYetValid, v.NotBefore.Format(time.RFC3339))
+	}
+	if !v.NotAfter.IsZero() && t.After(v.NotAfter) {
+		return fmt.Errorf("%w: not after %s", ErrExpired, v.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Check verifies that the validity period belongs to k, and that t falls within it
+func (v Validity) Check(k Key, t time.Time) error {
+	if err := v.Verify(k); err != nil {
+		return err
+	}
+	return v.ValidAt(t)
+}
+
+// SetHeaders writes the validity period into PEM headers
+func (v Validity) SetHeaders(hdrs map[string]string) {
+	kv := KV(hdrs)
+	for k, t := range map[string]time.Time{"created": v.Created, "not-before": v.NotBefore, "not-after": v.NotAfter} {
+		if !t.IsZero() {
+			kv.SetTime(Keyspace, k, t)
+		}
+	}
+	kv.SetBytes(Keyspace, "validity-sig", v.Sig)
+}
+
+// ValidityFromHeaders reads a validity period from PEM headers. It returns nil if there isn't one.
+// The signature is not checked. See [Validity.Verify].
+func ValidityFromHeaders(hdrs map[string]string) (*Validity, error) {
+	kv := KV(hdrs)
+	sig, err := kv.GetBytes(Keyspace, "validity-sig")
+	if errors.Is(err, ErrNoHeader) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadValidity, err)
+	}
+	v := &Validity{Sig: sig}
+	for k, t := range map[string]*time.Time{"created": &v.Created, "not-before": &v.NotBefore, "not-after": &v.NotAfter} {
+		*t, err = kv.GetTime(Keyspace, k)
+		if err != nil && !errors.Is(err, ErrNoHeader) {
+			return nil, fmt.Errorf("%w: %w", ErrBadValidity, err)
+		}
+	}
+	return v, nil
+}
+
+// VerifyWithin verifies the signature on a [Message], and checks that it was made
+// within the signer's validity period.
+func (msg *Message) VerifyWithin(v Validity) error {
+	if !msg.Verify() {
+		return ErrNoValid
+	}
+	if err := v.Verify(msg.SenderKey); err != nil {
+		return err
+	}
+	signedAt := msg.SignedAt()
+	if signedAt.IsZero() {
+		return fmt.Errorf("%w: signature has no time", ErrNoValid)
+	}
+	if err := v.ValidAt(signedAt); err != nil {
+		return fmt.Errorf("signed outside of validity period: %w", err)
+	}
+	return nil
+}
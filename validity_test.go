@@ -0,0 +1,90 @@
+package delphi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidity(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	v := alice.NewValidity(time.Hour)
+	assert.NoError(t, v.Verify(alice.PublicKey()))
+	assert.NoError(t, v.Check(alice.PublicKey(), time.Now()))
+	assert.ErrorIs(t, v.ValidAt(time.Now().Add(2*time.Hour)), ErrExpired)
+	assert.ErrorIs(t, v.ValidAt(time.Now().Add(-time.Hour)), ErrNotYetValid)
+
+	t.Run("bound to the key", func(t *testing.T) {
+		assert.ErrorIs(t, v.Verify(bob.PublicKey()), ErrBadValidity)
+		edited := v
+		edited.NotAfter = edited.NotAfter.Add(time.Hour)
+		assert.ErrorIs(t, edited.Verify(alice.PublicKey()), ErrBadValidity)
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		blk, _ := alice.PublicKey().MarshalPEM()
+		v.SetHeaders(blk.Headers)
+		got, err := ValidityFromHeaders(blk.Headers)
+		assert.NoError(t, err)
+		assert.True(t, v.NotAfter.Equal(got.NotAfter))
+		assert.NoError(t, got.Verify(alice.PublicKey()))
+
+		plain, _ := bob.PublicKey().MarshalPEM()
+		got, err = ValidityFromHeaders(plain.Headers)
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("forever", func(t *testing.T) {
+		forever := alice.NewValidity(0)
+		assert.True(t, forever.NotAfter.IsZero())
+		assert.NoError(t, forever.Check(alice.PublicKey(), time.Now().AddDate(100, 0, 0)))
+	})
+
+}
+
+func TestEncrypt_Expired(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+
+	lastYear := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+	expired := bob.SignValidity(Validity{Created: lastYear, NotBefore: lastYear, NotAfter: lastYear.Add(time.Hour)})
+
+	msg := alice.ComposeMessage(randy, []byte("hello"))
+	err := alice.Encrypt(randy, msg, bob.PublicKey(), &EncryptOptions{RecipientValidity: &expired})
+	assert.ErrorIs(t, err, ErrExpired)
+	assert.False(t, msg.Encrypted())
+
+	current := bob.NewValidity(time.Hour)
+	err = alice.Encrypt(randy, msg, bob.PublicKey(), EncryptOptions{RecipientValidity: &current})
+	assert.NoError(t, err)
+
+}
+
+func TestVerifyWithin(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	lastYear := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+	expired := alice.SignValidity(Validity{Created: lastYear, NotBefore: lastYear, NotAfter: lastYear.Add(time.Hour)})
+
+	msg := alice.ComposeMessage(randy, []byte("hello"))
+	assert.NoError(t, msg.Sign(randy, alice))
+	assert.True(t, msg.Verify())
+	assert.ErrorIs(t, msg.VerifyWithin(expired), ErrExpired)
+	assert.NoError(t, msg.VerifyWithin(alice.NewValidity(time.Hour)))
+
+	//	a keyring that knows alice's validity flags it too
+	kr, _ := OpenKeyring(afero.NewMemMapFs(), "keyring.pem")
+	kr.Add(alice.PublicKey())
+	assert.NoError(t, kr.AddValidity(alice.PublicKey(), expired))
+	assert.NoError(t, kr.Save())
+	kr, _ = OpenKeyring(kr.fs, "keyring.pem")
+	assert.ErrorIs(t, kr.Verify(msg), ErrExpired)
+
+}
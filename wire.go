@@ -0,0 +1,257 @@
+package delphi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// wireMagic starts every [Message] in binary form
+const wireMagic = "DLPH"
+
+// WireVersion is the version of the binary form of a [Message]
+const WireVersion byte = 1
+
+// limits on what a binary [Message] may contain. Anything bigger is refused before it is allocated.
+const (
+	MaxWireSubject   = 256
+	MaxWireHeaders   = 256
+	MaxWireHeaderLen = 4096
+	MaxWireBody      = 64 << 20
+	MaxWireSlots     = 1024
+)
+
+// whether the body of a binary [Message] is plain text or cipher text
+const (
+	wirePlain  byte = 0
+	wireCipher byte = 1
+)
+
+var ErrBadWire = errors.New("bad binary message")
+
+// MarshalBinary encodes a [Message] compactly, as:
+//
+//	magic "DLPH", version byte,
+//	subject, recipient key (64 bytes), sender key (64 bytes), nonce (12 bytes),
+//	header count, then each header's key and value in lexical order,
+//	ephemeral key, body kind byte (0 plain, 1 cipher), body, signature,
+//	slot count, then each slot ([SlotSize] bytes).
+//
+// Counts and lengths are unsigned varints. Missing keys and nonces are all zeros.
+// A Message over the limits that [Message.UnmarshalBinary] enforces is refused, rather than encoded to something that can not be read back.
+func (msg *Message) MarshalBinary() ([]byte, error) {
+	if msg.Plain() && msg.Encrypted() {
+		return nil, fmt.Errorf("%w: both plain and cipher text", ErrBadWire)
+	}
+	if err := msg.checkWireLimits(); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString(wireMagic)
+	buf.WriteByte(WireVersion)
+	putBytes(buf, []byte(msg.Subject))
+	buf.Write(msg.RecipientKey.Bytes())
+	buf.Write(msg.SenderKey.Bytes())
+	buf.Write(msg.Nonce.Bytes())
+	putUvarint(buf, uint64(len(msg.Headers)))
+	for k, v := range msg.Headers.LexicalOrder() {
+		putBytes(buf, []byte(k))
+		putBytes(buf, []byte(v))
+	}
+	putBytes(buf, msg.Eph)
+	if msg.Encrypted() {
+		buf.WriteByte(wireCipher)
+		putBytes(buf, msg.CipherText)
+	} else {
+		buf.WriteByte(wirePlain)
+		putBytes(buf, msg.PlainText)
+	}
+	putBytes(buf, msg.Sig)
+	putUvarint(buf, uint64(len(msg.Slots)))
+	for _, slot := range msg.Slots {
+		b, err := slot.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// checkWireLimits checks a [Message] against the same limits as [Message.UnmarshalBinary]
+func (msg *Message) checkWireLimits() error {
+	over := func(what string, n, max int) error {
+		if n > max {
+			return fmt.Errorf("%w: %s: %d is over the limit of %d", ErrBadWire, what, n, max)
+		}
+		return nil
+	}
+	body := msg.PlainText
+	if msg.Encrypted() {
+		body = msg.CipherText
+	}
+	err := errors.Join(
+		over("subject", len(msg.Subject), MaxWireSubject),
+		over("headers", len(msg.Headers), MaxWireHeaders),
+		over("body", len(body), MaxWireBody),
+		over("signature", len(msg.Sig), 64),
+		over("slots", len(msg.Slots), MaxWireSlots),
+	)
+	if err != nil {
+		return err
+	}
+	for k, v := range msg.Headers {
+		if err := errors.Join(over("header key", len(k), MaxWireHeaderLen), over("header value", len(v), MaxWireHeaderLen)); err != nil {
+			return err
+		}
+	}
+	if len(msg.Eph) != 0 && len(msg.Eph) != SubKeySize {
+		return fmt.Errorf("%w: ephemeral key: wrong length %d", ErrBadWire, len(msg.Eph))
+	}
+	return nil
+}
+
+// UnmarshalBinary decodes a [Message] encoded by [Message.MarshalBinary], refusing anything over the limits.
+func (msg *Message) UnmarshalBinary(b []byte) error {
+	r := bytes.NewReader(b)
+	fail := func(what string, err error) error {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("%w: %s: %w", ErrBadWire, what, err)
+	}
+
+	magic := make([]byte, len(wireMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return fail("magic", err)
+	}
+	if string(magic[:len(wireMagic)]) != wireMagic {
+		return fail("magic", errors.New("not a binary message"))
+	}
+	if magic[len(wireMagic)] != WireVersion {
+		return fail("version", fmt.Errorf("unsupported version %d", magic[len(wireMagic)]))
+	}
+
+	var m Message
+	subj, err := getBytes(r, MaxWireSubject)
+	if err != nil {
+		return fail("subject", err)
+	}
+	m.Subject = Subject(subj)
+
+	keys := make([]byte, 4*SubKeySize+NonceSize)
+	if _, err := io.ReadFull(r, keys); err != nil {
+		return fail("keys", err)
+	}
+	m.RecipientKey = KeyFromBytes(keys[:2*SubKeySize])
+	m.SenderKey = KeyFromBytes(keys[2*SubKeySize : 4*SubKeySize])
+	m.Nonce = NonceFromBytes(keys[4*SubKeySize:])
+
+	n, err := getCount(r, MaxWireHeaders)
+	if err != nil {
+		return fail("headers", err)
+	}
+	m.Headers = make(KV, n)
+	for range n {
+		k, err := getBytes(r, MaxWireHeaderLen)
+		if err != nil {
+			return fail("header key", err)
+		}
+		v, err := getBytes(r, MaxWireHeaderLen)
+		if err != nil {
+			return fail("header value", err)
+		}
+		if _, dup := m.Headers[string(k)]; dup {
+			return fail("headers", fmt.Errorf("duplicate %q", k))
+		}
+		m.Headers[string(k)] = string(v)
+	}
+
+	if m.Eph, err = getBytes(r, SubKeySize); err != nil {
+		return fail("ephemeral key", err)
+	}
+	if len(m.Eph) != 0 && len(m.Eph) != SubKeySize {
+		return fail("ephemeral key", fmt.Errorf("wrong length %d", len(m.Eph)))
+	}
+
+	kind, err := r.ReadByte()
+	if err != nil {
+		return fail("body", err)
+	}
+	body, err := getBytes(r, MaxWireBody)
+	if err != nil {
+		return fail("body", err)
+	}
+	switch kind {
+	case wirePlain:
+		m.PlainText = body
+	case wireCipher:
+		m.CipherText = body
+	default:
+		return fail("body", fmt.Errorf("unknown kind %d", kind))
+	}
+
+	if m.Sig, err = getBytes(r, 64); err != nil {
+		return fail("signature", err)
+	}
+
+	n, err = getCount(r, MaxWireSlots)
+	if err != nil {
+		return fail("slots", err)
+	}
+	if n > 0 {
+		m.Slots = make([]Slot, n)
+	}
+	for i := range m.Slots {
+		b := make([]byte, SlotSize)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return fail("slots", err)
+		}
+		if err := m.Slots[i].UnmarshalBinary(b); err != nil {
+			return fail("slots", err)
+		}
+	}
+
+	if r.Len() > 0 {
+		return fail("trailing data", fmt.Errorf("%d bytes", r.Len()))
+	}
+	*msg = m
+	return nil
+}
+
+func putUvarint(buf *bytes.Buffer, n uint64) {
+	buf.Write(binary.AppendUvarint(nil, n))
+}
+
+func putBytes(buf *bytes.Buffer, b []byte) {
+	putUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+// getCount reads a count that may not exceed max
+func getCount(r *bytes.Reader, max int) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(max) {
+		return 0, fmt.Errorf("%d is over the limit of %d", n, max)
+	}
+	return int(n), nil
+}
+
+// getBytes reads a length-prefixed byte slice, no longer than max. An empty one is nil.
+func getBytes(r *bytes.Reader, max int) ([]byte, error) {
+	n, err := getCount(r, max)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	if n > r.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
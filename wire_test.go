@@ -0,0 +1,118 @@
+package delphi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_MarshalBinary(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	bob := NewPrincipal(randy)
+	carol := NewPrincipal(randy)
+
+	signed := alice.ComposeMessage(randy, []byte("hello"))
+	signed.Sign(randy, alice)
+	encrypted := alice.ComposeMessage(randy, []byte("hello"))
+	alice.Encrypt(randy, encrypted, bob.PublicKey(), nil)
+	many := alice.ComposeMessage(randy, []byte("hello"))
+	alice.EncryptToMany(randy, many, bob.PublicKey(), carol.PublicKey())
+
+	for name, msg := range map[string]*Message{"signed": signed, "encrypted": encrypted, "many recipients": many} {
+		t.Run(name, func(t *testing.T) {
+			bin, err := msg.MarshalBinary()
+			assert.NoError(t, err)
+
+			got := new(Message)
+			assert.NoError(t, got.UnmarshalBinary(bin))
+			pem1, pem2 := toPEM(t, msg), toPEM(t, got)
+			assert.Equal(t, pem.EncodeToMemory(&pem1), pem.EncodeToMemory(&pem2))
+
+			//	and from PEM to binary
+			fromPem := new(Message)
+			assert.NoError(t, fromPem.FromPEM(pem1))
+			bin2, err := fromPem.MarshalBinary()
+			assert.NoError(t, err)
+			assert.Equal(t, bin, bin2)
+
+			//	more compact than PEM
+			assert.Less(t, len(bin), len(pem.EncodeToMemory(&pem1)))
+		})
+	}
+
+	t.Run("still decrypts", func(t *testing.T) {
+		bin, _ := encrypted.MarshalBinary()
+		got := new(Message)
+		assert.NoError(t, got.UnmarshalBinary(bin))
+		assert.NoError(t, bob.Decrypt(got, nil))
+		assert.Equal(t, []byte("hello"), got.PlainText)
+
+		bin, _ = signed.MarshalBinary()
+		assert.NoError(t, got.UnmarshalBinary(bin))
+		assert.True(t, got.Verify())
+	})
+
+}
+
+func TestMessage_UnmarshalBinary_Limits(t *testing.T) {
+
+	alice := NewPrincipal(randy)
+	msg := alice.ComposeMessage(randy, []byte("hello"))
+	msg.Sign(randy, alice)
+	good, _ := msg.MarshalBinary()
+
+	//	the offset of the header count
+	hdrs := len(wireMagic) + 1 + 1 + len(msg.Subject) + 4*SubKeySize + NonceSize
+
+	tamper := func(f func(b []byte) []byte) []byte {
+		return f(bytes.Clone(good))
+	}
+
+	bad := map[string][]byte{
+		"empty":     {},
+		"magic":     tamper(func(b []byte) []byte { b[0] = 'X'; return b }),
+		"version":   tamper(func(b []byte) []byte { b[len(wireMagic)] = 99; return b }),
+		"truncated": good[:len(good)-1],
+		"trailing":  append(bytes.Clone(good), 0),
+		"too many headers": tamper(func(b []byte) []byte {
+			return append(append(b[:hdrs:hdrs], binary.AppendUvarint(nil, MaxWireHeaders+1)...), b[hdrs+1:]...)
+		}),
+		"huge length": tamper(func(b []byte) []byte {
+			return append(append(b[:hdrs:hdrs], 1), binary.AppendUvarint(nil, 1<<40)...)
+		}),
+	}
+	for name, b := range bad {
+		t.Run(name, func(t *testing.T) {
+			got := new(Message)
+			assert.ErrorIs(t, got.UnmarshalBinary(b), ErrBadWire)
+		})
+	}
+
+	t.Run("marshalling refuses the same", func(t *testing.T) {
+		tooBig := map[string]func(m *Message){
+			"subject":      func(m *Message) { m.Subject = Subject(bytes.Repeat([]byte{'a'}, MaxWireSubject+1)) },
+			"header value": func(m *Message) { m.Headers["foo"] = string(bytes.Repeat([]byte{'a'}, MaxWireHeaderLen+1)) },
+			"body":         func(m *Message) { m.PlainText = make([]byte, MaxWireBody+1) },
+			"signature":    func(m *Message) { m.Sig = make([]byte, 65) },
+			"slots":        func(m *Message) { m.Slots = make([]Slot, MaxWireSlots+1) },
+			"ephemeral":    func(m *Message) { m.Eph = make([]byte, 31) },
+			"headers": func(m *Message) {
+				for i := range MaxWireHeaders + 1 {
+					m.Headers.Set(Keyspace, fmt.Sprint(i), "x")
+				}
+			},
+		}
+		for name, f := range tooBig {
+			m := alice.ComposeMessage(randy, []byte("hello"))
+			f(m)
+			_, err := m.MarshalBinary()
+			assert.ErrorIs(t, err, ErrBadWire, name)
+		}
+	})
+
+}